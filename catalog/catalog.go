@@ -0,0 +1,449 @@
+package gpxcatalog
+
+import (
+    "crypto/sha256"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "sort"
+    "time"
+
+    "github.com/dsoprea/go-logging"
+
+    "github.com/dsoprea/go-gpx"
+    "github.com/dsoprea/go-gpx/geo"
+    "github.com/dsoprea/go-gpx/reader"
+)
+
+// Hash is the SHA-256 of the content of a file.
+type Hash [sha256.Size]byte
+
+func (h Hash) String() string {
+    return fmt.Sprintf("%x", h[:])
+}
+
+// IndexedPoint is a point along with where it was found in the file. Only
+// the position, elevation, and time are kept.
+type IndexedPoint struct {
+    TrackIndex   int
+    SegmentIndex int
+    PointIndex   int
+    Point        gpxcommon.TrackPoint
+}
+
+// FileRecord is everything that is indexed for one file. A file is rescanned
+// if its size, modification time, and content hash don't all match.
+type FileRecord struct {
+    Path    string
+    Size    int64
+    ModTime time.Time
+    Hash    Hash
+
+    // Interval and TimedCount describe the points that have times.
+    Interval   gpxreader.TimeInterval
+    TimedCount int
+
+    Points []IndexedPoint
+}
+
+func (fr *FileRecord) String() string {
+    return fmt.Sprintf("FileRecord<PATH=[%s] SIZE=(%d) MTIME=[%s] HASH=[%s] POINTS=(%d)>", fr.Path, fr.Size, fr.ModTime, fr.Hash, len(fr.Points))
+}
+
+// UpdateStats describes what Update() did.
+type UpdateStats struct {
+    // Unchanged files had the same size and modification time.
+    Unchanged int
+
+    // Rehashed files had a different size or modification time (or path)
+    // but the same content, so they weren't rescanned.
+    Rehashed int
+
+    // Scanned files were new or had changed.
+    Scanned int
+
+    // Removed files were in the catalog but not in the update.
+    Removed int
+}
+
+func (us UpdateStats) String() string {
+    return fmt.Sprintf("UpdateStats<UNCHANGED=(%d) REHASHED=(%d) SCANNED=(%d) REMOVED=(%d)>", us.Unchanged, us.Rehashed, us.Scanned, us.Removed)
+}
+
+// Catalog keeps the time and position data of a collection of files so that
+// the indexes can be built without reading every file again.
+type Catalog struct {
+    records map[string]*FileRecord
+}
+
+func NewCatalog() *Catalog {
+    return &Catalog{
+        records: make(map[string]*FileRecord),
+    }
+}
+
+// Records returns the records ordered by path.
+func (c *Catalog) Records() []*FileRecord {
+    records := make([]*FileRecord, 0, len(c.records))
+    for _, fr := range c.records {
+        records = append(records, fr)
+    }
+
+    sort.Slice(records, func(i, j int) bool {
+        return records[i].Path < records[j].Path
+    })
+
+    return records
+}
+
+// Record returns the record for the path or nil.
+func (c *Catalog) Record(filepath string) *FileRecord {
+    return c.records[filepath]
+}
+
+// hashFile returns the content hash of the file.
+func hashFile(filepath string) (h Hash, err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    f, err := os.Open(filepath)
+    log.PanicIf(err)
+
+    defer f.Close()
+
+    hasher := sha256.New()
+
+    _, err = io.Copy(hasher, f)
+    log.PanicIf(err)
+
+    copy(h[:], hasher.Sum(nil))
+
+    return h, nil
+}
+
+// scanVisitor collects the points of a file along with their indices.
+type scanVisitor struct {
+    fr *FileRecord
+
+    trackIndex   int
+    segmentIndex int
+    pointIndex   int
+}
+
+func (sv *scanVisitor) TrackOpen(t *gpxcommon.Track) error {
+    sv.trackIndex++
+    sv.segmentIndex = -1
+
+    return nil
+}
+
+func (sv *scanVisitor) TrackClose(t *gpxcommon.Track) error {
+    return nil
+}
+
+func (sv *scanVisitor) TrackSegmentOpen(ts *gpxcommon.TrackSegment) error {
+    sv.segmentIndex++
+    sv.pointIndex = -1
+
+    return nil
+}
+
+func (sv *scanVisitor) TrackSegmentClose(ts *gpxcommon.TrackSegment) error {
+    return nil
+}
+
+func (sv *scanVisitor) TrackPointOpen(tp *gpxcommon.TrackPoint) error {
+    return nil
+}
+
+func (sv *scanVisitor) TrackPointClose(tp *gpxcommon.TrackPoint) error {
+    sv.pointIndex++
+
+    ip := IndexedPoint{
+        TrackIndex:   sv.trackIndex,
+        SegmentIndex: sv.segmentIndex,
+        PointIndex:   sv.pointIndex,
+        Point: gpxcommon.TrackPoint{
+            LatitudeDecimal:  tp.LatitudeDecimal,
+            LongitudeDecimal: tp.LongitudeDecimal,
+            Elevation:        tp.Elevation,
+            Time:             tp.Time,
+        },
+    }
+
+    sv.fr.Points = append(sv.fr.Points, ip)
+
+    if tp.Time.IsZero() == false {
+        interval := &sv.fr.Interval
+
+        if sv.fr.TimedCount == 0 || tp.Time.Before(interval[0]) == true {
+            interval[0] = tp.Time
+        }
+
+        if sv.fr.TimedCount == 0 || tp.Time.After(interval[1]) == true {
+            interval[1] = tp.Time
+        }
+
+        sv.fr.TimedCount++
+    }
+
+    return nil
+}
+
+// scanFile reads the points and hashes the content in one pass.
+func scanFile(filepath string, fi os.FileInfo) (fr *FileRecord, err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    f, err := os.Open(filepath)
+    log.PanicIf(err)
+
+    defer f.Close()
+
+    fr = &FileRecord{
+        Path:    filepath,
+        Size:    fi.Size(),
+        ModTime: fi.ModTime(),
+        Points:  make([]IndexedPoint, 0),
+    }
+
+    hasher := sha256.New()
+    tr := io.TeeReader(f, hasher)
+
+    sv := &scanVisitor{
+        fr:           fr,
+        trackIndex:   -1,
+        segmentIndex: -1,
+        pointIndex:   -1,
+    }
+
+    gp := gpxreader.NewGpxParser(tr, sv)
+
+    err = gp.Parse()
+    log.PanicIf(err)
+
+    // The parser might not read past the end of the document.
+    _, err = io.Copy(ioutil.Discard, tr)
+    log.PanicIf(err)
+
+    copy(fr.Hash[:], hasher.Sum(nil))
+
+    return fr, nil
+}
+
+// Update brings the catalog up to date with the given files. Files whose size
+// and modification time haven't changed are not read. Other files are hashed
+// and are only rescanned if the content doesn't match a record (at any path).
+// Records for files that aren't given are removed.
+func (c *Catalog) Update(filepaths []string) (stats UpdateStats, err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    byHash := make(map[Hash]*FileRecord)
+    for _, fr := range c.records {
+        byHash[fr.Hash] = fr
+    }
+
+    records := make(map[string]*FileRecord)
+
+    for _, filepath := range filepaths {
+        if _, found := records[filepath]; found == true {
+            continue
+        }
+
+        fi, err := os.Stat(filepath)
+        log.PanicIf(err)
+
+        existing := c.records[filepath]
+        if existing != nil && existing.Size == fi.Size() && existing.ModTime.Equal(fi.ModTime()) == true {
+            records[filepath] = existing
+            stats.Unchanged++
+
+            continue
+        }
+
+        h, err := hashFile(filepath)
+        log.PanicIf(err)
+
+        if same, found := byHash[h]; found == true {
+            fr := *same
+
+            fr.Path = filepath
+            fr.Size = fi.Size()
+            fr.ModTime = fi.ModTime()
+
+            records[filepath] = &fr
+            stats.Rehashed++
+
+            continue
+        }
+
+        fr, err := scanFile(filepath, fi)
+        log.PanicIf(err)
+
+        records[filepath] = fr
+        stats.Scanned++
+    }
+
+    for filepath := range c.records {
+        if _, found := records[filepath]; found == false {
+            stats.Removed++
+        }
+    }
+
+    c.records = records
+
+    return stats, nil
+}
+
+// recordAccessor provides the points of the records to the indexes so that
+// searches don't have to read the files. Files that aren't in the catalog are
+// read from disk.
+type recordAccessor struct {
+    gpxreader.GpxFileDataAccessor
+
+    records map[string]*FileRecord
+}
+
+func (ra *recordAccessor) Points(label string) (points []gpxreader.GpxIndexPoint, found bool) {
+    fr, found := ra.records[label]
+    if found == false {
+        return nil, false
+    }
+
+    points = make([]gpxreader.GpxIndexPoint, len(fr.Points))
+    for i, ip := range fr.Points {
+        points[i] = gpxreader.GpxIndexPoint{
+            TrackIndex:   ip.TrackIndex,
+            SegmentIndex: ip.SegmentIndex,
+            Point:        ip.Point,
+        }
+    }
+
+    return points, true
+}
+
+// accessor returns an accessor for the current records. Update() replaces
+// the records rather than changing them, so indexes that were already
+// returned keep the points that they were built from.
+func (c *Catalog) accessor() *recordAccessor {
+    return &recordAccessor{
+        records: c.records,
+    }
+}
+
+// TimeIndex returns a time index over the files. The points are taken from
+// the catalog when a search needs them, so the files are not read.
+func (c *Catalog) TimeIndex(tolerance time.Duration, maxFilesLoaded int) (gi *gpxreader.GpxIndex, err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    gi = gpxreader.NewGpxIndex(c.accessor(), tolerance, maxFilesLoaded)
+
+    for _, fr := range c.Records() {
+        gfi := gpxreader.GpxFileInfo{
+            Label:    fr.Path,
+            Interval: fr.Interval,
+            Count:    fr.TimedCount,
+        }
+
+        err := gi.AddFileInfo(gfi)
+        log.PanicIf(err)
+    }
+
+    return gi, nil
+}
+
+// SpatialIndex returns a spatial index over the points of every file. The
+// points are taken from the catalog, so the files are not read.
+func (c *Catalog) SpatialIndex(cellSize float64, df gpxgeo.DistanceFunc) *gpxgeo.SpatialIndex {
+    si := gpxgeo.NewSpatialIndex(c.accessor(), cellSize, df)
+
+    for _, fr := range c.Records() {
+        for _, ip := range fr.Points {
+            sm := gpxgeo.SpatialMatch{
+                Label:        fr.Path,
+                TrackIndex:   ip.TrackIndex,
+                SegmentIndex: ip.SegmentIndex,
+                PointIndex:   ip.PointIndex,
+                Point:        ip.Point,
+            }
+
+            si.Insert(sm)
+        }
+    }
+
+    return si
+}
+
+// Load reads a catalog that was written by Save(). An empty catalog is
+// returned if the file doesn't exist.
+func Load(catalogPath string) (c *Catalog, err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    f, err := os.Open(catalogPath)
+    if os.IsNotExist(err) == true {
+        return NewCatalog(), nil
+    }
+
+    log.PanicIf(err)
+
+    defer f.Close()
+
+    c, err = Read(f)
+    log.PanicIf(err)
+
+    return c, nil
+}
+
+// Save writes the catalog. A temporary file is written and then renamed so
+// that an interrupted save doesn't lose the previous catalog.
+func (c *Catalog) Save(catalogPath string) (err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    f, err := ioutil.TempFile(filepath.Dir(catalogPath), ".catalog")
+    log.PanicIf(err)
+
+    tempFilepath := f.Name()
+
+    defer func() {
+        // Nothing to remove if the rename succeeded.
+        os.Remove(tempFilepath)
+    }()
+
+    err = c.Write(f)
+    if err != nil {
+        f.Close()
+        log.Panic(err)
+    }
+
+    err = f.Close()
+    log.PanicIf(err)
+
+    err = os.Rename(tempFilepath, catalogPath)
+    log.PanicIf(err)
+
+    return nil
+}
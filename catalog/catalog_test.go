@@ -0,0 +1,238 @@
+package gpxcatalog
+
+import (
+    "bytes"
+    "io/ioutil"
+    "os"
+    "path"
+    "testing"
+    "time"
+
+    "github.com/dsoprea/go-logging"
+
+    "github.com/dsoprea/go-gpx"
+    "github.com/dsoprea/go-gpx/reader"
+)
+
+const (
+    testSmallGpxData = `<?xml version="1.0" encoding="UTF-8" ?><gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1"><trk><trkseg>
+<trkpt lat="8.967136" lon="-79.533077"><ele>10</ele><time>2016-12-22T14:30:59Z</time></trkpt>
+</trkseg><trkseg>
+<trkpt lat="8.968136" lon="-79.533077"><time>2016-12-22T14:37:21Z</time></trkpt>
+<trkpt lat="8.969136" lon="-79.533077"></trkpt>
+</trkseg></trk></gpx>`
+)
+
+func writeTestFile(filepath, data string) {
+    err := ioutil.WriteFile(filepath, []byte(data), 0644)
+    log.PanicIf(err)
+}
+
+func TestCatalog_Update(t *testing.T) {
+    tempPath, err := ioutil.TempDir("", "")
+    log.PanicIf(err)
+
+    defer os.RemoveAll(tempPath)
+
+    day1Filepath := path.Join(tempPath, "day1.gpx")
+    day2Filepath := path.Join(tempPath, "day2.gpx")
+
+    writeTestFile(day1Filepath, gpxreader.TestGpxData)
+    writeTestFile(day2Filepath, testSmallGpxData)
+
+    c := NewCatalog()
+
+    stats, err := c.Update([]string{day1Filepath, day2Filepath})
+    log.PanicIf(err)
+
+    if stats != (UpdateStats{Scanned: 2}) {
+        t.Fatalf("Stats not correct: %s", stats)
+    }
+
+    fr := c.Record(day2Filepath)
+    if len(fr.Points) != 3 || fr.TimedCount != 2 {
+        t.Fatalf("Record not correct: %s", fr)
+    } else if fr.Interval[0].Format(time.RFC3339) != "2016-12-22T14:30:59Z" || fr.Interval[1].Format(time.RFC3339) != "2016-12-22T14:37:21Z" {
+        t.Fatalf("Interval not correct: %s", fr.Interval)
+    }
+
+    ip := fr.Points[2]
+    if ip.TrackIndex != 0 || ip.SegmentIndex != 1 || ip.PointIndex != 1 {
+        t.Fatalf("Indices not correct: %v", ip)
+    }
+
+    // Nothing changed.
+
+    stats, err = c.Update([]string{day1Filepath, day2Filepath})
+    log.PanicIf(err)
+
+    if stats != (UpdateStats{Unchanged: 2}) {
+        t.Fatalf("Stats not correct: %s", stats)
+    }
+
+    // Only the modification time changed.
+
+    later := time.Now().Add(time.Hour)
+
+    err = os.Chtimes(day2Filepath, later, later)
+    log.PanicIf(err)
+
+    stats, err = c.Update([]string{day1Filepath, day2Filepath})
+    log.PanicIf(err)
+
+    if stats != (UpdateStats{Unchanged: 1, Rehashed: 1}) {
+        t.Fatalf("Stats not correct: %s", stats)
+    } else if c.Record(day2Filepath).ModTime.Equal(later) == false {
+        t.Fatalf("Modification time not updated.")
+    }
+
+    // The content changed and the first file was moved.
+
+    movedFilepath := path.Join(tempPath, "moved.gpx")
+
+    err = os.Rename(day1Filepath, movedFilepath)
+    log.PanicIf(err)
+
+    writeTestFile(day2Filepath, testSmallGpxData+"\n")
+
+    stats, err = c.Update([]string{movedFilepath, day2Filepath})
+    log.PanicIf(err)
+
+    if stats != (UpdateStats{Rehashed: 1, Scanned: 1, Removed: 1}) {
+        t.Fatalf("Stats not correct: %s", stats)
+    } else if c.Record(day1Filepath) != nil {
+        t.Fatalf("Removed file still in catalog.")
+    } else if c.Record(movedFilepath).Path != movedFilepath || len(c.Record(movedFilepath).Points) != 204 {
+        t.Fatalf("Moved file not correct: %s", c.Record(movedFilepath))
+    }
+}
+
+func TestCatalog_SaveLoad(t *testing.T) {
+    tempPath, err := ioutil.TempDir("", "")
+    log.PanicIf(err)
+
+    defer os.RemoveAll(tempPath)
+
+    day1Filepath := path.Join(tempPath, "day1.gpx")
+    day2Filepath := path.Join(tempPath, "day2.gpx")
+    catalogFilepath := path.Join(tempPath, "catalog")
+
+    writeTestFile(day1Filepath, gpxreader.TestGpxData)
+    writeTestFile(day2Filepath, testSmallGpxData)
+
+    // A missing catalog is empty.
+
+    c, err := Load(catalogFilepath)
+    log.PanicIf(err)
+
+    if len(c.Records()) != 0 {
+        t.Fatalf("Catalog not empty.")
+    }
+
+    _, err = c.Update([]string{day1Filepath, day2Filepath})
+    log.PanicIf(err)
+
+    err = c.Save(catalogFilepath)
+    log.PanicIf(err)
+
+    loaded, err := Load(catalogFilepath)
+    log.PanicIf(err)
+
+    original := c.Records()
+    recovered := loaded.Records()
+
+    if len(recovered) != len(original) {
+        t.Fatalf("Record count not correct: (%d)", len(recovered))
+    }
+
+    for i, fr := range original {
+        lfr := recovered[i]
+
+        if lfr.Path != fr.Path || lfr.Size != fr.Size || lfr.ModTime.Equal(fr.ModTime) == false || lfr.Hash != fr.Hash {
+            t.Fatalf("Record not correct: %s != %s", lfr, fr)
+        } else if lfr.Interval[0].Equal(fr.Interval[0]) == false || lfr.Interval[1].Equal(fr.Interval[1]) == false || lfr.TimedCount != fr.TimedCount {
+            t.Fatalf("Interval not correct: %s != %s", lfr.Interval, fr.Interval)
+        } else if len(lfr.Points) != len(fr.Points) {
+            t.Fatalf("Point count not correct: (%d) != (%d)", len(lfr.Points), len(fr.Points))
+        }
+
+        for j, ip := range fr.Points {
+            lip := lfr.Points[j]
+
+            if lip.TrackIndex != ip.TrackIndex || lip.SegmentIndex != ip.SegmentIndex || lip.PointIndex != ip.PointIndex {
+                t.Fatalf("Indices not correct: %v != %v", lip, ip)
+            } else if lip.Point.LatitudeDecimal != ip.Point.LatitudeDecimal || lip.Point.LongitudeDecimal != ip.Point.LongitudeDecimal || lip.Point.Elevation != ip.Point.Elevation || lip.Point.Time.Equal(ip.Point.Time) == false {
+                t.Fatalf("Point not correct: %s != %s", &lip.Point, &ip.Point)
+            }
+        }
+    }
+
+    // A cold start doesn't read any of the files.
+
+    stats, err := loaded.Update([]string{day1Filepath, day2Filepath})
+    log.PanicIf(err)
+
+    if stats != (UpdateStats{Unchanged: 2}) {
+        t.Fatalf("Stats not correct: %s", stats)
+    }
+}
+
+func TestRead_NotCatalog(t *testing.T) {
+    _, err := Read(bytes.NewBufferString("not a catalog"))
+    if err == nil {
+        t.Fatalf("Expected error for invalid catalog.")
+    } else if log.Is(err, ErrNotCatalog) == false {
+        log.Panic(err)
+    }
+}
+
+func TestCatalog_Indexes(t *testing.T) {
+    tempPath, err := ioutil.TempDir("", "")
+    log.PanicIf(err)
+
+    defer os.RemoveAll(tempPath)
+
+    day1Filepath := path.Join(tempPath, "day1.gpx")
+    day2Filepath := path.Join(tempPath, "day2.gpx")
+
+    writeTestFile(day1Filepath, gpxreader.TestGpxData)
+    writeTestFile(day2Filepath, testSmallGpxData)
+
+    c := NewCatalog()
+
+    _, err = c.Update([]string{day1Filepath, day2Filepath})
+    log.PanicIf(err)
+
+    gi, err := c.TimeIndex(5*time.Minute, 0)
+    log.PanicIf(err)
+
+    // Searches use the points in the catalog rather than the files.
+    err = os.Remove(day1Filepath)
+    log.PanicIf(err)
+
+    err = os.Remove(day2Filepath)
+    log.PanicIf(err)
+
+    q, err := time.Parse(time.RFC3339, "2016-12-22T14:32:59Z")
+    log.PanicIf(err)
+
+    matches, err := gi.Search(q)
+    log.PanicIf(err)
+
+    if len(matches) != 2 || matches[0].FileInfo.Label != day2Filepath {
+        t.Fatalf("Matches not correct: %v", matches)
+    }
+
+    si := c.SpatialIndex(0, nil)
+
+    if si.Len() != 207 {
+        t.Fatalf("Spatial index length not correct: (%d)", si.Len())
+    }
+
+    center := &gpxcommon.TrackPoint{LatitudeDecimal: 8.969136, LongitudeDecimal: -79.533077}
+
+    nearest := si.Nearest(center, 1)
+    if len(nearest) != 1 || nearest[0].Label != day2Filepath || nearest[0].SegmentIndex != 1 || nearest[0].PointIndex != 1 {
+        t.Fatalf("Nearest not correct: %v", nearest)
+    }
+}
@@ -0,0 +1,245 @@
+package gpxcatalog
+
+import (
+    "bufio"
+    "compress/gzip"
+    "encoding/binary"
+    "fmt"
+    "io"
+    "math"
+    "time"
+
+    "github.com/dsoprea/go-logging"
+)
+
+// The catalog is gzipped. After the magic and the version, it has the number
+// of records and then each record: the path, size, modification time, hash,
+// interval, number of timed points, and the points. Integers are varints,
+// coordinates are float64 and elevations are float32 (little-endian). A time
+// is a flag byte followed by the Unix nanoseconds if the flag is set.
+
+const (
+    catalogMagic   = "GPXCATALOG"
+    catalogVersion = 1
+)
+
+var (
+    ErrNotCatalog     = fmt.Errorf("not a catalog")
+    ErrCatalogVersion = fmt.Errorf("catalog version not supported")
+)
+
+// catalogEncoder writes the fields of the catalog.
+type catalogEncoder struct {
+    w       *bufio.Writer
+    scratch [binary.MaxVarintLen64]byte
+}
+
+func (ce *catalogEncoder) writeRaw(data []byte) {
+    _, err := ce.w.Write(data)
+    log.PanicIf(err)
+}
+
+func (ce *catalogEncoder) writeUvarint(v uint64) {
+    n := binary.PutUvarint(ce.scratch[:], v)
+    ce.writeRaw(ce.scratch[:n])
+}
+
+func (ce *catalogEncoder) writeVarint(v int64) {
+    n := binary.PutVarint(ce.scratch[:], v)
+    ce.writeRaw(ce.scratch[:n])
+}
+
+func (ce *catalogEncoder) writeString(s string) {
+    ce.writeUvarint(uint64(len(s)))
+    ce.writeRaw([]byte(s))
+}
+
+func (ce *catalogEncoder) writeFloat64(v float64) {
+    binary.LittleEndian.PutUint64(ce.scratch[:8], math.Float64bits(v))
+    ce.writeRaw(ce.scratch[:8])
+}
+
+func (ce *catalogEncoder) writeFloat32(v float32) {
+    binary.LittleEndian.PutUint32(ce.scratch[:4], math.Float32bits(v))
+    ce.writeRaw(ce.scratch[:4])
+}
+
+func (ce *catalogEncoder) writeTime(t time.Time) {
+    if t.IsZero() == true {
+        ce.writeRaw([]byte{0})
+        return
+    }
+
+    ce.writeRaw([]byte{1})
+    ce.writeVarint(t.UnixNano())
+}
+
+// catalogDecoder reads the fields of the catalog.
+type catalogDecoder struct {
+    r       *bufio.Reader
+    scratch [8]byte
+}
+
+func (cd *catalogDecoder) readRaw(data []byte) {
+    _, err := io.ReadFull(cd.r, data)
+    log.PanicIf(err)
+}
+
+func (cd *catalogDecoder) readUvarint() uint64 {
+    v, err := binary.ReadUvarint(cd.r)
+    log.PanicIf(err)
+
+    return v
+}
+
+func (cd *catalogDecoder) readVarint() int64 {
+    v, err := binary.ReadVarint(cd.r)
+    log.PanicIf(err)
+
+    return v
+}
+
+func (cd *catalogDecoder) readString() string {
+    data := make([]byte, cd.readUvarint())
+    cd.readRaw(data)
+
+    return string(data)
+}
+
+func (cd *catalogDecoder) readFloat64() float64 {
+    cd.readRaw(cd.scratch[:8])
+    return math.Float64frombits(binary.LittleEndian.Uint64(cd.scratch[:8]))
+}
+
+func (cd *catalogDecoder) readFloat32() float32 {
+    cd.readRaw(cd.scratch[:4])
+    return math.Float32frombits(binary.LittleEndian.Uint32(cd.scratch[:4]))
+}
+
+func (cd *catalogDecoder) readTime() time.Time {
+    cd.readRaw(cd.scratch[:1])
+    if cd.scratch[0] == 0 {
+        return time.Time{}
+    }
+
+    return time.Unix(0, cd.readVarint()).UTC()
+}
+
+// Write encodes the catalog.
+func (c *Catalog) Write(w io.Writer) (err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    gw := gzip.NewWriter(w)
+    ce := &catalogEncoder{
+        w: bufio.NewWriter(gw),
+    }
+
+    ce.writeRaw([]byte(catalogMagic))
+    ce.writeUvarint(catalogVersion)
+
+    records := c.Records()
+    ce.writeUvarint(uint64(len(records)))
+
+    for _, fr := range records {
+        ce.writeString(fr.Path)
+        ce.writeVarint(fr.Size)
+        ce.writeTime(fr.ModTime)
+        ce.writeRaw(fr.Hash[:])
+        ce.writeTime(fr.Interval[0])
+        ce.writeTime(fr.Interval[1])
+        ce.writeUvarint(uint64(fr.TimedCount))
+
+        ce.writeUvarint(uint64(len(fr.Points)))
+
+        for _, ip := range fr.Points {
+            ce.writeUvarint(uint64(ip.TrackIndex))
+            ce.writeUvarint(uint64(ip.SegmentIndex))
+            ce.writeUvarint(uint64(ip.PointIndex))
+            ce.writeFloat64(ip.Point.LatitudeDecimal)
+            ce.writeFloat64(ip.Point.LongitudeDecimal)
+            ce.writeFloat32(ip.Point.Elevation)
+            ce.writeTime(ip.Point.Time)
+        }
+    }
+
+    err = ce.w.Flush()
+    log.PanicIf(err)
+
+    err = gw.Close()
+    log.PanicIf(err)
+
+    return nil
+}
+
+// Read decodes a catalog that was encoded by Write().
+func Read(r io.Reader) (c *Catalog, err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    gr, err := gzip.NewReader(r)
+    if err == gzip.ErrHeader {
+        log.Panic(ErrNotCatalog)
+    }
+
+    log.PanicIf(err)
+
+    defer gr.Close()
+
+    cd := &catalogDecoder{
+        r: bufio.NewReader(gr),
+    }
+
+    magic := make([]byte, len(catalogMagic))
+    cd.readRaw(magic)
+
+    if string(magic) != catalogMagic {
+        log.Panic(ErrNotCatalog)
+    }
+
+    if cd.readUvarint() != catalogVersion {
+        log.Panic(ErrCatalogVersion)
+    }
+
+    c = NewCatalog()
+
+    count := cd.readUvarint()
+    for i := uint64(0); i < count; i++ {
+        fr := &FileRecord{
+            Path:    cd.readString(),
+            Size:    cd.readVarint(),
+            ModTime: cd.readTime(),
+        }
+
+        cd.readRaw(fr.Hash[:])
+
+        fr.Interval[0] = cd.readTime()
+        fr.Interval[1] = cd.readTime()
+        fr.TimedCount = int(cd.readUvarint())
+
+        pointCount := cd.readUvarint()
+        fr.Points = make([]IndexedPoint, pointCount)
+
+        for j := range fr.Points {
+            ip := &fr.Points[j]
+
+            ip.TrackIndex = int(cd.readUvarint())
+            ip.SegmentIndex = int(cd.readUvarint())
+            ip.PointIndex = int(cd.readUvarint())
+            ip.Point.LatitudeDecimal = cd.readFloat64()
+            ip.Point.LongitudeDecimal = cd.readFloat64()
+            ip.Point.Elevation = cd.readFloat32()
+            ip.Point.Time = cd.readTime()
+        }
+
+        c.records[fr.Path] = fr
+    }
+
+    return c, nil
+}
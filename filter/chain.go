@@ -0,0 +1,317 @@
+package gpxfilter
+
+import (
+    "fmt"
+    "sort"
+    "time"
+
+    "github.com/dsoprea/go-gpx"
+    "github.com/dsoprea/go-gpx/geo"
+    "github.com/dsoprea/go-gpx/pipe"
+)
+
+const (
+    // DefaultRemovalLimit is the most removals recorded by default.
+    DefaultRemovalLimit = 10000
+)
+
+const (
+    // SourceGps and SourceNetwork are the values of `src` that loggers use
+    // for satellite and network (cell or wifi) fixes.
+    SourceGps     = "gps"
+    SourceNetwork = "network"
+)
+
+// Reason is why a point was removed.
+type Reason int
+
+const (
+    ReasonHdop Reason = iota
+    ReasonPdop
+    ReasonSatellites
+    ReasonNetworkFix
+    ReasonDuplicate
+    ReasonSpeedSpike
+)
+
+func (r Reason) String() string {
+    switch r {
+    case ReasonHdop:
+        return "Hdop"
+    case ReasonPdop:
+        return "Pdop"
+    case ReasonSatellites:
+        return "Satellites"
+    case ReasonNetworkFix:
+        return "NetworkFix"
+    case ReasonDuplicate:
+        return "Duplicate"
+    case ReasonSpeedSpike:
+        return "SpeedSpike"
+    }
+
+    return fmt.Sprintf("Reason<%d>", int(r))
+}
+
+// Removal records a point that was removed.
+type Removal struct {
+    Point  gpxcommon.TrackPoint
+    Reason Reason
+}
+
+func (r Removal) String() string {
+    return fmt.Sprintf("Removal<REASON=[%s] %s>", r.Reason, &r.Point)
+}
+
+// ChainOptions selects the filters to apply. Zero disables a filter. Points
+// that don't have the value that a filter checks (e.g. no `hdop`) are never
+// removed by that filter.
+type ChainOptions struct {
+    // MaxHdop and MaxPdop are the highest dilutions of precision allowed.
+    MaxHdop float32
+    MaxPdop float32
+
+    // MinSatellites is the fewest satellites allowed.
+    MinSatellites uint8
+
+    // PreferGpsWindow removes network fixes that are within this long of a
+    // GPS fix.
+    PreferGpsWindow time.Duration
+
+    // RemoveDuplicates removes points at the same position as the point
+    // before them.
+    RemoveDuplicates bool
+
+    // MaxSpeed (m/s) removes single points that imply a faster speed both
+    // coming from the point before them and going to the point after them.
+    // The first point of a segment is removed if it implies a faster speed
+    // going to the second point while the second and third points agree.
+    MaxSpeed float64
+
+    // RemovalLimit is the most removals that are recorded in Chain.Removals,
+    // so that streaming a large file doesn't grow it without bound. The
+    // counts are always complete. Zero records all of them and a negative
+    // value records none.
+    RemovalLimit int
+
+    // DistanceFunc defaults to gpxgeo.Distance if not set.
+    DistanceFunc gpxgeo.DistanceFunc
+}
+
+// DefaultChainOptions returns reasonable values for phone loggers.
+func DefaultChainOptions() ChainOptions {
+    return ChainOptions{
+        MaxHdop:          5,
+        MaxPdop:          10,
+        MinSatellites:    4,
+        PreferGpsWindow:  time.Minute,
+        RemoveDuplicates: true,
+        MaxSpeed:         gpxgeo.DefaultMaxSegmentSpeed,
+        RemovalLimit:     DefaultRemovalLimit,
+        DistanceFunc:     gpxgeo.Distance,
+    }
+}
+
+// Chain applies the filters to one segment at a time, in the following
+// order: precision and satellites, network fixes, duplicates, and speed
+// spikes. Every removed point is counted and, up to the limit in the
+// options, recorded.
+type Chain struct {
+    options ChainOptions
+    counts  map[Reason]int
+
+    Removals []Removal
+}
+
+func NewChain(options ChainOptions) *Chain {
+    if options.DistanceFunc == nil {
+        options.DistanceFunc = gpxgeo.Distance
+    }
+
+    return &Chain{
+        options:  options,
+        counts:   make(map[Reason]int),
+        Removals: make([]Removal, 0),
+    }
+}
+
+// Counts returns the number of points removed for each reason, including
+// those past the removal limit.
+func (c *Chain) Counts() map[Reason]int {
+    counts := make(map[Reason]int)
+    for reason, count := range c.counts {
+        counts[reason] = count
+    }
+
+    return counts
+}
+
+func (c *Chain) remove(tp *gpxcommon.TrackPoint, reason Reason) {
+    c.counts[reason]++
+
+    limit := c.options.RemovalLimit
+    if limit < 0 || (limit > 0 && len(c.Removals) >= limit) {
+        return
+    }
+
+    c.Removals = append(c.Removals, Removal{Point: *tp, Reason: reason})
+}
+
+// Filter returns the points of a single segment that pass every filter. The
+// points must be in chronological order. A new slice is returned.
+func (c *Chain) Filter(points []gpxcommon.TrackPoint) []gpxcommon.TrackPoint {
+    kept := c.filterQuality(points)
+    kept = c.filterNetworkFixes(kept)
+    kept = c.filterDuplicates(kept)
+    kept = c.filterSpeedSpikes(kept)
+
+    return kept
+}
+
+func (c *Chain) filterQuality(points []gpxcommon.TrackPoint) []gpxcommon.TrackPoint {
+    kept := make([]gpxcommon.TrackPoint, 0, len(points))
+
+    for i := range points {
+        tp := &points[i]
+
+        if c.options.MaxHdop > 0 && tp.Hdop > c.options.MaxHdop {
+            c.remove(tp, ReasonHdop)
+        } else if c.options.MaxPdop > 0 && tp.Pdop > c.options.MaxPdop {
+            c.remove(tp, ReasonPdop)
+        } else if c.options.MinSatellites > 0 && tp.SatelliteCount > 0 && tp.SatelliteCount < c.options.MinSatellites {
+            c.remove(tp, ReasonSatellites)
+        } else {
+            kept = append(kept, *tp)
+        }
+    }
+
+    return kept
+}
+
+func (c *Chain) filterNetworkFixes(points []gpxcommon.TrackPoint) []gpxcommon.TrackPoint {
+    if c.options.PreferGpsWindow <= 0 {
+        return points
+    }
+
+    gpsTimes := make([]time.Time, 0)
+    for _, tp := range points {
+        if tp.Src == SourceGps && tp.Time.IsZero() == false {
+            gpsTimes = append(gpsTimes, tp.Time)
+        }
+    }
+
+    if len(gpsTimes) == 0 {
+        return points
+    }
+
+    kept := make([]gpxcommon.TrackPoint, 0, len(points))
+
+    for i := range points {
+        tp := &points[i]
+
+        if tp.Src == SourceNetwork && tp.Time.IsZero() == false {
+            earliest := tp.Time.Add(-c.options.PreferGpsWindow)
+
+            // The first GPS fix that isn't too early.
+            j := sort.Search(len(gpsTimes), func(j int) bool {
+                return gpsTimes[j].Before(earliest) == false
+            })
+
+            if j < len(gpsTimes) && gpsTimes[j].Sub(tp.Time) <= c.options.PreferGpsWindow {
+                c.remove(tp, ReasonNetworkFix)
+                continue
+            }
+        }
+
+        kept = append(kept, *tp)
+    }
+
+    return kept
+}
+
+func (c *Chain) filterDuplicates(points []gpxcommon.TrackPoint) []gpxcommon.TrackPoint {
+    if c.options.RemoveDuplicates == false {
+        return points
+    }
+
+    kept := make([]gpxcommon.TrackPoint, 0, len(points))
+
+    for i := range points {
+        tp := &points[i]
+
+        if len(kept) > 0 {
+            previous := &kept[len(kept)-1]
+
+            if previous.LatitudeDecimal == tp.LatitudeDecimal && previous.LongitudeDecimal == tp.LongitudeDecimal {
+                c.remove(tp, ReasonDuplicate)
+                continue
+            }
+        }
+
+        kept = append(kept, *tp)
+    }
+
+    return kept
+}
+
+// impliedSpeed returns the speed (m/s) between the points, or zero if it
+// can't be calculated.
+func (c *Chain) impliedSpeed(a, b *gpxcommon.TrackPoint) float64 {
+    if a.Time.IsZero() == true || b.Time.IsZero() == true {
+        return 0
+    }
+
+    duration := b.Time.Sub(a.Time)
+    if duration <= 0 {
+        return 0
+    }
+
+    return c.options.DistanceFunc(a, b) / duration.Seconds()
+}
+
+func (c *Chain) filterSpeedSpikes(points []gpxcommon.TrackPoint) []gpxcommon.TrackPoint {
+    if c.options.MaxSpeed <= 0 {
+        return points
+    }
+
+    kept := make([]gpxcommon.TrackPoint, 0, len(points))
+
+    for i := range points {
+        tp := &points[i]
+
+        isSpike := false
+
+        if len(kept) > 0 {
+            previous := &kept[len(kept)-1]
+
+            // The last point only has the speed coming in.
+            isSpike = c.impliedSpeed(previous, tp) > c.options.MaxSpeed
+            if isSpike == true && i+1 < len(points) {
+                isSpike = c.impliedSpeed(tp, &points[i+1]) > c.options.MaxSpeed
+            }
+        } else if i+2 < len(points) {
+            // The first point only has the speed going out. It's the one
+            // that's wrong if the next two agree with each other.
+            isSpike = c.impliedSpeed(tp, &points[i+1]) > c.options.MaxSpeed && c.impliedSpeed(&points[i+1], &points[i+2]) <= c.options.MaxSpeed
+        }
+
+        if isSpike == true {
+            c.remove(tp, ReasonSpeedSpike)
+            continue
+        }
+
+        kept = append(kept, *tp)
+    }
+
+    return kept
+}
+
+// Stage returns a pipeline stage that filters every segment. Only one
+// segment is held in memory at a time.
+func (c *Chain) Stage() gpxpipe.Stage {
+    st := func(points []gpxcommon.TrackPoint) ([]gpxcommon.TrackPoint, error) {
+        return c.Filter(points), nil
+    }
+
+    return gpxpipe.Segment(st)
+}
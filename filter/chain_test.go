@@ -0,0 +1,175 @@
+package gpxfilter
+
+import (
+    "bytes"
+    "testing"
+    "time"
+
+    "github.com/dsoprea/go-logging"
+
+    "github.com/dsoprea/go-gpx"
+    "github.com/dsoprea/go-gpx/pipe"
+    "github.com/dsoprea/go-gpx/reader"
+)
+
+// getChainTestPoints returns points ten seconds apart heading north, with one
+// problem at each of several points.
+func getChainTestPoints() []gpxcommon.TrackPoint {
+    epoch := time.Date(2016, 12, 2, 8, 0, 0, 0, time.UTC)
+
+    points := make([]gpxcommon.TrackPoint, 10)
+    for i := range points {
+        points[i] = gpxcommon.TrackPoint{
+            LatitudeDecimal:  10 + float64(i)*0.0001,
+            LongitudeDecimal: 10,
+            Time:             epoch.Add(time.Duration(i) * 10 * time.Second),
+            Src:              SourceGps,
+            Hdop:             1,
+            SatelliteCount:   8,
+        }
+    }
+
+    points[1].Hdop = 12
+    points[2].SatelliteCount = 3
+    points[3].Src = SourceNetwork
+    points[5].LatitudeDecimal = points[4].LatitudeDecimal
+    points[7].LatitudeDecimal = 11
+
+    return points
+}
+
+func TestChain_Filter(t *testing.T) {
+    points := getChainTestPoints()
+
+    c := NewChain(DefaultChainOptions())
+    kept := c.Filter(points)
+
+    if len(kept) != 5 {
+        t.Fatalf("Kept count not correct: (%d) %v", len(kept), kept)
+    } else if len(c.Removals) != 5 {
+        t.Fatalf("Removal count not correct: (%d) %v", len(c.Removals), c.Removals)
+    }
+
+    expected := []Reason{ReasonHdop, ReasonSatellites, ReasonNetworkFix, ReasonDuplicate, ReasonSpeedSpike}
+    removedIndices := []int{1, 2, 3, 5, 7}
+
+    for i, r := range c.Removals {
+        if r.Reason != expected[i] {
+            t.Fatalf("Reason (%d) not correct: %s", i, r)
+        } else if r.Point != points[removedIndices[i]] {
+            t.Fatalf("Point (%d) not correct: %s", i, r)
+        }
+    }
+}
+
+func TestChain_Filter_FirstPointSpike(t *testing.T) {
+    points := getChainTestPoints()[4:]
+    points[0].LatitudeDecimal = 11
+
+    options := ChainOptions{
+        MaxSpeed: 50,
+    }
+
+    c := NewChain(options)
+    kept := c.Filter(points)
+
+    // Only the first point and the later spike are removed.
+    if len(kept) != len(points)-2 {
+        t.Fatalf("Kept count not correct: (%d) %v", len(kept), c.Removals)
+    } else if c.Removals[0].Point != points[0] || c.Removals[1].Point != points[3] {
+        t.Fatalf("Wrong points removed: %v", c.Removals)
+    }
+}
+
+func TestChain_RemovalLimit(t *testing.T) {
+    points := getChainTestPoints()
+
+    options := DefaultChainOptions()
+    options.RemovalLimit = 2
+
+    c := NewChain(options)
+    c.Filter(points)
+
+    counts := c.Counts()
+
+    if len(c.Removals) != 2 {
+        t.Fatalf("Removals not limited: %v", c.Removals)
+    } else if counts[ReasonDuplicate] != 1 || counts[ReasonSpeedSpike] != 1 {
+        t.Fatalf("Counts not complete: %v", counts)
+    }
+
+    options.RemovalLimit = -1
+
+    c = NewChain(options)
+    c.Filter(points)
+
+    if len(c.Removals) != 0 || len(c.Counts()) != 5 {
+        t.Fatalf("Removals recorded: %v %v", c.Removals, c.Counts())
+    }
+}
+
+func TestChain_Filter_Disabled(t *testing.T) {
+    points := getChainTestPoints()
+
+    c := NewChain(ChainOptions{})
+    kept := c.Filter(points)
+
+    if len(kept) != len(points) || len(c.Removals) != 0 {
+        t.Fatalf("Points removed with all filters disabled: %v", c.Removals)
+    }
+}
+
+func TestChain_Filter_NetworkOnly(t *testing.T) {
+    points := getChainTestPoints()
+    for i := range points {
+        points[i].Src = SourceNetwork
+    }
+
+    options := ChainOptions{
+        PreferGpsWindow: time.Minute,
+    }
+
+    c := NewChain(options)
+    kept := c.Filter(points)
+
+    // With no GPS fixes to prefer, the network fixes are all we have.
+    if len(kept) != len(points) {
+        t.Fatalf("Network fixes removed without GPS fixes: %v", c.Removals)
+    }
+}
+
+func TestChain_Stage(t *testing.T) {
+    // The test data has a GPS fix every several minutes.
+    options := DefaultChainOptions()
+    options.PreferGpsWindow = 10 * time.Minute
+
+    c := NewChain(options)
+    p := gpxpipe.NewPipeline(c.Stage())
+
+    count := 0
+    sink := func(e gpxpipe.Element) error {
+        if e.Type == gpxpipe.ElementPoint {
+            count++
+        }
+
+        return nil
+    }
+
+    err := p.Enumerate(bytes.NewBufferString(gpxreader.TestGpxData), sink)
+    log.PanicIf(err)
+
+    if count+len(c.Removals) != 204 {
+        t.Fatalf("Points not accounted for: (%d) + (%d)", count, len(c.Removals))
+    }
+
+    counts := c.Counts()
+    if counts[ReasonNetworkFix] == 0 || counts[ReasonDuplicate] == 0 || counts[ReasonPdop] == 0 {
+        t.Fatalf("Expected more kinds of removals: %v", counts)
+    }
+
+    for _, r := range c.Removals {
+        if r.Reason == ReasonNetworkFix && r.Point.Src != SourceNetwork {
+            t.Fatalf("GPS fix removed as a network fix: %s", r)
+        }
+    }
+}
@@ -0,0 +1,415 @@
+package gpxfilter
+
+import (
+    "math"
+    "time"
+
+    "github.com/dsoprea/go-logging"
+
+    "github.com/dsoprea/go-gpx"
+    "github.com/dsoprea/go-gpx/geo"
+    "github.com/dsoprea/go-gpx/pipe"
+)
+
+const (
+    axisEast = iota
+    axisNorth
+    axisUp
+    axisCount
+)
+
+// initialVelocityVariance (m^2/s^2) reflects that we know nothing about the
+// velocity when a segment starts.
+const initialVelocityVariance = 100.0
+
+// KalmanOptions tunes the constant-velocity model. Accelerations are modeled
+// as white noise.
+type KalmanOptions struct {
+    // AccelerationNoise and VerticalAccelerationNoise are the spectral
+    // densities (m^2/s^3) of the random horizontal and vertical
+    // accelerations. Larger values follow the measurements more closely.
+    AccelerationNoise         float64
+    VerticalAccelerationNoise float64
+
+    // Uere is the user-equivalent range error in meters. The standard
+    // deviation of a measurement is this times the `hdop` or `vdop`.
+    Uere float64
+
+    // HorizontalAccuracy and VerticalAccuracy are the standard deviations
+    // (m) used for points without an `hdop` or `vdop`.
+    HorizontalAccuracy float64
+    VerticalAccuracy   float64
+}
+
+// DefaultKalmanOptions returns values that suit pedestrian tracks recorded
+// with a phone.
+func DefaultKalmanOptions() KalmanOptions {
+    return KalmanOptions{
+        AccelerationNoise:         0.5,
+        VerticalAccelerationNoise: 0.1,
+        Uere:                      5,
+        HorizontalAccuracy:        15,
+        VerticalAccuracy:          25,
+    }
+}
+
+// mat2 is a 2x2 matrix.
+type mat2 [2][2]float64
+
+// axisState is the position and velocity along one axis, and their
+// covariance.
+type axisState struct {
+    x [2]float64
+    p mat2
+}
+
+// predict moves the state forward by `dt` seconds. `q` is the acceleration
+// noise.
+func (as axisState) predict(dt, q float64) axisState {
+    p := as.p
+
+    return axisState{
+        x: [2]float64{as.x[0] + dt*as.x[1], as.x[1]},
+        p: mat2{
+            {p[0][0] + dt*(p[1][0]+p[0][1]) + dt*dt*p[1][1] + q*dt*dt*dt/3, p[0][1] + dt*p[1][1] + q*dt*dt/2},
+            {p[1][0] + dt*p[1][1] + q*dt*dt/2, p[1][1] + q*dt},
+        },
+    }
+}
+
+// update applies a position measurement `z` with variance `r`.
+func (as axisState) update(z, r float64) axisState {
+    p := as.p
+
+    s := p[0][0] + r
+    k0 := p[0][0] / s
+    k1 := p[1][0] / s
+    y := z - as.x[0]
+
+    return axisState{
+        x: [2]float64{as.x[0] + k0*y, as.x[1] + k1*y},
+        p: mat2{
+            {(1 - k0) * p[0][0], (1 - k0) * p[0][1]},
+            {p[1][0] - k1*p[0][0], p[1][1] - k1*p[0][1]},
+        },
+    }
+}
+
+// kalmanStep is what the smoother needs to remember about each point.
+type kalmanStep struct {
+    dt float64
+
+    filtered  [axisCount]axisState
+    predicted [axisCount]axisState
+
+    // valid is true for an axis that was predicted from the previous step
+    // (i.e. had already been measured).
+    valid [axisCount]bool
+}
+
+// kalmanFilter filters the points of one segment at a time. Positions are
+// converted to meters east and north of the first point, which is accurate
+// over the distances covered by a single segment.
+type kalmanFilter struct {
+    options KalmanOptions
+
+    origin   *gpxcommon.TrackPoint
+    previous time.Time
+
+    state       [axisCount]axisState
+    initialized [axisCount]bool
+
+    // steps is only recorded when smoothing.
+    recordSteps bool
+    steps       []kalmanStep
+}
+
+func newKalmanFilter(options KalmanOptions, recordSteps bool) *kalmanFilter {
+    return &kalmanFilter{
+        options:     options,
+        recordSteps: recordSteps,
+        steps:       make([]kalmanStep, 0),
+    }
+}
+
+// reset starts a new segment.
+func (kf *kalmanFilter) reset() {
+    kf.origin = nil
+    kf.initialized = [axisCount]bool{}
+    kf.steps = kf.steps[:0]
+}
+
+func (kf *kalmanFilter) toLocal(tp *gpxcommon.TrackPoint) (east, north float64) {
+    phi0 := kf.origin.LatitudeDecimal * math.Pi / 180
+
+    east = (tp.LongitudeDecimal - kf.origin.LongitudeDecimal) * math.Pi / 180 * gpxgeo.EarthRadius * math.Cos(phi0)
+    north = (tp.LatitudeDecimal - kf.origin.LatitudeDecimal) * math.Pi / 180 * gpxgeo.EarthRadius
+
+    return east, north
+}
+
+func (kf *kalmanFilter) fromLocal(east, north float64) (latitude, longitude float64) {
+    phi0 := kf.origin.LatitudeDecimal * math.Pi / 180
+
+    latitude = kf.origin.LatitudeDecimal + north/gpxgeo.EarthRadius*180/math.Pi
+    longitude = kf.origin.LongitudeDecimal + east/(gpxgeo.EarthRadius*math.Cos(phi0))*180/math.Pi
+
+    return latitude, longitude
+}
+
+// variances returns the horizontal and vertical measurement variances for the
+// point.
+func (kf *kalmanFilter) variances(tp *gpxcommon.TrackPoint) (horizontal, vertical float64) {
+    sigma := kf.options.HorizontalAccuracy
+    if tp.Hdop > 0 {
+        sigma = kf.options.Uere * float64(tp.Hdop)
+    }
+
+    horizontal = sigma * sigma
+
+    sigma = kf.options.VerticalAccuracy
+    if tp.Vdop > 0 {
+        sigma = kf.options.Uere * float64(tp.Vdop)
+    }
+
+    vertical = sigma * sigma
+
+    return horizontal, vertical
+}
+
+// add processes the next point in the segment and returns the filtered
+// point. Points without times are returned unchanged.
+func (kf *kalmanFilter) add(tp *gpxcommon.TrackPoint) gpxcommon.TrackPoint {
+    if tp.Time.IsZero() == true {
+        return *tp
+    }
+
+    if kf.origin == nil {
+        origin := *tp
+        kf.origin = &origin
+        kf.previous = tp.Time
+    }
+
+    dt := tp.Time.Sub(kf.previous).Seconds()
+    if dt < 0 {
+        dt = 0
+    }
+
+    kf.previous = tp.Time
+
+    east, north := kf.toLocal(tp)
+    horizontal, vertical := kf.variances(tp)
+
+    measurements := [axisCount]float64{east, north, float64(tp.Elevation)}
+    variances := [axisCount]float64{horizontal, horizontal, vertical}
+    noises := [axisCount]float64{kf.options.AccelerationNoise, kf.options.AccelerationNoise, kf.options.VerticalAccelerationNoise}
+
+    step := kalmanStep{
+        dt: dt,
+    }
+
+    for axis := 0; axis < axisCount; axis++ {
+        // Points with an elevation of exactly zero don't have one.
+        measured := axis != axisUp || tp.Elevation != 0
+
+        if kf.initialized[axis] == false {
+            if measured == false {
+                continue
+            }
+
+            kf.state[axis] = axisState{
+                x: [2]float64{measurements[axis], 0},
+                p: mat2{{variances[axis], 0}, {0, initialVelocityVariance}},
+            }
+
+            kf.initialized[axis] = true
+            step.filtered[axis] = kf.state[axis]
+            step.predicted[axis] = kf.state[axis]
+
+            continue
+        }
+
+        predicted := kf.state[axis].predict(dt, noises[axis])
+
+        step.predicted[axis] = predicted
+        step.valid[axis] = true
+
+        if measured == true {
+            kf.state[axis] = predicted.update(measurements[axis], variances[axis])
+        } else {
+            kf.state[axis] = predicted
+        }
+
+        step.filtered[axis] = kf.state[axis]
+    }
+
+    if kf.recordSteps == true {
+        kf.steps = append(kf.steps, step)
+    }
+
+    return kf.point(tp, step.filtered)
+}
+
+// point returns a copy of `tp` at the given position.
+func (kf *kalmanFilter) point(tp *gpxcommon.TrackPoint, states [axisCount]axisState) gpxcommon.TrackPoint {
+    filtered := *tp
+    filtered.LatitudeDecimal, filtered.LongitudeDecimal = kf.fromLocal(states[axisEast].x[0], states[axisNorth].x[0])
+
+    if tp.Elevation != 0 {
+        filtered.Elevation = float32(states[axisUp].x[0])
+    }
+
+    return filtered
+}
+
+// smooth applies the Rauch-Tung-Striebel smoother to the filtered points,
+// which must be the result of add() for every point with a time in the
+// segment, in order.
+func (kf *kalmanFilter) smooth(original, filtered []gpxcommon.TrackPoint) {
+    if len(kf.steps) < 2 {
+        return
+    }
+
+    // The smoothed states of the following step.
+    next := kf.steps[len(kf.steps)-1].filtered
+
+    for k := len(kf.steps) - 2; k >= 0; k-- {
+        current := kf.steps[k]
+        following := kf.steps[k+1]
+
+        smoothed := current.filtered
+
+        for axis := 0; axis < axisCount; axis++ {
+            // The smoother can only look back from a step that was predicted
+            // from this one.
+            if following.valid[axis] == false {
+                continue
+            }
+
+            p := current.filtered[axis].p
+            pp := following.predicted[axis].p
+            dt := following.dt
+
+            // C = P F' inv(Pp)
+            pf := mat2{
+                {p[0][0] + dt*p[0][1], p[0][1]},
+                {p[1][0] + dt*p[1][1], p[1][1]},
+            }
+
+            det := pp[0][0]*pp[1][1] - pp[0][1]*pp[1][0]
+            if det == 0 {
+                continue
+            }
+
+            inverse := mat2{
+                {pp[1][1] / det, -pp[0][1] / det},
+                {-pp[1][0] / det, pp[0][0] / det},
+            }
+
+            c := mat2{
+                {pf[0][0]*inverse[0][0] + pf[0][1]*inverse[1][0], pf[0][0]*inverse[0][1] + pf[0][1]*inverse[1][1]},
+                {pf[1][0]*inverse[0][0] + pf[1][1]*inverse[1][0], pf[1][0]*inverse[0][1] + pf[1][1]*inverse[1][1]},
+            }
+
+            d0 := next[axis].x[0] - following.predicted[axis].x[0]
+            d1 := next[axis].x[1] - following.predicted[axis].x[1]
+
+            smoothed[axis].x[0] += c[0][0]*d0 + c[0][1]*d1
+            smoothed[axis].x[1] += c[1][0]*d0 + c[1][1]*d1
+        }
+
+        next = smoothed
+        filtered[k] = kf.point(&original[k], smoothed)
+    }
+}
+
+// timedPoints returns the points that have times, and their indices.
+func timedPoints(points []gpxcommon.TrackPoint) (timed []gpxcommon.TrackPoint, indices []int) {
+    timed = make([]gpxcommon.TrackPoint, 0, len(points))
+    indices = make([]int, 0, len(points))
+
+    for i, tp := range points {
+        if tp.Time.IsZero() == false {
+            timed = append(timed, tp)
+            indices = append(indices, i)
+        }
+    }
+
+    return timed, indices
+}
+
+// KalmanFilter returns the points of a single segment with their positions
+// and elevations estimated by a constant-velocity Kalman filter. Each
+// estimate only uses the points up to and including it. Times and all other
+// fields are preserved. Points without times are returned unchanged.
+func KalmanFilter(points []gpxcommon.TrackPoint, options KalmanOptions) []gpxcommon.TrackPoint {
+    kf := newKalmanFilter(options, false)
+
+    filtered := make([]gpxcommon.TrackPoint, len(points))
+    for i := range points {
+        filtered[i] = kf.add(&points[i])
+    }
+
+    return filtered
+}
+
+// KalmanSmooth is KalmanFilter() followed by a Rauch-Tung-Striebel smoother,
+// so that each estimate uses all of the points in the segment. This is for
+// offline use.
+func KalmanSmooth(points []gpxcommon.TrackPoint, options KalmanOptions) []gpxcommon.TrackPoint {
+    kf := newKalmanFilter(options, true)
+
+    smoothed := append([]gpxcommon.TrackPoint{}, points...)
+
+    timed, indices := timedPoints(points)
+
+    filtered := make([]gpxcommon.TrackPoint, len(timed))
+    for i := range timed {
+        filtered[i] = kf.add(&timed[i])
+    }
+
+    kf.smooth(timed, filtered)
+
+    for i, j := range indices {
+        smoothed[j] = filtered[i]
+    }
+
+    return smoothed
+}
+
+// KalmanFilterStage returns a pipeline stage that applies KalmanFilter() to
+// each segment as the points arrive.
+func KalmanFilterStage(options KalmanOptions) gpxpipe.Stage {
+    kf := newKalmanFilter(options, false)
+
+    return func(e gpxpipe.Element, emit gpxpipe.Emit) (err error) {
+        defer func() {
+            if state := recover(); state != nil {
+                err = log.Wrap(state.(error))
+            }
+        }()
+
+        switch e.Type {
+        case gpxpipe.ElementSegmentOpen:
+            kf.reset()
+        case gpxpipe.ElementPoint:
+            filtered := kf.add(e.Point)
+            e.Point = &filtered
+        }
+
+        err = emit(e)
+        log.PanicIf(err)
+
+        return nil
+    }
+}
+
+// KalmanSmoothStage returns a pipeline stage that applies KalmanSmooth() to
+// each segment. Only one segment is held in memory at a time.
+func KalmanSmoothStage(options KalmanOptions) gpxpipe.Stage {
+    st := func(points []gpxcommon.TrackPoint) ([]gpxcommon.TrackPoint, error) {
+        return KalmanSmooth(points, options), nil
+    }
+
+    return gpxpipe.Segment(st)
+}
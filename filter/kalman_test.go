@@ -0,0 +1,161 @@
+package gpxfilter
+
+import (
+    "bytes"
+    "math"
+    "math/rand"
+    "testing"
+    "time"
+
+    "github.com/dsoprea/go-logging"
+
+    "github.com/dsoprea/go-gpx"
+    "github.com/dsoprea/go-gpx/geo"
+    "github.com/dsoprea/go-gpx/pipe"
+    "github.com/dsoprea/go-gpx/reader"
+)
+
+// getKalmanTestPoints returns a walk north at a steady 1.4 m/s with one
+// reading per second, and the same readings with five meters of noise.
+func getKalmanTestPoints() (truth, noisy []gpxcommon.TrackPoint) {
+    const (
+        count        = 200
+        speed        = 1.4
+        noise        = 5.0
+        metersPerDeg = gpxgeo.EarthRadius * math.Pi / 180
+    )
+
+    r := rand.New(rand.NewSource(1))
+    epoch := time.Date(2016, 12, 2, 8, 0, 0, 0, time.UTC)
+
+    truth = make([]gpxcommon.TrackPoint, count)
+    noisy = make([]gpxcommon.TrackPoint, count)
+
+    for i := 0; i < count; i++ {
+        truth[i] = gpxcommon.TrackPoint{
+            LatitudeDecimal:  47 + float64(i)*speed/metersPerDeg,
+            LongitudeDecimal: -122,
+            Elevation:        100,
+            Time:             epoch.Add(time.Duration(i) * time.Second),
+            Src:              SourceGps,
+            Hdop:             1,
+            Vdop:             1,
+        }
+
+        noisy[i] = truth[i]
+        noisy[i].LatitudeDecimal += r.NormFloat64() * noise / metersPerDeg
+        noisy[i].LongitudeDecimal += r.NormFloat64() * noise / (metersPerDeg * math.Cos(47*math.Pi/180))
+        noisy[i].Elevation += float32(r.NormFloat64() * noise)
+    }
+
+    return truth, noisy
+}
+
+// rmsError returns the root-mean-square horizontal and vertical errors in
+// meters.
+func rmsError(truth, estimated []gpxcommon.TrackPoint) (horizontal, vertical float64) {
+    for i := range truth {
+        d := gpxgeo.HaversineDistance(&truth[i], &estimated[i])
+        horizontal += d * d
+
+        e := float64(truth[i].Elevation - estimated[i].Elevation)
+        vertical += e * e
+    }
+
+    horizontal = math.Sqrt(horizontal / float64(len(truth)))
+    vertical = math.Sqrt(vertical / float64(len(truth)))
+
+    return horizontal, vertical
+}
+
+func TestKalmanFilter(t *testing.T) {
+    truth, noisy := getKalmanTestPoints()
+
+    filtered := KalmanFilter(noisy, DefaultKalmanOptions())
+    smoothed := KalmanSmooth(noisy, DefaultKalmanOptions())
+
+    rawHorizontal, rawVertical := rmsError(truth, noisy)
+    filteredHorizontal, filteredVertical := rmsError(truth, filtered)
+    smoothedHorizontal, smoothedVertical := rmsError(truth, smoothed)
+
+    if filteredHorizontal >= rawHorizontal || filteredVertical >= rawVertical {
+        t.Fatalf("Filter did not reduce the error: (%f) (%f) -> (%f) (%f)", rawHorizontal, rawVertical, filteredHorizontal, filteredVertical)
+    } else if smoothedHorizontal >= filteredHorizontal || smoothedVertical >= filteredVertical {
+        t.Fatalf("Smoother did not reduce the error: (%f) (%f) -> (%f) (%f)", filteredHorizontal, filteredVertical, smoothedHorizontal, smoothedVertical)
+    }
+
+    for i := range noisy {
+        if filtered[i].Time.Equal(noisy[i].Time) == false || smoothed[i].Time.Equal(noisy[i].Time) == false {
+            t.Fatalf("Time (%d) not preserved.", i)
+        } else if filtered[i].Src != SourceGps || smoothed[i].Hdop != 1 {
+            t.Fatalf("Fields (%d) not preserved: %s", i, &smoothed[i])
+        }
+    }
+}
+
+func TestKalmanFilter_MissingValues(t *testing.T) {
+    _, noisy := getKalmanTestPoints()
+    noisy = noisy[:20]
+
+    // No elevation at the start, no dilution of precision, and one point
+    // without a time.
+    for i := range noisy {
+        noisy[i].Hdop = 0
+        noisy[i].Vdop = 0
+
+        if i < 5 {
+            noisy[i].Elevation = 0
+        }
+    }
+
+    noisy[10].Time = time.Time{}
+
+    smoothed := KalmanSmooth(noisy, DefaultKalmanOptions())
+
+    for i := 0; i < 5; i++ {
+        if smoothed[i].Elevation != 0 {
+            t.Fatalf("Elevation (%d) was invented: %s", i, &smoothed[i])
+        }
+    }
+
+    if smoothed[10] != noisy[10] {
+        t.Fatalf("Point without a time was changed: %s", &smoothed[10])
+    }
+
+    for i := 5; i < len(smoothed); i++ {
+        if i != 10 && math.Abs(float64(smoothed[i].Elevation)-100) > 25 {
+            t.Fatalf("Elevation (%d) not estimated: %s", i, &smoothed[i])
+        }
+    }
+}
+
+func TestKalmanFilterStage(t *testing.T) {
+    original, err := gpxreader.ExtractTrackPoints(bytes.NewBufferString(gpxreader.TestGpxData))
+    log.PanicIf(err)
+
+    for _, stage := range []gpxpipe.Stage{KalmanFilterStage(DefaultKalmanOptions()), KalmanSmoothStage(DefaultKalmanOptions())} {
+        p := gpxpipe.NewPipeline(stage)
+
+        points := make([]gpxcommon.TrackPoint, 0)
+        sink := func(e gpxpipe.Element) error {
+            if e.Type == gpxpipe.ElementPoint {
+                points = append(points, *e.Point)
+            }
+
+            return nil
+        }
+
+        err := p.Enumerate(bytes.NewBufferString(gpxreader.TestGpxData), sink)
+        log.PanicIf(err)
+
+        if len(points) != len(original) {
+            t.Fatalf("Point count not correct: (%d)", len(points))
+        }
+
+        for i := range points {
+            if points[i].Time.Equal(original[i].Time) == false {
+                t.Fatalf("Time (%d) not preserved: %s", i, &points[i])
+            }
+        }
+    }
+}
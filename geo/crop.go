@@ -0,0 +1,190 @@
+package gpxgeo
+
+import (
+    "io"
+    "time"
+
+    "github.com/dsoprea/go-logging"
+
+    "github.com/dsoprea/go-gpx"
+    "github.com/dsoprea/go-gpx/pipe"
+    "github.com/dsoprea/go-gpx/writer"
+)
+
+// CropTimeStage returns a pipeline stage that only passes the points from
+// `from` to `to` (inclusive). Points without times are dropped. If
+// `interpolate` is true, points are inserted at the edges of the window
+// wherever consecutive points in a segment cross them, so the cropped track
+// starts and ends exactly at the window. Waypoints with times outside of the
+// window are dropped, but those without times are kept.
+func CropTimeStage(from, to time.Time, interpolate bool) gpxpipe.Stage {
+    var previous *gpxcommon.TrackPoint
+
+    crosses := func(a, b *gpxcommon.TrackPoint, t time.Time) bool {
+        return a.Time.Before(t) == true && b.Time.After(t) == true
+    }
+
+    return func(e gpxpipe.Element, emit gpxpipe.Emit) (err error) {
+        defer func() {
+            if state := recover(); state != nil {
+                err = log.Wrap(state.(error))
+            }
+        }()
+
+        switch e.Type {
+        case gpxpipe.ElementSegmentOpen:
+            previous = nil
+        case gpxpipe.ElementPoint:
+            current := e.Point
+
+            if current.Time.IsZero() == true {
+                return nil
+            }
+
+            if interpolate == true && previous != nil {
+                for _, edge := range []time.Time{from, to} {
+                    if crosses(previous, current, edge) == false {
+                        continue
+                    }
+
+                    tp, err := interpolateAt(previous, current, edge, 0)
+                    log.PanicIf(err)
+
+                    err = emit(gpxpipe.Element{Type: gpxpipe.ElementPoint, Point: &tp})
+                    log.PanicIf(err)
+                }
+            }
+
+            copied := *current
+            previous = &copied
+
+            if current.Time.Before(from) == true || current.Time.After(to) == true {
+                return nil
+            }
+        case gpxpipe.ElementWaypoint:
+            t := e.Waypoint.Time
+
+            if t.IsZero() == false && (t.Before(from) == true || t.After(to) == true) {
+                return nil
+            }
+        }
+
+        err = emit(e)
+        log.PanicIf(err)
+
+        return nil
+    }
+}
+
+// CropRegionStage returns a pipeline stage that only passes the points within
+// the region. If a segment leaves the region and comes back, the points after
+// it comes back are put in a new segment. Waypoints outside of the region are
+// dropped.
+func CropRegionStage(region Region) gpxpipe.Stage {
+    emitted := false
+    left := false
+
+    return func(e gpxpipe.Element, emit gpxpipe.Emit) (err error) {
+        defer func() {
+            if state := recover(); state != nil {
+                err = log.Wrap(state.(error))
+            }
+        }()
+
+        switch e.Type {
+        case gpxpipe.ElementSegmentOpen:
+            emitted = false
+            left = false
+        case gpxpipe.ElementPoint:
+            if region.Contains(e.Point) == false {
+                if emitted == true {
+                    left = true
+                }
+
+                return nil
+            }
+
+            if left == true {
+                err := emit(gpxpipe.Element{Type: gpxpipe.ElementSegmentClose, Segment: new(gpxcommon.TrackSegment)})
+                log.PanicIf(err)
+
+                err = emit(gpxpipe.Element{Type: gpxpipe.ElementSegmentOpen, Segment: new(gpxcommon.TrackSegment)})
+                log.PanicIf(err)
+
+                left = false
+            }
+
+            emitted = true
+        case gpxpipe.ElementWaypoint:
+            position := waypointPosition(e.Waypoint)
+
+            if region.Contains(&position) == false {
+                return nil
+            }
+        }
+
+        err = emit(e)
+        log.PanicIf(err)
+
+        return nil
+    }
+}
+
+// waypointPosition returns a point at the position of the waypoint.
+func waypointPosition(w *gpxcommon.Waypoint) gpxcommon.TrackPoint {
+    return gpxcommon.TrackPoint{
+        LatitudeDecimal:  w.LatitudeDecimal,
+        LongitudeDecimal: w.LongitudeDecimal,
+        Elevation:        w.Elevation,
+        Time:             w.Time,
+    }
+}
+
+// crop streams the GPX data to the builder through the stage, dropping any
+// segments and tracks that end up empty.
+func crop(r io.Reader, b *gpxwriter.Builder, stage gpxpipe.Stage) (err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    p := gpxpipe.NewPipeline(stage, gpxpipe.DropEmpty())
+
+    err = p.Write(r, b)
+    log.PanicIf(err)
+
+    return nil
+}
+
+// CropTime writes the part of the GPX data from `from` to `to` to the builder.
+// The metadata, tracks, and segments are kept, except for the segments and
+// tracks that have no points in the window. The document is closed when
+// done.
+func CropTime(r io.Reader, b *gpxwriter.Builder, from, to time.Time, interpolate bool) (err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    err = crop(r, b, CropTimeStage(from, to, interpolate))
+    log.PanicIf(err)
+
+    return nil
+}
+
+// CropRegion writes the part of the GPX data within the region (e.g. a
+// Rectangle or a Polygon) to the builder, the same way as CropTime.
+func CropRegion(r io.Reader, b *gpxwriter.Builder, region Region) (err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    err = crop(r, b, CropRegionStage(region))
+    log.PanicIf(err)
+
+    return nil
+}
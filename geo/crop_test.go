@@ -0,0 +1,191 @@
+package gpxgeo
+
+import (
+    "bytes"
+    "math"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/dsoprea/go-logging"
+
+    "github.com/dsoprea/go-gpx"
+    "github.com/dsoprea/go-gpx/pipe"
+    "github.com/dsoprea/go-gpx/writer"
+)
+
+// The first track wanders out of the square (10..11, 10..11) and back. The
+// second track is entirely after the window used for the time tests. Only the
+// last waypoint is outside of the square and after the window.
+const testCropGpxData = `<?xml version="1.0" encoding="UTF-8" ?><gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1">
+<metadata><name>Trip</name></metadata>
+<wpt lat="10.5" lon="10.5"><time>2016-12-02T08:10:00Z</time><name>Timed</name></wpt>
+<wpt lat="10.6" lon="10.6"><name>Untimed</name></wpt>
+<wpt lat="14" lon="10.5"><time>2016-12-02T10:00:00Z</time><name>Late</name></wpt>
+<trk><name>First</name><trkseg>
+<trkpt lat="10.1" lon="10.5"><time>2016-12-02T08:00:00Z</time></trkpt>
+<trkpt lat="10.2" lon="10.5"><time>2016-12-02T08:10:00Z</time></trkpt>
+<trkpt lat="10.2" lon="11.5"><time>2016-12-02T08:20:00Z</time></trkpt>
+<trkpt lat="10.3" lon="10.5"><time>2016-12-02T08:30:00Z</time></trkpt>
+<trkpt lat="10.4" lon="10.5"><time>2016-12-02T08:40:00Z</time></trkpt>
+</trkseg></trk>
+<trk><name>Second</name><trkseg>
+<trkpt lat="12.1" lon="10.5"><time>2016-12-02T10:00:00Z</time></trkpt>
+<trkpt lat="12.2" lon="10.5"><time>2016-12-02T10:10:00Z</time></trkpt>
+</trkseg></trk>
+</gpx>`
+
+func testCropTime(hour, minute int) time.Time {
+    return time.Date(2016, 12, 2, hour, minute, 0, 0, time.UTC)
+}
+
+func enumerateCrop(stage gpxpipe.Stage) (types []gpxpipe.ElementType, points []gpxcommon.TrackPoint) {
+    p := gpxpipe.NewPipeline(stage)
+
+    types = make([]gpxpipe.ElementType, 0)
+    points = make([]gpxcommon.TrackPoint, 0)
+
+    sink := func(e gpxpipe.Element) error {
+        types = append(types, e.Type)
+
+        if e.Type == gpxpipe.ElementPoint {
+            points = append(points, *e.Point)
+        }
+
+        return nil
+    }
+
+    err := p.Enumerate(bytes.NewBufferString(testCropGpxData), sink)
+    log.PanicIf(err)
+
+    return types, points
+}
+
+func TestCropTimeStage(t *testing.T) {
+    _, points := enumerateCrop(CropTimeStage(testCropTime(8, 5), testCropTime(8, 20), false))
+
+    if len(points) != 2 {
+        t.Fatalf("Point count not correct: %v", points)
+    } else if points[0].Time.Equal(testCropTime(8, 10)) == false || points[1].Time.Equal(testCropTime(8, 20)) == false {
+        t.Fatalf("Points not correct: %v", points)
+    }
+}
+
+func TestCropTimeStage_Interpolate(t *testing.T) {
+    _, points := enumerateCrop(CropTimeStage(testCropTime(8, 5), testCropTime(8, 15), true))
+
+    if len(points) != 3 {
+        t.Fatalf("Point count not correct: %v", points)
+    } else if points[0].Time.Equal(testCropTime(8, 5)) == false || points[2].Time.Equal(testCropTime(8, 15)) == false {
+        t.Fatalf("Edges not correct: %v", points)
+    } else if math.Abs(points[0].LatitudeDecimal-10.15) > 1e-6 {
+        t.Fatalf("Start position not correct: %s", &points[0])
+    }
+
+    // Both edges are between the same two points.
+
+    _, points = enumerateCrop(CropTimeStage(testCropTime(8, 1), testCropTime(8, 2), true))
+
+    if len(points) != 2 || points[0].Time.Equal(testCropTime(8, 1)) == false || points[1].Time.Equal(testCropTime(8, 2)) == false {
+        t.Fatalf("Points not correct: %v", points)
+    }
+}
+
+func TestCropRegionStage(t *testing.T) {
+    region := Rectangle{
+        MinLatitude:  10,
+        MinLongitude: 10,
+        MaxLatitude:  11,
+        MaxLongitude: 11,
+    }
+
+    types, points := enumerateCrop(CropRegionStage(region))
+
+    if len(points) != 4 {
+        t.Fatalf("Point count not correct: %v", points)
+    }
+
+    segments := 0
+    for _, et := range types {
+        if et == gpxpipe.ElementSegmentOpen {
+            segments++
+        }
+    }
+
+    // The first segment is split where it comes back into the region. The
+    // second track is still passed (empty) by the stage itself.
+    if segments != 3 {
+        t.Fatalf("Segment count not correct: (%d) %v", segments, types)
+    }
+}
+
+func TestCropTime(t *testing.T) {
+    output := new(bytes.Buffer)
+
+    b, err := gpxwriter.NewBuilder(output)
+    log.PanicIf(err)
+
+    err = CropTime(bytes.NewBufferString(testCropGpxData), b, testCropTime(8, 5), testCropTime(8, 15), true)
+    log.PanicIf(err)
+
+    s := output.String()
+
+    if strings.Contains(s, "<name>Trip</name>") == false || strings.Contains(s, "<name>First</name>") == false {
+        t.Fatalf("Metadata or track name not kept:\n%s", s)
+    } else if strings.Contains(s, "<name>Second</name>") == true {
+        t.Fatalf("Empty track not dropped:\n%s", s)
+    } else if count := strings.Count(s, "<trkpt "); count != 3 {
+        t.Fatalf("Point count not correct: (%d)\n%s", count, s)
+    }
+
+    assertCroppedWaypoints(t, s)
+}
+
+// assertCroppedWaypoints fails unless only the last test waypoint was
+// dropped.
+func assertCroppedWaypoints(t *testing.T, s string) {
+    if strings.Contains(s, "<name>Timed</name>") == false || strings.Contains(s, "<name>Untimed</name>") == false {
+        t.Fatalf("Waypoints not kept:\n%s", s)
+    } else if strings.Contains(s, "<name>Late</name>") == true {
+        t.Fatalf("Waypoint not dropped:\n%s", s)
+    }
+}
+
+func TestCropRegion(t *testing.T) {
+    polygon := &Polygon{
+        Exterior: []gpxcommon.TrackPoint{
+            {LatitudeDecimal: 10, LongitudeDecimal: 10},
+            {LatitudeDecimal: 13, LongitudeDecimal: 10},
+            {LatitudeDecimal: 13, LongitudeDecimal: 11},
+            {LatitudeDecimal: 10, LongitudeDecimal: 11},
+        },
+        Holes: [][]gpxcommon.TrackPoint{
+            {
+                {LatitudeDecimal: 12, LongitudeDecimal: 10.4},
+                {LatitudeDecimal: 12.15, LongitudeDecimal: 10.4},
+                {LatitudeDecimal: 12.15, LongitudeDecimal: 10.6},
+                {LatitudeDecimal: 12, LongitudeDecimal: 10.6},
+            },
+        },
+    }
+
+    output := new(bytes.Buffer)
+
+    b, err := gpxwriter.NewBuilder(output)
+    log.PanicIf(err)
+
+    err = CropRegion(bytes.NewBufferString(testCropGpxData), b, polygon)
+    log.PanicIf(err)
+
+    s := output.String()
+
+    if count := strings.Count(s, "<trk>"); count != 2 {
+        t.Fatalf("Track count not correct: (%d)\n%s", count, s)
+    } else if count := strings.Count(s, "<trkseg>"); count != 3 {
+        t.Fatalf("Segment count not correct: (%d)\n%s", count, s)
+    } else if count := strings.Count(s, "<trkpt "); count != 5 {
+        t.Fatalf("Point count not correct: (%d)\n%s", count, s)
+    }
+
+    assertCroppedWaypoints(t, s)
+}
@@ -0,0 +1,239 @@
+package gpxgeo
+
+import (
+    "fmt"
+    "math"
+
+    "github.com/dsoprea/go-gpx"
+)
+
+var (
+    ErrNoConvergence = fmt.Errorf("geodesic did not converge (points are nearly antipodal)")
+)
+
+const (
+    // EarthRadius is the mean radius of the earth in meters, used by the
+    // spherical formulas.
+    EarthRadius = 6371008.8
+
+    // WGS84SemiMajorAxis is the equatorial radius of the WGS84 ellipsoid in
+    // meters.
+    WGS84SemiMajorAxis = 6378137.0
+
+    // WGS84Flattening is the flattening of the WGS84 ellipsoid.
+    WGS84Flattening = 1 / 298.257223563
+
+    // WGS84SemiMinorAxis is the polar radius of the WGS84 ellipsoid in meters.
+    WGS84SemiMinorAxis = WGS84SemiMajorAxis * (1 - WGS84Flattening)
+)
+
+const (
+    vincentyMaxIterations = 200
+    vincentyTolerance     = 1e-12
+)
+
+// DistanceFunc returns the distance between two points in meters.
+type DistanceFunc func(a, b *gpxcommon.TrackPoint) float64
+
+func toRadians(degrees float64) float64 {
+    return degrees * math.Pi / 180
+}
+
+func toDegrees(radians float64) float64 {
+    return radians * 180 / math.Pi
+}
+
+// normalizeBearing maps a bearing in degrees to [0, 360).
+func normalizeBearing(degrees float64) float64 {
+    degrees = math.Mod(degrees, 360)
+    if degrees < 0 {
+        degrees += 360
+    }
+
+    return degrees
+}
+
+// HaversineDistance returns the great-circle distance between the two points
+// in meters, treating the earth as a sphere. This is faster than the
+// ellipsoidal calculation but can be off by up to about 0.5%.
+func HaversineDistance(a, b *gpxcommon.TrackPoint) float64 {
+    phi1 := toRadians(a.LatitudeDecimal)
+    phi2 := toRadians(b.LatitudeDecimal)
+    deltaPhi := phi2 - phi1
+    deltaLambda := toRadians(b.LongitudeDecimal - a.LongitudeDecimal)
+
+    h := math.Sin(deltaPhi/2)*math.Sin(deltaPhi/2) + math.Cos(phi1)*math.Cos(phi2)*math.Sin(deltaLambda/2)*math.Sin(deltaLambda/2)
+
+    return 2 * EarthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// SphericalInitialBearing returns the great-circle bearing in degrees
+// (clockwise from north) at which you leave `a` in order to get to `b`.
+func SphericalInitialBearing(a, b *gpxcommon.TrackPoint) float64 {
+    phi1 := toRadians(a.LatitudeDecimal)
+    phi2 := toRadians(b.LatitudeDecimal)
+    deltaLambda := toRadians(b.LongitudeDecimal - a.LongitudeDecimal)
+
+    y := math.Sin(deltaLambda) * math.Cos(phi2)
+    x := math.Cos(phi1)*math.Sin(phi2) - math.Sin(phi1)*math.Cos(phi2)*math.Cos(deltaLambda)
+
+    return normalizeBearing(toDegrees(math.Atan2(y, x)))
+}
+
+// SphericalFinalBearing returns the great-circle bearing in degrees at which
+// you arrive at `b` when coming from `a`.
+func SphericalFinalBearing(a, b *gpxcommon.TrackPoint) float64 {
+    return normalizeBearing(SphericalInitialBearing(b, a) + 180)
+}
+
+// SphericalDestination returns the point reached by traveling `distance`
+// meters along the great circle that leaves `a` at `bearing` degrees. Only
+// the position is set.
+func SphericalDestination(a *gpxcommon.TrackPoint, bearing, distance float64) gpxcommon.TrackPoint {
+    phi1 := toRadians(a.LatitudeDecimal)
+    lambda1 := toRadians(a.LongitudeDecimal)
+    theta := toRadians(bearing)
+    delta := distance / EarthRadius
+
+    phi2 := math.Asin(math.Sin(phi1)*math.Cos(delta) + math.Cos(phi1)*math.Sin(delta)*math.Cos(theta))
+    lambda2 := lambda1 + math.Atan2(math.Sin(theta)*math.Sin(delta)*math.Cos(phi1), math.Cos(delta)-math.Sin(phi1)*math.Sin(phi2))
+
+    return gpxcommon.TrackPoint{
+        LatitudeDecimal:  toDegrees(phi2),
+        LongitudeDecimal: math.Mod(toDegrees(lambda2)+540, 360) - 180,
+    }
+}
+
+// Geodesic describes the shortest path between two points on the ellipsoid.
+type Geodesic struct {
+    // Distance is in meters.
+    Distance float64
+
+    // InitialBearing and FinalBearing are in degrees clockwise from north.
+    InitialBearing float64
+    FinalBearing   float64
+}
+
+func (g Geodesic) String() string {
+    return fmt.Sprintf("Geodesic<DIST=(%.3f) INITIAL=(%.6f) FINAL=(%.6f)>", g.Distance, g.InitialBearing, g.FinalBearing)
+}
+
+// VincentyInverse solves the inverse geodesic problem on the WGS84 ellipsoid
+// using Vincenty's iterative formulae, which are accurate to within a
+// millimeter. ErrNoConvergence is returned for nearly-antipodal points (within
+// about half of a degree of each other's antipode).
+func VincentyInverse(a, b *gpxcommon.TrackPoint) (g Geodesic, err error) {
+    const (
+        f = WGS84Flattening
+    )
+
+    L := toRadians(b.LongitudeDecimal - a.LongitudeDecimal)
+
+    // Reduced latitudes.
+    U1 := math.Atan((1 - f) * math.Tan(toRadians(a.LatitudeDecimal)))
+    U2 := math.Atan((1 - f) * math.Tan(toRadians(b.LatitudeDecimal)))
+
+    sinU1, cosU1 := math.Sin(U1), math.Cos(U1)
+    sinU2, cosU2 := math.Sin(U2), math.Cos(U2)
+
+    lambda := L
+
+    var sinLambda, cosLambda, sinSigma, cosSigma, sigma, cosSqAlpha, cos2SigmaM float64
+
+    converged := false
+    for i := 0; i < vincentyMaxIterations; i++ {
+        sinLambda, cosLambda = math.Sin(lambda), math.Cos(lambda)
+
+        sinSigma = math.Sqrt((cosU2*sinLambda)*(cosU2*sinLambda) + (cosU1*sinU2-sinU1*cosU2*cosLambda)*(cosU1*sinU2-sinU1*cosU2*cosLambda))
+
+        // Coincident points.
+        if sinSigma == 0 {
+            return Geodesic{}, nil
+        }
+
+        cosSigma = sinU1*sinU2 + cosU1*cosU2*cosLambda
+        sigma = math.Atan2(sinSigma, cosSigma)
+
+        sinAlpha := cosU1 * cosU2 * sinLambda / sinSigma
+        cosSqAlpha = 1 - sinAlpha*sinAlpha
+
+        // Both points are on the equator.
+        if cosSqAlpha != 0 {
+            cos2SigmaM = cosSigma - 2*sinU1*sinU2/cosSqAlpha
+        } else {
+            cos2SigmaM = 0
+        }
+
+        C := f / 16 * cosSqAlpha * (4 + f*(4-3*cosSqAlpha))
+
+        previous := lambda
+        lambda = L + (1-C)*f*sinAlpha*(sigma+C*sinSigma*(cos2SigmaM+C*cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)))
+
+        if math.Abs(lambda-previous) < vincentyTolerance {
+            converged = true
+            break
+        }
+    }
+
+    if converged == false {
+        return Geodesic{}, ErrNoConvergence
+    }
+
+    aa := WGS84SemiMajorAxis
+    bb := WGS84SemiMinorAxis
+
+    uSq := cosSqAlpha * (aa*aa - bb*bb) / (bb * bb)
+    A := 1 + uSq/16384*(4096+uSq*(-768+uSq*(320-175*uSq)))
+    B := uSq / 1024 * (256 + uSq*(-128+uSq*(74-47*uSq)))
+
+    deltaSigma := B * sinSigma * (cos2SigmaM + B/4*(cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)-B/6*cos2SigmaM*(-3+4*sinSigma*sinSigma)*(-3+4*cos2SigmaM*cos2SigmaM)))
+
+    alpha1 := math.Atan2(cosU2*sinLambda, cosU1*sinU2-sinU1*cosU2*cosLambda)
+    alpha2 := math.Atan2(cosU1*sinLambda, -sinU1*cosU2+cosU1*sinU2*cosLambda)
+
+    g = Geodesic{
+        Distance:       bb * A * (sigma - deltaSigma),
+        InitialBearing: normalizeBearing(toDegrees(alpha1)),
+        FinalBearing:   normalizeBearing(toDegrees(alpha2)),
+    }
+
+    return g, nil
+}
+
+// Distance returns the ellipsoidal distance between the two points in meters.
+// If the ellipsoidal calculation does not converge (only for nearly-antipodal
+// points), this silently switches to the great-circle distance on a sphere
+// (HaversineDistance()), which can be off by up to about 0.5%. Call
+// VincentyInverse() directly to detect this.
+func Distance(a, b *gpxcommon.TrackPoint) float64 {
+    g, err := VincentyInverse(a, b)
+    if err != nil {
+        return HaversineDistance(a, b)
+    }
+
+    return g.Distance
+}
+
+// InitialBearing returns the ellipsoidal bearing at `a` toward `b`. For
+// nearly-antipodal points it switches to the great-circle bearing as with
+// Distance().
+func InitialBearing(a, b *gpxcommon.TrackPoint) float64 {
+    g, err := VincentyInverse(a, b)
+    if err != nil {
+        return SphericalInitialBearing(a, b)
+    }
+
+    return g.InitialBearing
+}
+
+// FinalBearing returns the ellipsoidal bearing on arrival at `b`. For
+// nearly-antipodal points it switches to the great-circle bearing as with
+// Distance().
+func FinalBearing(a, b *gpxcommon.TrackPoint) float64 {
+    g, err := VincentyInverse(a, b)
+    if err != nil {
+        return SphericalFinalBearing(a, b)
+    }
+
+    return g.FinalBearing
+}
@@ -0,0 +1,150 @@
+package gpxgeo
+
+import (
+    "math"
+    "testing"
+
+    "github.com/dsoprea/go-logging"
+
+    "github.com/dsoprea/go-gpx"
+)
+
+// dmsToDecimal converts degrees, minutes, and seconds to decimal degrees.
+func dmsToDecimal(degrees, minutes, seconds float64) float64 {
+    decimal := math.Abs(degrees) + minutes/60 + seconds/3600
+
+    if degrees < 0 {
+        return -decimal
+    }
+
+    return decimal
+}
+
+// Vincenty's own example from Geoscience Australia: Flinders Peak to
+// Buninyong.
+var (
+    flindersPeak = gpxcommon.TrackPoint{
+        LatitudeDecimal:  dmsToDecimal(-37, 57, 3.72030),
+        LongitudeDecimal: dmsToDecimal(144, 25, 29.52440),
+    }
+
+    buninyong = gpxcommon.TrackPoint{
+        LatitudeDecimal:  dmsToDecimal(-37, 39, 10.15610),
+        LongitudeDecimal: dmsToDecimal(143, 55, 35.38390),
+    }
+)
+
+func TestHaversineDistance(t *testing.T) {
+    // The Rosetta Code reference (Nashville to Los Angeles) is 2887.2599506 km
+    // with a radius of 6372.8 km. Scale it to our radius.
+    nashville := &gpxcommon.TrackPoint{LatitudeDecimal: 36.12, LongitudeDecimal: -86.67}
+    losAngeles := &gpxcommon.TrackPoint{LatitudeDecimal: 33.94, LongitudeDecimal: -118.40}
+
+    expected := 2887259.9506071106 * EarthRadius / 6372800
+
+    actual := HaversineDistance(nashville, losAngeles)
+    if math.Abs(actual-expected) > 1e-6 {
+        t.Fatalf("Distance not correct: (%.9f) != (%.9f)", actual, expected)
+    }
+}
+
+func TestSphericalBearings(t *testing.T) {
+    a := &gpxcommon.TrackPoint{LatitudeDecimal: 0, LongitudeDecimal: 0}
+    b := &gpxcommon.TrackPoint{LatitudeDecimal: 0, LongitudeDecimal: 1}
+
+    if initial := SphericalInitialBearing(a, b); math.Abs(initial-90) > 1e-9 {
+        t.Fatalf("Initial bearing not correct: (%.9f)", initial)
+    } else if final := SphericalFinalBearing(b, a); math.Abs(final-270) > 1e-9 {
+        t.Fatalf("Final bearing not correct: (%.9f)", final)
+    }
+}
+
+func TestSphericalDestination(t *testing.T) {
+    nashville := &gpxcommon.TrackPoint{LatitudeDecimal: 36.12, LongitudeDecimal: -86.67}
+    losAngeles := &gpxcommon.TrackPoint{LatitudeDecimal: 33.94, LongitudeDecimal: -118.40}
+
+    tp := SphericalDestination(nashville, SphericalInitialBearing(nashville, losAngeles), HaversineDistance(nashville, losAngeles))
+
+    if math.Abs(tp.LatitudeDecimal-losAngeles.LatitudeDecimal) > 1e-9 || math.Abs(tp.LongitudeDecimal-losAngeles.LongitudeDecimal) > 1e-9 {
+        t.Fatalf("Destination not correct: %s", &tp)
+    }
+
+    // Crossing the antimeridian.
+
+    a := &gpxcommon.TrackPoint{LatitudeDecimal: 0, LongitudeDecimal: 179.5}
+
+    tp = SphericalDestination(a, 90, toRadians(1)*EarthRadius)
+    if math.Abs(tp.LatitudeDecimal) > 1e-9 || math.Abs(tp.LongitudeDecimal+179.5) > 1e-9 {
+        t.Fatalf("Destination across the antimeridian not correct: %s", &tp)
+    }
+}
+
+func TestVincentyInverse(t *testing.T) {
+    g, err := VincentyInverse(&flindersPeak, &buninyong)
+    log.PanicIf(err)
+
+    // Published: 54972.271 m, azimuth 306°52'05.37", reverse azimuth
+    // 127°10'25.07" (so a final bearing of 307°10'25.07").
+    if math.Abs(g.Distance-54972.271) > 0.001 {
+        t.Fatalf("Distance not correct: %s", g)
+    } else if math.Abs(g.InitialBearing-dmsToDecimal(306, 52, 5.37)) > 0.01/3600 {
+        t.Fatalf("Initial bearing not correct: %s", g)
+    } else if math.Abs(g.FinalBearing-dmsToDecimal(307, 10, 25.07)) > 0.01/3600 {
+        t.Fatalf("Final bearing not correct: %s", g)
+    }
+}
+
+func TestVincentyInverse_QuarterMeridian(t *testing.T) {
+    equator := &gpxcommon.TrackPoint{LatitudeDecimal: 0, LongitudeDecimal: 0}
+    pole := &gpxcommon.TrackPoint{LatitudeDecimal: 90, LongitudeDecimal: 0}
+
+    g, err := VincentyInverse(equator, pole)
+    log.PanicIf(err)
+
+    // The WGS84 quarter meridian is 10001965.729 m.
+    if math.Abs(g.Distance-10001965.729) > 0.001 {
+        t.Fatalf("Distance not correct: %s", g)
+    }
+}
+
+func TestVincentyInverse_Coincident(t *testing.T) {
+    g, err := VincentyInverse(&flindersPeak, &flindersPeak)
+    log.PanicIf(err)
+
+    if g.Distance != 0 {
+        t.Fatalf("Distance not zero: %s", g)
+    }
+}
+
+func TestVincentyInverse_Antipodal(t *testing.T) {
+    a := &gpxcommon.TrackPoint{LatitudeDecimal: 0, LongitudeDecimal: 0}
+    b := &gpxcommon.TrackPoint{LatitudeDecimal: 0.5, LongitudeDecimal: 179.7}
+
+    _, err := VincentyInverse(a, b)
+    if err != ErrNoConvergence {
+        t.Fatalf("Expected no convergence: %v", err)
+    }
+
+    // Distance() and the bearings switch to the sphere.
+    if Distance(a, b) != HaversineDistance(a, b) {
+        t.Fatalf("Distance did not fall back.")
+    } else if InitialBearing(a, b) != SphericalInitialBearing(a, b) || FinalBearing(a, b) != SphericalFinalBearing(a, b) {
+        t.Fatalf("Bearings did not fall back.")
+    }
+
+    // The shortest path between nearly-antipodal points runs close to a
+    // meridian, so it is a little shorter than half of one (20,003,931.459
+    // meters on the ellipsoid). The sphere stays within 0.5% of that.
+    const halfMeridian = 20003931.459
+
+    if distance := Distance(a, b); distance > halfMeridian || distance < halfMeridian*0.995 {
+        t.Fatalf("Fallback distance not within bounds: (%.3f)", distance)
+    }
+}
+
+func TestDistance(t *testing.T) {
+    actual := Distance(&flindersPeak, &buninyong)
+    if math.Abs(actual-54972.271) > 0.001 {
+        t.Fatalf("Distance not correct: (%.6f)", actual)
+    }
+}
@@ -0,0 +1,326 @@
+package gpxgeo
+
+import (
+    "fmt"
+    "io"
+
+    "github.com/dsoprea/go-logging"
+
+    "github.com/dsoprea/go-gpx"
+    "github.com/dsoprea/go-gpx/reader"
+)
+
+// ElevationMethod is how noise is removed before climbs and drops are summed.
+type ElevationMethod int
+
+const (
+    // ElevationRaw sums every change between consecutive elevations.
+    ElevationRaw ElevationMethod = iota
+
+    // ElevationHysteresis only counts a change once the elevation has moved
+    // at least HysteresisThreshold away from where the last counted change
+    // ended.
+    ElevationHysteresis
+
+    // ElevationMovingAverage sums the changes of the trailing average of the
+    // last MovingAverageWindow elevations.
+    ElevationMovingAverage
+
+    // ElevationKalman sums the changes of a one-dimensional Kalman filter
+    // whose process noise grows with the horizontal distance traveled.
+    ElevationKalman
+)
+
+func (em ElevationMethod) String() string {
+    switch em {
+    case ElevationRaw:
+        return "Raw"
+    case ElevationHysteresis:
+        return "Hysteresis"
+    case ElevationMovingAverage:
+        return "MovingAverage"
+    case ElevationKalman:
+        return "Kalman"
+    }
+
+    return fmt.Sprintf("ElevationMethod<%d>", int(em))
+}
+
+// ElevationOptions controls how elevations are smoothed. Only the fields for
+// the selected method are used.
+type ElevationOptions struct {
+    Method ElevationMethod
+
+    // HysteresisThreshold is in meters.
+    HysteresisThreshold float64
+
+    // MovingAverageWindow is a number of points.
+    MovingAverageWindow int
+
+    // KalmanProcessNoise is the variance (m^2) that the true elevation gains
+    // per meter of horizontal distance. KalmanMeasurementNoise is the
+    // variance (m^2) of the recorded elevations.
+    KalmanProcessNoise     float64
+    KalmanMeasurementNoise float64
+
+    // DistanceFunc defaults to Distance if not set.
+    DistanceFunc DistanceFunc
+}
+
+// DefaultElevationOptions returns hysteresis smoothing with a threshold that
+// suits GPS-derived elevations, along with reasonable values for the other
+// methods.
+func DefaultElevationOptions() ElevationOptions {
+    return ElevationOptions{
+        Method:                 ElevationHysteresis,
+        HysteresisThreshold:    5,
+        MovingAverageWindow:    5,
+        KalmanProcessNoise:     0.05,
+        KalmanMeasurementNoise: 25,
+        DistanceFunc:           Distance,
+    }
+}
+
+// ProfilePoint is one point on an elevation profile. Distance is the distance
+// traveled from the first point in meters.
+type ProfilePoint struct {
+    Distance  float64
+    Elevation float64
+}
+
+func (pp ProfilePoint) String() string {
+    return fmt.Sprintf("ProfilePoint<DIST=(%.3f) ELE=(%.3f)>", pp.Distance, pp.Elevation)
+}
+
+// elevationProcessor smooths elevations and accumulates the ascent and
+// descent. Smoothing restarts with every segment but the distance and the
+// totals carry over. Points with an elevation of exactly zero are assumed to
+// not have one.
+type elevationProcessor struct {
+    options ElevationOptions
+
+    Ascent   float64
+    Descent  float64
+    Distance float64
+
+    previous *gpxcommon.TrackPoint
+
+    // distanceSinceElevation is how far we have gone since the last point
+    // with an elevation.
+    distanceSinceElevation float64
+
+    hasLast bool
+    last    float64
+
+    // reference is where the last counted hysteresis change ended.
+    reference float64
+
+    window    []float64
+    windowSum float64
+
+    estimate float64
+    variance float64
+}
+
+func newElevationProcessor(options ElevationOptions) *elevationProcessor {
+    if options.DistanceFunc == nil {
+        options.DistanceFunc = Distance
+    }
+
+    if options.MovingAverageWindow < 1 {
+        options.MovingAverageWindow = 1
+    }
+
+    return &elevationProcessor{
+        options: options,
+        window:  make([]float64, 0, options.MovingAverageWindow),
+    }
+}
+
+// resetSegment starts a new segment.
+func (ep *elevationProcessor) resetSegment() {
+    ep.previous = nil
+    ep.distanceSinceElevation = 0
+    ep.hasLast = false
+    ep.window = ep.window[:0]
+    ep.windowSum = 0
+}
+
+// add processes the next point and returns its smoothed elevation, if it has
+// an elevation.
+func (ep *elevationProcessor) add(tp *gpxcommon.TrackPoint) (smoothed float64, ok bool) {
+    current := *tp
+
+    if ep.previous != nil {
+        distance := ep.options.DistanceFunc(ep.previous, &current)
+
+        ep.Distance += distance
+        ep.distanceSinceElevation += distance
+    }
+
+    ep.previous = &current
+
+    if current.Elevation == 0 {
+        return 0, false
+    }
+
+    raw := float64(current.Elevation)
+
+    switch ep.options.Method {
+    case ElevationHysteresis:
+        smoothed = raw
+
+        if ep.hasLast == false {
+            ep.reference = raw
+        } else if raw-ep.reference >= ep.options.HysteresisThreshold {
+            ep.Ascent += raw - ep.reference
+            ep.reference = raw
+        } else if ep.reference-raw >= ep.options.HysteresisThreshold {
+            ep.Descent += ep.reference - raw
+            ep.reference = raw
+        }
+    case ElevationMovingAverage:
+        if len(ep.window) == ep.options.MovingAverageWindow {
+            ep.windowSum -= ep.window[0]
+            copy(ep.window, ep.window[1:])
+            ep.window = ep.window[:len(ep.window)-1]
+        }
+
+        ep.window = append(ep.window, raw)
+        ep.windowSum += raw
+
+        smoothed = ep.windowSum / float64(len(ep.window))
+    case ElevationKalman:
+        if ep.hasLast == false {
+            ep.estimate = raw
+            ep.variance = ep.options.KalmanMeasurementNoise
+        } else {
+            ep.variance += ep.options.KalmanProcessNoise * ep.distanceSinceElevation
+
+            gain := ep.variance / (ep.variance + ep.options.KalmanMeasurementNoise)
+            ep.estimate += gain * (raw - ep.estimate)
+            ep.variance *= 1 - gain
+        }
+
+        smoothed = ep.estimate
+    default:
+        smoothed = raw
+    }
+
+    if ep.options.Method != ElevationHysteresis && ep.hasLast == true {
+        if smoothed > ep.last {
+            ep.Ascent += smoothed - ep.last
+        } else {
+            ep.Descent += ep.last - smoothed
+        }
+    }
+
+    ep.hasLast = true
+    ep.last = smoothed
+    ep.distanceSinceElevation = 0
+
+    return smoothed, true
+}
+
+// SegmentElevationGain returns the ascent and descent in meters for a single
+// segment.
+func SegmentElevationGain(points []gpxcommon.TrackPoint, options ElevationOptions) (ascent, descent float64) {
+    ep := newElevationProcessor(options)
+
+    for i := range points {
+        ep.add(&points[i])
+    }
+
+    return ep.Ascent, ep.Descent
+}
+
+// elevationVisitor runs the processor while the document is parsed.
+type elevationVisitor struct {
+    ep      *elevationProcessor
+    profile []ProfilePoint
+}
+
+func (ev *elevationVisitor) TrackSegmentOpen(ts *gpxcommon.TrackSegment) error {
+    ev.ep.resetSegment()
+
+    return nil
+}
+
+func (ev *elevationVisitor) TrackSegmentClose(ts *gpxcommon.TrackSegment) error {
+    return nil
+}
+
+func (ev *elevationVisitor) TrackPointOpen(tp *gpxcommon.TrackPoint) error {
+    return nil
+}
+
+func (ev *elevationVisitor) TrackPointClose(tp *gpxcommon.TrackPoint) error {
+    smoothed, ok := ev.ep.add(tp)
+
+    if ok == true && ev.profile != nil {
+        pp := ProfilePoint{
+            Distance:  ev.ep.Distance,
+            Elevation: smoothed,
+        }
+
+        ev.profile = append(ev.profile, pp)
+    }
+
+    return nil
+}
+
+func (ev *elevationVisitor) parse(r io.Reader) (err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    gp := gpxreader.NewGpxParser(r, ev)
+
+    err = gp.Parse()
+    log.PanicIf(err)
+
+    return nil
+}
+
+// ElevationGain streams the GPX data and returns the total ascent and descent
+// in meters. Changes are never counted across segment boundaries.
+func ElevationGain(r io.Reader, options ElevationOptions) (ascent, descent float64, err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    ev := &elevationVisitor{
+        ep: newElevationProcessor(options),
+    }
+
+    err = ev.parse(r)
+    log.PanicIf(err)
+
+    return ev.ep.Ascent, ev.ep.Descent, nil
+}
+
+// ElevationProfile streams the GPX data and returns the smoothed elevation of
+// every point that has one along with the distance traveled to it. The gaps
+// between segments do not add distance. Hysteresis does not smooth the
+// elevations themselves so the raw values are returned for that method.
+func ElevationProfile(r io.Reader, options ElevationOptions) (profile []ProfilePoint, err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    ev := &elevationVisitor{
+        ep:      newElevationProcessor(options),
+        profile: make([]ProfilePoint, 0),
+    }
+
+    err = ev.parse(r)
+    log.PanicIf(err)
+
+    return ev.profile, nil
+}
@@ -0,0 +1,180 @@
+package gpxgeo
+
+import (
+    "bytes"
+    "math"
+    "testing"
+
+    "github.com/dsoprea/go-logging"
+
+    "github.com/dsoprea/go-gpx"
+    "github.com/dsoprea/go-gpx/reader"
+)
+
+// getElevationTestPoints returns a flat stretch with three meters of noise
+// followed by a steady climb of 100 meters.
+func getElevationTestPoints() []gpxcommon.TrackPoint {
+    elevations := []float32{100, 103, 100, 103, 100, 103, 100, 120, 140, 160, 180, 200}
+
+    points := make([]gpxcommon.TrackPoint, len(elevations))
+    for i, elevation := range elevations {
+        points[i] = gpxcommon.TrackPoint{
+            LongitudeDecimal: float64(i) * 0.001,
+            Elevation:        elevation,
+        }
+    }
+
+    return points
+}
+
+func TestSegmentElevationGain_Raw(t *testing.T) {
+    options := DefaultElevationOptions()
+    options.Method = ElevationRaw
+
+    ascent, descent := SegmentElevationGain(getElevationTestPoints(), options)
+
+    if ascent != 109 {
+        t.Fatalf("Ascent not correct: (%f)", ascent)
+    } else if descent != 9 {
+        t.Fatalf("Descent not correct: (%f)", descent)
+    }
+}
+
+func TestSegmentElevationGain_Hysteresis(t *testing.T) {
+    ascent, descent := SegmentElevationGain(getElevationTestPoints(), DefaultElevationOptions())
+
+    if ascent != 100 {
+        t.Fatalf("Ascent not correct: (%f)", ascent)
+    } else if descent != 0 {
+        t.Fatalf("Descent not correct: (%f)", descent)
+    }
+}
+
+func TestSegmentElevationGain_MovingAverage(t *testing.T) {
+    options := DefaultElevationOptions()
+    options.Method = ElevationMovingAverage
+    options.MovingAverageWindow = 2
+
+    ascent, descent := SegmentElevationGain(getElevationTestPoints(), options)
+
+    // The averages are 101.5 through the flat stretch and then 110, 130, 150,
+    // 170, and 190.
+    if ascent != 90 {
+        t.Fatalf("Ascent not correct: (%f)", ascent)
+    } else if descent != 0 {
+        t.Fatalf("Descent not correct: (%f)", descent)
+    }
+}
+
+func TestSegmentElevationGain_Kalman(t *testing.T) {
+    options := DefaultElevationOptions()
+    options.Method = ElevationKalman
+
+    rawOptions := options
+    rawOptions.Method = ElevationRaw
+
+    points := getElevationTestPoints()
+
+    ascent, descent := SegmentElevationGain(points, options)
+    rawAscent, rawDescent := SegmentElevationGain(points, rawOptions)
+
+    if ascent <= 0 || ascent >= rawAscent {
+        t.Fatalf("Ascent not smoothed: (%f) (%f)", ascent, rawAscent)
+    } else if descent >= rawDescent {
+        t.Fatalf("Descent not smoothed: (%f) (%f)", descent, rawDescent)
+    }
+}
+
+func TestSegmentElevationGain_MissingElevations(t *testing.T) {
+    points := getElevationTestPoints()
+    points[1].Elevation = 0
+    points[3].Elevation = 0
+    points[5].Elevation = 0
+
+    options := DefaultElevationOptions()
+    options.Method = ElevationRaw
+
+    ascent, descent := SegmentElevationGain(points, options)
+
+    if ascent != 100 {
+        t.Fatalf("Ascent not correct: (%f)", ascent)
+    } else if descent != 0 {
+        t.Fatalf("Descent not correct: (%f)", descent)
+    }
+}
+
+func TestElevationGain_Segments(t *testing.T) {
+    data := `<?xml version="1.0" encoding="UTF-8" ?><gpx version="1.0"><trk><trkseg>
+<trkpt lat="0" lon="0"><ele>100</ele></trkpt>
+<trkpt lat="0" lon="0.001"><ele>110</ele></trkpt>
+</trkseg><trkseg>
+<trkpt lat="0" lon="0.002"><ele>500</ele></trkpt>
+<trkpt lat="0" lon="0.003"><ele>490</ele></trkpt>
+</trkseg></trk></gpx>`
+
+    options := DefaultElevationOptions()
+    options.Method = ElevationRaw
+
+    ascent, descent, err := ElevationGain(bytes.NewBufferString(data), options)
+    log.PanicIf(err)
+
+    // The jump between the segments must not be counted.
+    if ascent != 10 {
+        t.Fatalf("Ascent not correct: (%f)", ascent)
+    } else if descent != 10 {
+        t.Fatalf("Descent not correct: (%f)", descent)
+    }
+}
+
+func TestElevationGain_TestData(t *testing.T) {
+    options := DefaultElevationOptions()
+
+    ascent, descent, err := ElevationGain(bytes.NewBufferString(gpxreader.TestGpxData), options)
+    log.PanicIf(err)
+
+    options.Method = ElevationRaw
+
+    rawAscent, rawDescent, err := ElevationGain(bytes.NewBufferString(gpxreader.TestGpxData), options)
+    log.PanicIf(err)
+
+    if math.Abs(rawAscent-830.7012082288416) > 1e-3 || math.Abs(rawDescent-839.4843471732198) > 1e-3 {
+        t.Fatalf("Raw gain not correct: (%f) (%f)", rawAscent, rawDescent)
+    } else if ascent > rawAscent || descent > rawDescent {
+        t.Fatalf("Hysteresis gain not less than raw gain: (%f) (%f)", ascent, descent)
+    }
+}
+
+func TestElevationProfile(t *testing.T) {
+    options := DefaultElevationOptions()
+
+    profile, err := ElevationProfile(bytes.NewBufferString(gpxreader.TestGpxData), options)
+    log.PanicIf(err)
+
+    if len(profile) != 37 {
+        t.Fatalf("Profile length not correct: (%d)", len(profile))
+    }
+
+    for i := 1; i < len(profile); i++ {
+        if profile[i].Distance < profile[i-1].Distance {
+            t.Fatalf("Profile distance decreases at (%d): %s", i, profile[i])
+        }
+    }
+
+    lengths, err := TrackLengths(bytes.NewBufferString(gpxreader.TestGpxData), Distance)
+    log.PanicIf(err)
+
+    if profile[len(profile)-1].Distance > lengths[0] {
+        t.Fatalf("Profile distance exceeds track length: %s", profile[len(profile)-1])
+    }
+
+    options.Method = ElevationMovingAverage
+
+    smoothed, err := ElevationProfile(bytes.NewBufferString(gpxreader.TestGpxData), options)
+    log.PanicIf(err)
+
+    if len(smoothed) != len(profile) {
+        t.Fatalf("Smoothed profile length not correct: (%d)", len(smoothed))
+    } else if smoothed[0] != profile[0] {
+        t.Fatalf("First smoothed point not correct: %s", smoothed[0])
+    }
+}
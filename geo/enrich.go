@@ -0,0 +1,211 @@
+package gpxgeo
+
+import (
+    "math"
+
+    "github.com/dsoprea/go-logging"
+
+    "github.com/dsoprea/go-gpx"
+    "github.com/dsoprea/go-gpx/pipe"
+)
+
+// EnrichOptions controls how speeds and courses are derived. A value is
+// recorded if the element was present in the GPX (see HasSpeed and HasCourse)
+// or, for points built in code, if it isn't zero.
+type EnrichOptions struct {
+    // OverwriteImplausible replaces recorded values that fail the checks
+    // below. Otherwise, recorded values are always kept.
+    OverwriteImplausible bool
+
+    // MaxPlausibleSpeed (m/s) is the fastest recorded speed that is believed.
+    // Zero disables this.
+    MaxPlausibleSpeed float64
+
+    // MaxSpeedDifference (m/s) is how far a recorded speed can be from the
+    // derived one before it is not believed. Zero disables this.
+    MaxSpeedDifference float64
+
+    // DistanceFunc defaults to Distance if not set.
+    DistanceFunc DistanceFunc
+}
+
+// DefaultEnrichOptions only fills in missing values.
+func DefaultEnrichOptions() EnrichOptions {
+    return EnrichOptions{
+        MaxPlausibleSpeed: DefaultMaxSegmentSpeed,
+        DistanceFunc:      Distance,
+    }
+}
+
+// enricher derives the values for a point from the points on either side of
+// it in the same segment.
+type enricher struct {
+    options EnrichOptions
+}
+
+func newEnricher(options EnrichOptions) *enricher {
+    if options.DistanceFunc == nil {
+        options.DistanceFunc = Distance
+    }
+
+    return &enricher{
+        options: options,
+    }
+}
+
+// derive returns the speed (m/s) and course (degrees) between `from` and
+// `to`. `ok` is false for the speed if the times are missing or not
+// increasing, and for the course if the positions are the same.
+func (e *enricher) derive(from, to *gpxcommon.TrackPoint) (speed float64, speedOk bool, course float64, courseOk bool) {
+    distance := e.options.DistanceFunc(from, to)
+
+    if from.Time.IsZero() == false && to.Time.IsZero() == false {
+        if duration := to.Time.Sub(from.Time); duration > 0 {
+            speed = distance / duration.Seconds()
+            speedOk = true
+        }
+    }
+
+    if distance > 0 {
+        course = InitialBearing(from, to)
+        courseOk = true
+    }
+
+    return speed, speedOk, course, courseOk
+}
+
+// isImplausible returns true if the recorded speed shouldn't be believed.
+func (e *enricher) isImplausible(recorded, derived float64) bool {
+    if recorded < 0 {
+        return true
+    }
+
+    if e.options.MaxPlausibleSpeed > 0 && recorded > e.options.MaxPlausibleSpeed {
+        return true
+    }
+
+    if e.options.MaxSpeedDifference > 0 && math.Abs(recorded-derived) > e.options.MaxSpeedDifference {
+        return true
+    }
+
+    return false
+}
+
+// enrich returns a copy of `current` with the missing (or implausible)
+// values filled in. `previous` and `next` are nil at the ends of a segment.
+// Both neighbors are used when available.
+func (e *enricher) enrich(previous, current, next *gpxcommon.TrackPoint) gpxcommon.TrackPoint {
+    enriched := *current
+
+    from, to := previous, next
+    if from == nil {
+        from = current
+    }
+
+    if to == nil {
+        to = current
+    }
+
+    if from == to {
+        return enriched
+    }
+
+    speed, speedOk, course, courseOk := e.derive(from, to)
+
+    replaceSpeed := enriched.HasSpeed == false && enriched.Speed == 0
+    if replaceSpeed == false && e.options.OverwriteImplausible == true && speedOk == true {
+        replaceSpeed = e.isImplausible(float64(enriched.Speed), speed)
+    }
+
+    if replaceSpeed == true && speedOk == true {
+        enriched.Speed = float32(speed)
+        enriched.SpeedDerived = true
+    }
+
+    replaceCourse := enriched.HasCourse == false && enriched.Course == 0
+    if replaceCourse == false && e.options.OverwriteImplausible == true {
+        replaceCourse = enriched.Course < 0 || enriched.Course >= 360
+    }
+
+    if replaceCourse == true && courseOk == true {
+        enriched.Course = float32(course)
+        enriched.CourseDerived = true
+    }
+
+    return enriched
+}
+
+// EnrichSegment returns the points of a single segment with missing speeds
+// and courses derived from the neighboring points, and flagged as derived.
+// A new slice is returned.
+func EnrichSegment(points []gpxcommon.TrackPoint, options EnrichOptions) []gpxcommon.TrackPoint {
+    e := newEnricher(options)
+
+    enriched := make([]gpxcommon.TrackPoint, len(points))
+    for i := range points {
+        var previous, next *gpxcommon.TrackPoint
+
+        if i > 0 {
+            previous = &points[i-1]
+        }
+
+        if i+1 < len(points) {
+            next = &points[i+1]
+        }
+
+        enriched[i] = e.enrich(previous, &points[i], next)
+    }
+
+    return enriched
+}
+
+// EnrichStage returns a pipeline stage that applies EnrichSegment() to every
+// segment. Each point is held until the one after it arrives.
+func EnrichStage(options EnrichOptions) gpxpipe.Stage {
+    e := newEnricher(options)
+
+    var previous, pending *gpxcommon.TrackPoint
+
+    return func(el gpxpipe.Element, emit gpxpipe.Emit) (err error) {
+        defer func() {
+            if state := recover(); state != nil {
+                err = log.Wrap(state.(error))
+            }
+        }()
+
+        switch el.Type {
+        case gpxpipe.ElementSegmentOpen:
+            previous = nil
+            pending = nil
+        case gpxpipe.ElementPoint:
+            current := *el.Point
+
+            if pending != nil {
+                enriched := e.enrich(previous, pending, &current)
+
+                err := emit(gpxpipe.Element{Type: gpxpipe.ElementPoint, Point: &enriched})
+                log.PanicIf(err)
+            }
+
+            previous = pending
+            pending = &current
+
+            return nil
+        case gpxpipe.ElementSegmentClose:
+            if pending != nil {
+                enriched := e.enrich(previous, pending, nil)
+
+                err := emit(gpxpipe.Element{Type: gpxpipe.ElementPoint, Point: &enriched})
+                log.PanicIf(err)
+            }
+
+            previous = nil
+            pending = nil
+        }
+
+        err = emit(el)
+        log.PanicIf(err)
+
+        return nil
+    }
+}
@@ -0,0 +1,171 @@
+package gpxgeo
+
+import (
+    "bytes"
+    "math"
+    "testing"
+    "time"
+
+    "github.com/dsoprea/go-logging"
+
+    "github.com/dsoprea/go-gpx"
+    "github.com/dsoprea/go-gpx/pipe"
+    "github.com/dsoprea/go-gpx/reader"
+)
+
+// getEnrichTestPoints returns points heading east a minute apart, with a
+// recorded speed on the second point and an absurd one on the third.
+func getEnrichTestPoints() []gpxcommon.TrackPoint {
+    epoch := time.Date(2016, 12, 2, 8, 0, 0, 0, time.UTC)
+
+    points := make([]gpxcommon.TrackPoint, 4)
+    for i := range points {
+        points[i] = gpxcommon.TrackPoint{
+            LatitudeDecimal:  10,
+            LongitudeDecimal: 10 + float64(i)*0.001,
+            Time:             epoch.Add(time.Duration(i) * time.Minute),
+        }
+    }
+
+    points[1].Speed = 2
+    points[1].Course = 91
+    points[2].Speed = 500
+
+    return points
+}
+
+func TestEnrichSegment(t *testing.T) {
+    points := getEnrichTestPoints()
+    enriched := EnrichSegment(points, DefaultEnrichOptions())
+
+    first := Distance(&points[0], &points[1]) / 60
+    if enriched[0].SpeedDerived == false || math.Abs(float64(enriched[0].Speed)-first) > 1e-3 {
+        t.Fatalf("First speed not derived: %s", &enriched[0])
+    } else if enriched[0].CourseDerived == false || math.Abs(float64(enriched[0].Course)-90) > 0.01 {
+        t.Fatalf("First course not derived: %s", &enriched[0])
+    }
+
+    if enriched[1].SpeedDerived == true || enriched[1].Speed != 2 || enriched[1].CourseDerived == true || enriched[1].Course != 91 {
+        t.Fatalf("Recorded values not kept: %s", &enriched[1])
+    }
+
+    // The absurd speed is kept unless we ask for it to be overwritten.
+    if enriched[2].SpeedDerived == true || enriched[2].Speed != 500 {
+        t.Fatalf("Recorded speed not kept: %s", &enriched[2])
+    } else if enriched[2].CourseDerived == false {
+        t.Fatalf("Missing course not derived: %s", &enriched[2])
+    }
+
+    // The middle points use both neighbors.
+    middle := Distance(&points[1], &points[3]) / 120
+    if math.Abs(float64(enriched[2].Course)-90) > 0.01 {
+        t.Fatalf("Middle course not correct: %s", &enriched[2])
+    }
+
+    options := DefaultEnrichOptions()
+    options.OverwriteImplausible = true
+
+    enriched = EnrichSegment(points, options)
+
+    if enriched[2].SpeedDerived == false || math.Abs(float64(enriched[2].Speed)-middle) > 1e-3 {
+        t.Fatalf("Implausible speed not overwritten: %s", &enriched[2])
+    } else if enriched[1].SpeedDerived == true {
+        t.Fatalf("Plausible speed overwritten: %s", &enriched[1])
+    }
+
+    options.MaxSpeedDifference = 0.1
+
+    enriched = EnrichSegment(points, options)
+
+    if enriched[1].SpeedDerived == false {
+        t.Fatalf("Inconsistent speed not overwritten: %s", &enriched[1])
+    }
+}
+
+func TestEnrichSegment_Stationary(t *testing.T) {
+    points := getEnrichTestPoints()[:2]
+    points[1].LongitudeDecimal = points[0].LongitudeDecimal
+    points[1].Speed = 0
+    points[1].Course = 0
+
+    enriched := EnrichSegment(points, DefaultEnrichOptions())
+
+    if enriched[1].SpeedDerived == false || enriched[1].Speed != 0 {
+        t.Fatalf("Stationary speed not derived: %s", &enriched[1])
+    } else if enriched[1].CourseDerived == true {
+        t.Fatalf("Course derived without moving: %s", &enriched[1])
+    }
+}
+
+func TestEnrichStage(t *testing.T) {
+    original, err := gpxreader.ExtractTrackPoints(bytes.NewBufferString(gpxreader.TestGpxData))
+    log.PanicIf(err)
+
+    expected := EnrichSegment(original, DefaultEnrichOptions())
+
+    p := gpxpipe.NewPipeline(EnrichStage(DefaultEnrichOptions()))
+
+    points := make([]gpxcommon.TrackPoint, 0)
+    sink := func(e gpxpipe.Element) error {
+        if e.Type == gpxpipe.ElementPoint {
+            points = append(points, *e.Point)
+        }
+
+        return nil
+    }
+
+    err = p.Enumerate(bytes.NewBufferString(gpxreader.TestGpxData), sink)
+    log.PanicIf(err)
+
+    if len(points) != len(expected) {
+        t.Fatalf("Point count not correct: (%d)", len(points))
+    }
+
+    derived := 0
+    for i := range points {
+        if points[i] != expected[i] {
+            t.Fatalf("Point (%d) not correct: %s != %s", i, &points[i], &expected[i])
+        }
+
+        if points[i].SpeedDerived == true {
+            derived++
+        }
+    }
+
+    if derived == 0 {
+        t.Fatalf("No speeds were derived.")
+    }
+}
+
+func TestEnrichSegment_RecordedZero(t *testing.T) {
+    data := `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="test">
+  <trk>
+    <trkseg>
+      <trkpt lat="10" lon="10"><time>2016-12-02T08:00:00Z</time></trkpt>
+      <trkpt lat="10" lon="10.001"><time>2016-12-02T08:01:00Z</time><course>0</course><speed>0</speed></trkpt>
+      <trkpt lat="10" lon="10.002"><time>2016-12-02T08:02:00Z</time></trkpt>
+    </trkseg>
+  </trk>
+</gpx>`
+
+    points, err := gpxreader.ExtractTrackPoints(bytes.NewBufferString(data))
+    log.PanicIf(err)
+
+    if points[1].HasSpeed == false || points[1].HasCourse == false {
+        t.Fatalf("Recorded values not flagged: %s", &points[1])
+    } else if points[0].HasSpeed == true || points[0].HasCourse == true {
+        t.Fatalf("Missing values flagged: %s", &points[0])
+    }
+
+    enriched := EnrichSegment(points, DefaultEnrichOptions())
+
+    // A recorded zero is a genuine stop and is kept.
+    if enriched[1].SpeedDerived == true || enriched[1].Speed != 0 {
+        t.Fatalf("Recorded zero speed not kept: %s", &enriched[1])
+    } else if enriched[1].CourseDerived == true || enriched[1].Course != 0 {
+        t.Fatalf("Recorded zero course not kept: %s", &enriched[1])
+    } else if enriched[0].SpeedDerived == false || enriched[2].SpeedDerived == false {
+        t.Fatalf("Missing speeds not derived.")
+    }
+}
@@ -0,0 +1,319 @@
+package gpxgeo
+
+import (
+    "fmt"
+    "io"
+    "sort"
+    "time"
+
+    "github.com/dsoprea/go-logging"
+
+    "github.com/dsoprea/go-gpx"
+    "github.com/dsoprea/go-gpx/pipe"
+)
+
+const (
+    // DefaultGeofenceMaxGap is the longest interval between consecutive
+    // points that a crossing is interpolated across.
+    DefaultGeofenceMaxGap = 5 * time.Minute
+
+    // DefaultGeofencePrecision is how closely (meters) a crossing is located.
+    DefaultGeofencePrecision = 1.0
+
+    // geofenceMaxIterations limits the search for a crossing.
+    geofenceMaxIterations = 50
+)
+
+// Fence is a named region to watch.
+type Fence struct {
+    Id     string
+    Region Region
+}
+
+func (f Fence) String() string {
+    return fmt.Sprintf("Fence<ID=[%s] REGION=[%s]>", f.Id, f.Region)
+}
+
+type GeofenceEventType int
+
+const (
+    GeofenceEnter GeofenceEventType = iota
+    GeofenceExit
+    GeofenceDwell
+)
+
+func (get GeofenceEventType) String() string {
+    switch get {
+    case GeofenceEnter:
+        return "Enter"
+    case GeofenceExit:
+        return "Exit"
+    case GeofenceDwell:
+        return "Dwell"
+    }
+
+    return fmt.Sprintf("GeofenceEventType<%d>", int(get))
+}
+
+// GeofenceEvent is a change in whether we are within a fence.
+type GeofenceEvent struct {
+    Type    GeofenceEventType
+    FenceId string
+
+    // Time and Point are where the event happened. Point only has a position,
+    // an elevation (if the points used have one), and a time.
+    Time  time.Time
+    Point gpxcommon.TrackPoint
+
+    // Interpolated is true if the event is between two points (where the
+    // boundary was crossed) rather than at one point.
+    Interpolated bool
+
+    // Duration is the time since entering the fence, for exits and dwells.
+    Duration time.Duration
+}
+
+func (ge GeofenceEvent) String() string {
+    return fmt.Sprintf("GeofenceEvent<TYPE=[%s] FENCE=[%s] TIME=[%s] LAT=(%.8f) LON=(%.8f) INTERPOLATED=[%v] DURATION=[%s]>", ge.Type, ge.FenceId, ge.Time, ge.Point.LatitudeDecimal, ge.Point.LongitudeDecimal, ge.Interpolated, ge.Duration)
+}
+
+// GeofenceOptions controls how events are detected.
+type GeofenceOptions struct {
+    // DwellTime is how long we have to be within a fence before a dwell event
+    // is produced (once per visit). Zero disables dwell events.
+    DwellTime time.Duration
+
+    // MaxGap is the longest interval between consecutive points that a
+    // crossing is interpolated across. Zero for no limit.
+    MaxGap time.Duration
+
+    // Precision is how closely (meters) a crossing is located.
+    Precision float64
+
+    // DistanceFunc defaults to Distance if not set.
+    DistanceFunc DistanceFunc
+}
+
+// DefaultGeofenceOptions returns the options used if none are given.
+func DefaultGeofenceOptions() GeofenceOptions {
+    return GeofenceOptions{
+        MaxGap:       DefaultGeofenceMaxGap,
+        Precision:    DefaultGeofencePrecision,
+        DistanceFunc: Distance,
+    }
+}
+
+// fenceState is what we know about one fence.
+type fenceState struct {
+    inside  bool
+    entered time.Time
+    dwelled bool
+}
+
+// GeofenceEngine watches a stream of points for fences being entered and
+// exited. Only the previous point and the state of each fence are held.
+type GeofenceEngine struct {
+    fences  []Fence
+    options GeofenceOptions
+    df      DistanceFunc
+
+    states []fenceState
+
+    // previous is the last point, or nil if the next point isn't connected
+    // to it (the start or a new segment).
+    previous *gpxcommon.TrackPoint
+
+    // last is the last point, even across a break.
+    last *gpxcommon.TrackPoint
+}
+
+func NewGeofenceEngine(fences []Fence, options GeofenceOptions) *GeofenceEngine {
+    df := options.DistanceFunc
+    if df == nil {
+        df = Distance
+    }
+
+    return &GeofenceEngine{
+        fences:  fences,
+        options: options,
+        df:      df,
+        states:  make([]fenceState, len(fences)),
+    }
+}
+
+// Break tells the engine that the next point isn't connected to the last one
+// (e.g. a new segment starts), so no crossing is interpolated between them.
+func (ge *GeofenceEngine) Break() {
+    ge.previous = nil
+}
+
+// crossing finds the position between `a` and `b` where the fence is
+// crossed. `a` is on the side given by `inside`.
+func (ge *GeofenceEngine) crossing(region Region, a, b *gpxcommon.TrackPoint, inside bool) gpxcommon.TrackPoint {
+    low := 0.0
+    high := 1.0
+
+    span := ge.df(a, b)
+
+    for i := 0; i < geofenceMaxIterations && span*(high-low) > ge.options.Precision; i++ {
+        middle := (low + high) / 2
+        tp := IntermediatePoint(a, b, middle)
+
+        if region.Contains(&tp) == inside {
+            low = middle
+        } else {
+            high = middle
+        }
+    }
+
+    // The first position on the new side.
+    return IntermediatePoint(a, b, high)
+}
+
+// Add processes the next point and returns the events that happened up to
+// it, in chronological order. Points without times are ignored. A fence that
+// the first point (or the first point after a break) is already within is
+// entered at that point. If consecutive points are not connected (there was
+// a break or they are more than MaxGap apart), an exit is placed at the last
+// point within the fence and an entrance at the first point within it. Only
+// one crossing of each fence is found between consecutive points.
+func (ge *GeofenceEngine) Add(tp *gpxcommon.TrackPoint) (events []GeofenceEvent) {
+    events = make([]GeofenceEvent, 0)
+
+    if tp.Time.IsZero() == true {
+        return events
+    }
+
+    current := *tp
+
+    previous := ge.previous
+    if previous != nil && ge.options.MaxGap > 0 && current.Time.Sub(previous.Time) > ge.options.MaxGap {
+        previous = nil
+    }
+
+    for i, fence := range ge.fences {
+        state := &ge.states[i]
+        inside := fence.Region.Contains(&current)
+
+        if inside != state.inside {
+            var event GeofenceEvent
+
+            if previous != nil {
+                event.Point = ge.crossing(fence.Region, previous, &current, state.inside)
+                event.Interpolated = true
+            } else if inside == false && ge.last != nil {
+                // We left during a gap. The last time we know that we were
+                // inside was at the last point.
+                event.Point = positionOf(ge.last)
+            } else {
+                event.Point = positionOf(&current)
+            }
+
+            event.Time = event.Point.Time
+            event.FenceId = fence.Id
+
+            if inside == true {
+                event.Type = GeofenceEnter
+
+                state.entered = event.Time
+                state.dwelled = false
+            } else {
+                event.Type = GeofenceExit
+                event.Duration = event.Time.Sub(state.entered)
+            }
+
+            state.inside = inside
+            events = append(events, event)
+        }
+
+        if state.inside == true && state.dwelled == false && ge.options.DwellTime > 0 {
+            if duration := current.Time.Sub(state.entered); duration >= ge.options.DwellTime {
+                event := GeofenceEvent{
+                    Type:     GeofenceDwell,
+                    FenceId:  fence.Id,
+                    Time:     current.Time,
+                    Point:    positionOf(&current),
+                    Duration: duration,
+                }
+
+                state.dwelled = true
+                events = append(events, event)
+            }
+        }
+    }
+
+    sort.SliceStable(events, func(i, j int) bool {
+        return events[i].Time.Before(events[j].Time)
+    })
+
+    ge.previous = &current
+    ge.last = &current
+
+    return events
+}
+
+// positionOf returns only the fields of the point that are kept in an event.
+func positionOf(tp *gpxcommon.TrackPoint) gpxcommon.TrackPoint {
+    return gpxcommon.TrackPoint{
+        LatitudeDecimal:  tp.LatitudeDecimal,
+        LongitudeDecimal: tp.LongitudeDecimal,
+        Elevation:        tp.Elevation,
+        Time:             tp.Time,
+    }
+}
+
+// GeofenceStage returns a pipeline stage that passes every element through
+// unchanged and calls `cb` with the events produced by the engine. Every
+// segment is treated as not connected to the one before it.
+func GeofenceStage(ge *GeofenceEngine, cb func(event GeofenceEvent) error) gpxpipe.Stage {
+    return func(e gpxpipe.Element, emit gpxpipe.Emit) (err error) {
+        defer func() {
+            if state := recover(); state != nil {
+                err = log.Wrap(state.(error))
+            }
+        }()
+
+        switch e.Type {
+        case gpxpipe.ElementSegmentOpen:
+            ge.Break()
+        case gpxpipe.ElementPoint:
+            for _, event := range ge.Add(e.Point) {
+                err := cb(event)
+                log.PanicIf(err)
+            }
+        }
+
+        err = emit(e)
+        log.PanicIf(err)
+
+        return nil
+    }
+}
+
+// DetectGeofenceEvents returns the events for the fences from all of the
+// points in the GPX data.
+func DetectGeofenceEvents(r io.Reader, fences []Fence, options GeofenceOptions) (events []GeofenceEvent, err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    events = make([]GeofenceEvent, 0)
+
+    cb := func(event GeofenceEvent) error {
+        events = append(events, event)
+        return nil
+    }
+
+    sink := func(e gpxpipe.Element) error {
+        return nil
+    }
+
+    p := gpxpipe.NewPipeline(GeofenceStage(NewGeofenceEngine(fences, options), cb))
+
+    err = p.Enumerate(r, sink)
+    log.PanicIf(err)
+
+    return events, nil
+}
@@ -0,0 +1,159 @@
+package gpxgeo
+
+import (
+    "bytes"
+    "math"
+    "testing"
+    "time"
+
+    "github.com/dsoprea/go-logging"
+
+    "github.com/dsoprea/go-gpx"
+)
+
+// getTestFences returns a square depot with a hole in the middle and a
+// circular yard to the north of it.
+func getTestFences() []Fence {
+    depot := &Polygon{
+        Exterior: []gpxcommon.TrackPoint{
+            {LatitudeDecimal: 10, LongitudeDecimal: 10},
+            {LatitudeDecimal: 10, LongitudeDecimal: 10.01},
+            {LatitudeDecimal: 10.01, LongitudeDecimal: 10.01},
+            {LatitudeDecimal: 10.01, LongitudeDecimal: 10},
+        },
+        Holes: [][]gpxcommon.TrackPoint{
+            {
+                {LatitudeDecimal: 10.004, LongitudeDecimal: 10.004},
+                {LatitudeDecimal: 10.004, LongitudeDecimal: 10.006},
+                {LatitudeDecimal: 10.006, LongitudeDecimal: 10.006},
+                {LatitudeDecimal: 10.006, LongitudeDecimal: 10.004},
+            },
+        },
+    }
+
+    yard := &Circle{
+        Center: gpxcommon.TrackPoint{LatitudeDecimal: 10.05, LongitudeDecimal: 10},
+        Radius: 200,
+    }
+
+    return []Fence{
+        {Id: "depot", Region: depot},
+        {Id: "yard", Region: yard},
+    }
+}
+
+var (
+    testGeofenceEpoch = time.Date(2016, 12, 2, 8, 0, 0, 0, time.UTC)
+)
+
+func testGeofenceTime(minutes, seconds int) time.Time {
+    return testGeofenceEpoch.Add(time.Duration(minutes)*time.Minute + time.Duration(seconds)*time.Second)
+}
+
+// The first segment passes through the depot, stopping in it for ten
+// minutes. The second starts in the yard, leaves it and comes back, and then
+// goes quiet for eighteen minutes, during which it leaves.
+const testGeofenceGpxData = `<?xml version="1.0" encoding="UTF-8" ?><gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1"><trk><trkseg>
+<trkpt lat="9.995" lon="10.003"><time>2016-12-02T08:00:00Z</time></trkpt>
+<trkpt lat="10.005" lon="10.003"><time>2016-12-02T08:01:00Z</time></trkpt>
+<trkpt lat="10.005" lon="10.003"><time>2016-12-02T08:10:00Z</time></trkpt>
+<trkpt lat="10.015" lon="10.003"><time>2016-12-02T08:11:00Z</time></trkpt>
+</trkseg><trkseg>
+<trkpt lat="10.05" lon="10"><time>2016-12-02T08:20:00Z</time></trkpt>
+<trkpt lat="10.06" lon="10"><time>2016-12-02T08:21:00Z</time></trkpt>
+<trkpt lat="10.05" lon="10"><time>2016-12-02T08:22:00Z</time></trkpt>
+<trkpt lat="10.1" lon="10"><time>2016-12-02T08:40:00Z</time></trkpt>
+</trkseg></trk></gpx>`
+
+func TestDetectGeofenceEvents(t *testing.T) {
+    options := DefaultGeofenceOptions()
+    options.DwellTime = 5 * time.Minute
+
+    events, err := DetectGeofenceEvents(bytes.NewBufferString(testGeofenceGpxData), getTestFences(), options)
+    log.PanicIf(err)
+
+    expected := []struct {
+        eventType    GeofenceEventType
+        fenceId      string
+        interpolated bool
+    }{
+        {GeofenceEnter, "depot", true},
+        {GeofenceDwell, "depot", false},
+        {GeofenceExit, "depot", true},
+        {GeofenceEnter, "yard", false},
+        {GeofenceExit, "yard", true},
+        {GeofenceEnter, "yard", true},
+        {GeofenceExit, "yard", false},
+    }
+
+    if len(events) != len(expected) {
+        t.Fatalf("Event count not correct: %v", events)
+    }
+
+    for i, e := range expected {
+        event := events[i]
+        if event.Type != e.eventType || event.FenceId != e.fenceId || event.Interpolated != e.interpolated {
+            t.Fatalf("Event (%d) not correct: %s", i, event)
+        }
+    }
+
+    // Entering and leaving the depot are half-way between the points.
+
+    enter := events[0]
+    if enter.Time.Sub(testGeofenceTime(0, 30)) > time.Second || testGeofenceTime(0, 30).Sub(enter.Time) > time.Second {
+        t.Fatalf("Enter time not correct: %s", enter)
+    } else if math.Abs(enter.Point.LatitudeDecimal-10) > 0.0001 {
+        t.Fatalf("Enter position not correct: %s", enter)
+    }
+
+    if dwell := events[1]; dwell.Time.Equal(testGeofenceTime(10, 0)) == false {
+        t.Fatalf("Dwell not correct: %s", dwell)
+    }
+
+    exit := events[2]
+    if exit.Time.Sub(testGeofenceTime(10, 30)) > time.Second || testGeofenceTime(10, 30).Sub(exit.Time) > time.Second {
+        t.Fatalf("Exit time not correct: %s", exit)
+    } else if exit.Duration < 9*time.Minute+58*time.Second || exit.Duration > 10*time.Minute+2*time.Second {
+        t.Fatalf("Exit duration not correct: %s", exit)
+    }
+
+    // The yard is entered at the start of the second segment and its
+    // boundary is crossed at its radius.
+
+    if events[3].Time.Equal(testGeofenceTime(20, 0)) == false {
+        t.Fatalf("Enter at segment start not correct: %s", events[3])
+    }
+
+    yard := getTestFences()[1].Region.(*Circle)
+    for _, i := range []int{4, 5} {
+        if distance := Distance(&yard.Center, &events[i].Point); math.Abs(distance-yard.Radius) > 2 {
+            t.Fatalf("Crossing not on the boundary: (%.3f) %s", distance, events[i])
+        }
+    }
+
+    // We left during the gap, so the exit is at the last point in the yard.
+
+    if last := events[6]; last.Time.Equal(testGeofenceTime(22, 0)) == false || last.Point.LatitudeDecimal != 10.05 {
+        t.Fatalf("Exit across gap not correct: %s", last)
+    }
+}
+
+func TestGeofenceEngine_Hole(t *testing.T) {
+    ge := NewGeofenceEngine(getTestFences()[:1], DefaultGeofenceOptions())
+
+    points := []gpxcommon.TrackPoint{
+        {LatitudeDecimal: 10.002, LongitudeDecimal: 10.005, Time: testGeofenceTime(0, 0)},
+        {LatitudeDecimal: 10.005, LongitudeDecimal: 10.005, Time: testGeofenceTime(1, 0)},
+    }
+
+    events := make([]GeofenceEvent, 0)
+    for i := range points {
+        events = append(events, ge.Add(&points[i])...)
+    }
+
+    if len(events) != 2 || events[0].Type != GeofenceEnter || events[1].Type != GeofenceExit {
+        t.Fatalf("Events not correct: %v", events)
+    } else if math.Abs(events[1].Point.LatitudeDecimal-10.004) > 0.0001 {
+        t.Fatalf("Exit into the hole not correct: %s", events[1])
+    }
+}
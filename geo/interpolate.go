@@ -0,0 +1,260 @@
+package gpxgeo
+
+import (
+    "fmt"
+    "math"
+    "sort"
+    "time"
+
+    "github.com/dsoprea/go-logging"
+
+    "github.com/dsoprea/go-gpx"
+    "github.com/dsoprea/go-gpx/pipe"
+)
+
+var (
+    ErrNoPosition      = fmt.Errorf("time is not covered by the points")
+    ErrInvalidInterval = fmt.Errorf("interval must be positive")
+)
+
+// IntermediatePoint returns the point that is `fraction` of the way from `a`
+// to `b`. The position follows the great circle. The elevation is
+// interpolated linearly if both points have one, and otherwise taken from the
+// point that has one (zero is taken to mean that there is none, as everywhere
+// else). The time is interpolated the same way if both points have one. No
+// other fields are set.
+func IntermediatePoint(a, b *gpxcommon.TrackPoint, fraction float64) gpxcommon.TrackPoint {
+    tp := gpxcommon.TrackPoint{}
+
+    phi1 := toRadians(a.LatitudeDecimal)
+    lambda1 := toRadians(a.LongitudeDecimal)
+    phi2 := toRadians(b.LatitudeDecimal)
+    lambda2 := toRadians(b.LongitudeDecimal)
+
+    delta := HaversineDistance(a, b) / EarthRadius
+
+    if delta == 0 {
+        tp.LatitudeDecimal = a.LatitudeDecimal
+        tp.LongitudeDecimal = a.LongitudeDecimal
+    } else {
+        A := math.Sin((1-fraction)*delta) / math.Sin(delta)
+        B := math.Sin(fraction*delta) / math.Sin(delta)
+
+        x := A*math.Cos(phi1)*math.Cos(lambda1) + B*math.Cos(phi2)*math.Cos(lambda2)
+        y := A*math.Cos(phi1)*math.Sin(lambda1) + B*math.Cos(phi2)*math.Sin(lambda2)
+        z := A*math.Sin(phi1) + B*math.Sin(phi2)
+
+        tp.LatitudeDecimal = toDegrees(math.Atan2(z, math.Sqrt(x*x+y*y)))
+        tp.LongitudeDecimal = toDegrees(math.Atan2(y, x))
+    }
+
+    if a.Elevation != 0 && b.Elevation != 0 {
+        tp.Elevation = a.Elevation + float32(fraction)*(b.Elevation-a.Elevation)
+    } else if a.Elevation != 0 {
+        tp.Elevation = a.Elevation
+    } else {
+        tp.Elevation = b.Elevation
+    }
+
+    if a.Time.IsZero() == false && b.Time.IsZero() == false {
+        offset := time.Duration(fraction * float64(b.Time.Sub(a.Time)))
+        tp.Time = a.Time.Add(offset)
+    }
+
+    return tp
+}
+
+// PositionAt returns the position at time `t` by interpolating between the
+// points on either side of it. The points must be in chronological order,
+// must have times, and should be from a single segment. ErrNoPosition is
+// returned if `t` is before the first point, after the last point, or within
+// an interval longer than `maxGap` (zero for no limit). A point at exactly
+// `t` is returned as-is.
+func PositionAt(points []gpxcommon.TrackPoint, t time.Time, maxGap time.Duration) (tp gpxcommon.TrackPoint, err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    // The first point at or after `t`.
+    i := sort.Search(len(points), func(i int) bool {
+        return points[i].Time.Before(t) == false
+    })
+
+    if i == len(points) {
+        log.Panic(ErrNoPosition)
+    } else if points[i].Time.Equal(t) == true {
+        return points[i], nil
+    } else if i == 0 {
+        log.Panic(ErrNoPosition)
+    }
+
+    return interpolateAt(&points[i-1], &points[i], t, maxGap)
+}
+
+// interpolateAt returns the position at `t`, which must be between the times
+// of `a` and `b`.
+func interpolateAt(a, b *gpxcommon.TrackPoint, t time.Time, maxGap time.Duration) (tp gpxcommon.TrackPoint, err error) {
+    interval := b.Time.Sub(a.Time)
+
+    if maxGap > 0 && interval > maxGap {
+        return tp, ErrNoPosition
+    }
+
+    fraction := float64(t.Sub(a.Time)) / float64(interval)
+
+    tp = IntermediatePoint(a, b, fraction)
+
+    // Don't let rounding move us off of the requested time.
+    tp.Time = t
+
+    return tp, nil
+}
+
+// resampler produces points at every multiple of the interval (since the zero
+// time) from the points of one segment at a time.
+type resampler struct {
+    interval time.Duration
+    maxGap   time.Duration
+
+    previous *gpxcommon.TrackPoint
+
+    // next is the next time that a point will be produced for.
+    next time.Time
+}
+
+func newResampler(interval, maxGap time.Duration) *resampler {
+    return &resampler{
+        interval: interval,
+        maxGap:   maxGap,
+    }
+}
+
+// reset starts a new segment.
+func (rs *resampler) reset() {
+    rs.previous = nil
+}
+
+// nextAtOrAfter returns the first multiple of the interval at or after `t`.
+func (rs *resampler) nextAtOrAfter(t time.Time) time.Time {
+    truncated := t.Truncate(rs.interval)
+    if truncated.Before(t) == true {
+        truncated = truncated.Add(rs.interval)
+    }
+
+    return truncated
+}
+
+// add processes the next point and returns the points produced up to and
+// including its time. Points without times or that do not move forward in
+// time are skipped.
+func (rs *resampler) add(tp *gpxcommon.TrackPoint) []gpxcommon.TrackPoint {
+    if tp.Time.IsZero() == true {
+        return nil
+    }
+
+    current := *tp
+    previous := rs.previous
+
+    if previous != nil && current.Time.After(previous.Time) == false {
+        return nil
+    }
+
+    rs.previous = &current
+
+    if previous == nil || (rs.maxGap > 0 && current.Time.Sub(previous.Time) > rs.maxGap) {
+        rs.next = rs.nextAtOrAfter(current.Time)
+
+        if rs.next.Equal(current.Time) == false {
+            return nil
+        }
+
+        rs.next = rs.next.Add(rs.interval)
+
+        resampled := gpxcommon.TrackPoint{
+            LatitudeDecimal:  current.LatitudeDecimal,
+            LongitudeDecimal: current.LongitudeDecimal,
+            Elevation:        current.Elevation,
+            Time:             current.Time,
+        }
+
+        return []gpxcommon.TrackPoint{resampled}
+    }
+
+    produced := make([]gpxcommon.TrackPoint, 0)
+
+    for ; rs.next.After(current.Time) == false; rs.next = rs.next.Add(rs.interval) {
+        resampled, err := interpolateAt(previous, &current, rs.next, 0)
+        log.PanicIf(err)
+
+        produced = append(produced, resampled)
+    }
+
+    return produced
+}
+
+// ResampleSegment returns points at every multiple of `interval` (e.g. every
+// whole second for one second) that falls within the segment. Intervals
+// longer than `maxGap` (zero for no limit) are not interpolated across. The
+// resampled points only have a position, an elevation, and a time.
+// ErrInvalidInterval is returned if `interval` isn't positive.
+func ResampleSegment(points []gpxcommon.TrackPoint, interval, maxGap time.Duration) (resampled []gpxcommon.TrackPoint, err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    if interval <= 0 {
+        log.Panic(ErrInvalidInterval)
+    }
+
+    rs := newResampler(interval, maxGap)
+
+    resampled = make([]gpxcommon.TrackPoint, 0)
+    for i := range points {
+        resampled = append(resampled, rs.add(&points[i])...)
+    }
+
+    return resampled, nil
+}
+
+// ResampleStage returns a pipeline stage that replaces the points of every
+// segment with those from ResampleSegment(). The points are processed as they
+// arrive so segments are not held in memory. If `interval` isn't positive,
+// the stage fails with ErrInvalidInterval.
+func ResampleStage(interval, maxGap time.Duration) gpxpipe.Stage {
+    rs := newResampler(interval, maxGap)
+
+    return func(e gpxpipe.Element, emit gpxpipe.Emit) (err error) {
+        defer func() {
+            if state := recover(); state != nil {
+                err = log.Wrap(state.(error))
+            }
+        }()
+
+        if interval <= 0 {
+            log.Panic(ErrInvalidInterval)
+        }
+
+        switch e.Type {
+        case gpxpipe.ElementSegmentOpen:
+            rs.reset()
+        case gpxpipe.ElementPoint:
+            resampled := rs.add(e.Point)
+
+            for i := range resampled {
+                err := emit(gpxpipe.Element{Type: gpxpipe.ElementPoint, Point: &resampled[i]})
+                log.PanicIf(err)
+            }
+
+            return nil
+        }
+
+        err = emit(e)
+        log.PanicIf(err)
+
+        return nil
+    }
+}
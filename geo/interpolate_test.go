@@ -0,0 +1,240 @@
+package gpxgeo
+
+import (
+    "bytes"
+    "math"
+    "testing"
+    "time"
+
+    "github.com/dsoprea/go-logging"
+
+    "github.com/dsoprea/go-gpx"
+    "github.com/dsoprea/go-gpx/pipe"
+    "github.com/dsoprea/go-gpx/reader"
+)
+
+// getInterpolateTestPoints returns points ten seconds apart heading east,
+// followed by a ten minute gap.
+func getInterpolateTestPoints() []gpxcommon.TrackPoint {
+    epoch := time.Date(2016, 12, 2, 8, 0, 5, 0, time.UTC)
+
+    points := []gpxcommon.TrackPoint{
+        {LongitudeDecimal: 0, Elevation: 100, Time: epoch},
+        {LongitudeDecimal: 0.001, Elevation: 110, Time: epoch.Add(10 * time.Second)},
+        {LongitudeDecimal: 0.002, Elevation: 120, Time: epoch.Add(20 * time.Second)},
+        {LongitudeDecimal: 0.003, Elevation: 130, Time: epoch.Add(20*time.Second + 10*time.Minute)},
+    }
+
+    return points
+}
+
+func TestIntermediatePoint(t *testing.T) {
+    a := &gpxcommon.TrackPoint{LatitudeDecimal: 0, LongitudeDecimal: 0}
+    b := &gpxcommon.TrackPoint{LatitudeDecimal: 0, LongitudeDecimal: 90}
+
+    tp := IntermediatePoint(a, b, 0.5)
+
+    if math.Abs(tp.LatitudeDecimal) > 1e-9 || math.Abs(tp.LongitudeDecimal-45) > 1e-9 {
+        t.Fatalf("Midpoint on the equator not correct: %s", &tp)
+    }
+
+    // The great circle between two points at the same latitude bulges toward
+    // the pole.
+    a = &gpxcommon.TrackPoint{LatitudeDecimal: 45, LongitudeDecimal: 0}
+    b = &gpxcommon.TrackPoint{LatitudeDecimal: 45, LongitudeDecimal: 90}
+
+    tp = IntermediatePoint(a, b, 0.5)
+
+    if tp.LatitudeDecimal <= 45 || math.Abs(tp.LongitudeDecimal-45) > 1e-9 {
+        t.Fatalf("Midpoint not on the great circle: %s", &tp)
+    }
+
+    // An elevation is only interpolated between two points that have one.
+    a = &gpxcommon.TrackPoint{LatitudeDecimal: 0, LongitudeDecimal: 0, Elevation: 130}
+    b = &gpxcommon.TrackPoint{LatitudeDecimal: 0, LongitudeDecimal: 0.001, Elevation: 140}
+
+    tp = IntermediatePoint(a, b, 0.25)
+
+    if tp.Elevation != 132.5 {
+        t.Fatalf("Elevation not interpolated: %s", &tp)
+    }
+
+    b.Elevation = 0
+
+    tp = IntermediatePoint(a, b, 0.75)
+
+    if tp.Elevation != 130 {
+        t.Fatalf("Elevation not taken from the first point: %s", &tp)
+    }
+
+    tp = IntermediatePoint(b, a, 0.25)
+
+    if tp.Elevation != 130 {
+        t.Fatalf("Elevation not taken from the second point: %s", &tp)
+    }
+}
+
+func TestPositionAt(t *testing.T) {
+    points := getInterpolateTestPoints()
+
+    tp, err := PositionAt(points, points[0].Time.Add(5*time.Second), 0)
+    log.PanicIf(err)
+
+    if math.Abs(tp.LongitudeDecimal-0.0005) > 1e-9 {
+        t.Fatalf("Longitude not correct: %s", &tp)
+    } else if tp.Elevation != 105 {
+        t.Fatalf("Elevation not correct: %s", &tp)
+    } else if tp.Time.Equal(points[0].Time.Add(5*time.Second)) == false {
+        t.Fatalf("Time not correct: %s", &tp)
+    }
+
+    tp, err = PositionAt(points, points[1].Time, 0)
+    log.PanicIf(err)
+
+    if tp != points[1] {
+        t.Fatalf("Exact point not returned: %s", &tp)
+    }
+
+    tp, err = PositionAt(points, points[2].Time.Add(time.Minute), 0)
+    log.PanicIf(err)
+
+    if tp.LongitudeDecimal <= 0.002 || tp.LongitudeDecimal >= 0.003 {
+        t.Fatalf("Position within gap not correct: %s", &tp)
+    }
+}
+
+func TestPositionAt_OutOfRange(t *testing.T) {
+    points := getInterpolateTestPoints()
+
+    _, err := PositionAt(points, points[0].Time.Add(-time.Second), 0)
+    if err == nil || log.Is(err, ErrNoPosition) == false {
+        t.Fatalf("Expected no-position error before the first point: [%v]", err)
+    }
+
+    _, err = PositionAt(points, points[3].Time.Add(time.Second), 0)
+    if err == nil || log.Is(err, ErrNoPosition) == false {
+        t.Fatalf("Expected no-position error after the last point: [%v]", err)
+    }
+
+    _, err = PositionAt(points, points[2].Time.Add(time.Minute), time.Minute)
+    if err == nil || log.Is(err, ErrNoPosition) == false {
+        t.Fatalf("Expected no-position error within a gap: [%v]", err)
+    }
+}
+
+func TestResampleSegment(t *testing.T) {
+    points := getInterpolateTestPoints()
+
+    resampled, err := ResampleSegment(points, 5*time.Second, time.Minute)
+    log.PanicIf(err)
+
+    // 08:00:05 through 08:00:25, and then the point after the gap, which is
+    // on an even five seconds.
+    if len(resampled) != 6 {
+        t.Fatalf("Point count not correct: (%d) %v", len(resampled), resampled)
+    }
+
+    for i, tp := range resampled[:5] {
+        expected := points[0].Time.Add(time.Duration(i) * 5 * time.Second)
+
+        if tp.Time.Equal(expected) == false {
+            t.Fatalf("Time (%d) not correct: %s", i, &tp)
+        } else if math.Abs(tp.LongitudeDecimal-float64(i)*0.0005) > 1e-9 {
+            t.Fatalf("Longitude (%d) not correct: %s", i, &tp)
+        } else if tp.Elevation != float32(100+i*5) {
+            t.Fatalf("Elevation (%d) not correct: %s", i, &tp)
+        }
+    }
+
+    if resampled[5].Time.Equal(points[3].Time) == false {
+        t.Fatalf("Point after the gap not correct: %s", &resampled[5])
+    }
+
+    // Without a limit, the gap is filled.
+    resampled, err = ResampleSegment(points, 5*time.Second, 0)
+    log.PanicIf(err)
+
+    if len(resampled) != 125 {
+        t.Fatalf("Point count without gap limit not correct: (%d)", len(resampled))
+    }
+}
+
+func TestResampleSegment_Unaligned(t *testing.T) {
+    points := getInterpolateTestPoints()
+
+    resampled, err := ResampleSegment(points[:3], 3*time.Second, 0)
+    log.PanicIf(err)
+
+    // 08:00:06 through 08:00:24.
+    if len(resampled) != 7 {
+        t.Fatalf("Point count not correct: (%d)", len(resampled))
+    } else if resampled[0].Time.Second() != 6 || resampled[6].Time.Second() != 24 {
+        t.Fatalf("Times not aligned: %s %s", &resampled[0], &resampled[6])
+    }
+}
+
+func TestResampleSegment_InvalidInterval(t *testing.T) {
+    points := getInterpolateTestPoints()
+
+    for _, interval := range []time.Duration{0, -time.Second} {
+        _, err := ResampleSegment(points, interval, 0)
+        if err == nil || log.Is(err, ErrInvalidInterval) == false {
+            t.Fatalf("Expected invalid-interval error for (%s): [%v]", interval, err)
+        }
+    }
+}
+
+func TestResampleStage(t *testing.T) {
+    p := gpxpipe.NewPipeline(ResampleStage(time.Minute, 10*time.Minute))
+
+    points := make([]gpxcommon.TrackPoint, 0)
+    sink := func(e gpxpipe.Element) error {
+        if e.Type == gpxpipe.ElementPoint {
+            points = append(points, *e.Point)
+        }
+
+        return nil
+    }
+
+    err := p.Enumerate(bytes.NewBufferString(testLengthGpxData), sink)
+    log.PanicIf(err)
+
+    // Nothing is interpolated between the segments or the tracks.
+    if len(points) != 5 {
+        t.Fatalf("Point count not correct: (%d) %v", len(points), points)
+    }
+
+    original, err := gpxreader.ExtractTrackPoints(bytes.NewBufferString(gpxreader.TestGpxData))
+    log.PanicIf(err)
+
+    points = points[:0]
+
+    err = p.Enumerate(bytes.NewBufferString(gpxreader.TestGpxData), sink)
+    log.PanicIf(err)
+
+    expected, err := ResampleSegment(original, time.Minute, 10*time.Minute)
+    log.PanicIf(err)
+
+    if len(points) != len(expected) {
+        t.Fatalf("Point count not correct: (%d) != (%d)", len(points), len(expected))
+    }
+
+    for i := 1; i < len(points); i++ {
+        if points[i].Time.Sub(points[i-1].Time)%time.Minute != 0 {
+            t.Fatalf("Points not on the interval: %s %s", &points[i-1], &points[i])
+        }
+    }
+}
+
+func TestResampleStage_InvalidInterval(t *testing.T) {
+    p := gpxpipe.NewPipeline(ResampleStage(0, 0))
+
+    sink := func(e gpxpipe.Element) error {
+        return nil
+    }
+
+    err := p.Enumerate(bytes.NewBufferString(testLengthGpxData), sink)
+    if err == nil || log.Is(err, ErrInvalidInterval) == false {
+        t.Fatalf("Expected invalid-interval error: [%v]", err)
+    }
+}
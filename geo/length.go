@@ -0,0 +1,134 @@
+package gpxgeo
+
+import (
+    "io"
+
+    "github.com/dsoprea/go-logging"
+
+    "github.com/dsoprea/go-gpx"
+    "github.com/dsoprea/go-gpx/reader"
+)
+
+// PathLength returns the sum of the distances between consecutive points.
+func PathLength(points []gpxcommon.TrackPoint, df DistanceFunc) float64 {
+    length := 0.0
+
+    for i := 1; i < len(points); i++ {
+        length += df(&points[i-1], &points[i])
+    }
+
+    return length
+}
+
+// lengthVisitor accumulates lengths while the document is parsed. The points
+// are delivered by the same visitor that EnumerateTrackPoints() uses and only
+// the track and segment boundaries are added here. Distance is never
+// accumulated between the last point of one segment and the first point of
+// the next.
+type lengthVisitor struct {
+    *gpxreader.SimpleGpxTrackVisitor
+
+    df DistanceFunc
+
+    trackLengths   []float64
+    segmentLengths []float64
+
+    previous *gpxcommon.TrackPoint
+}
+
+func newLengthVisitor(df DistanceFunc) *lengthVisitor {
+    lv := &lengthVisitor{
+        df:             df,
+        trackLengths:   make([]float64, 0),
+        segmentLengths: make([]float64, 0),
+    }
+
+    lv.SimpleGpxTrackVisitor = gpxreader.NewSimpleGpxTrackVisitor(lv.addPoint)
+
+    return lv
+}
+
+func (lv *lengthVisitor) TrackOpen(t *gpxcommon.Track) error {
+    lv.trackLengths = append(lv.trackLengths, 0)
+
+    return nil
+}
+
+func (lv *lengthVisitor) TrackClose(t *gpxcommon.Track) error {
+    return nil
+}
+
+func (lv *lengthVisitor) TrackSegmentOpen(ts *gpxcommon.TrackSegment) error {
+    lv.segmentLengths = append(lv.segmentLengths, 0)
+    lv.previous = nil
+
+    return nil
+}
+
+func (lv *lengthVisitor) TrackSegmentClose(ts *gpxcommon.TrackSegment) error {
+    return nil
+}
+
+func (lv *lengthVisitor) addPoint(tp *gpxcommon.TrackPoint) error {
+    current := *tp
+
+    if lv.previous != nil {
+        distance := lv.df(lv.previous, &current)
+
+        lv.segmentLengths[len(lv.segmentLengths)-1] += distance
+        lv.trackLengths[len(lv.trackLengths)-1] += distance
+    }
+
+    lv.previous = &current
+
+    return nil
+}
+
+func (lv *lengthVisitor) parse(r io.Reader) (err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    gp := gpxreader.NewGpxParser(r, lv)
+
+    err = gp.Parse()
+    log.PanicIf(err)
+
+    return nil
+}
+
+// TrackLengths streams the GPX data and returns the length of each track in
+// meters. Gaps between segments are not counted.
+func TrackLengths(r io.Reader, df DistanceFunc) (lengths []float64, err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    lv := newLengthVisitor(df)
+
+    err = lv.parse(r)
+    log.PanicIf(err)
+
+    return lv.trackLengths, nil
+}
+
+// SegmentLengths streams the GPX data and returns the length of each segment
+// (across all tracks) in meters.
+func SegmentLengths(r io.Reader, df DistanceFunc) (lengths []float64, err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    lv := newLengthVisitor(df)
+
+    err = lv.parse(r)
+    log.PanicIf(err)
+
+    return lv.segmentLengths, nil
+}
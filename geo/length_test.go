@@ -0,0 +1,111 @@
+package gpxgeo
+
+import (
+    "bytes"
+    "math"
+    "testing"
+
+    "github.com/dsoprea/go-logging"
+
+    "github.com/dsoprea/go-gpx"
+    "github.com/dsoprea/go-gpx/reader"
+)
+
+const (
+    // Two tracks, the first with two segments. The gap between the segments
+    // must not be counted.
+    testLengthGpxData = `<?xml version="1.0" encoding="UTF-8" ?><gpx version="1.0"><trk><trkseg>
+<trkpt lat="0" lon="0"><time>2016-12-02T08:00:00Z</time></trkpt>
+<trkpt lat="0" lon="1"><time>2016-12-02T08:01:00Z</time></trkpt>
+</trkseg><trkseg>
+<trkpt lat="10" lon="10"><time>2016-12-02T09:00:00Z</time></trkpt>
+<trkpt lat="11" lon="10"><time>2016-12-02T09:01:00Z</time></trkpt>
+</trkseg></trk><trk><trkseg>
+<trkpt lat="20" lon="20"><time>2016-12-02T10:00:00Z</time></trkpt>
+</trkseg></trk></gpx>`
+)
+
+func TestPathLength(t *testing.T) {
+    points, err := gpxreader.ExtractTrackPoints(bytes.NewBufferString(gpxreader.TestGpxData))
+    log.PanicIf(err)
+
+    length := PathLength(points, Distance)
+
+    expected := 0.0
+    for i := 1; i < len(points); i++ {
+        expected += Distance(&points[i-1], &points[i])
+    }
+
+    if length != expected {
+        t.Fatalf("Length not correct: (%f) != (%f)", length, expected)
+    } else if PathLength(points[:1], Distance) != 0 {
+        t.Fatalf("Single point should have no length.")
+    }
+}
+
+func TestSegmentLengths(t *testing.T) {
+    lengths, err := SegmentLengths(bytes.NewBufferString(testLengthGpxData), HaversineDistance)
+    log.PanicIf(err)
+
+    // One degree of arc.
+    degree := EarthRadius * math.Pi / 180
+
+    if len(lengths) != 3 {
+        t.Fatalf("Segment count not correct: (%d)", len(lengths))
+    } else if math.Abs(lengths[0]-degree) > 1e-6 {
+        t.Fatalf("First segment not correct: (%f)", lengths[0])
+    } else if math.Abs(lengths[1]-degree) > 1e-6 {
+        t.Fatalf("Second segment not correct: (%f)", lengths[1])
+    } else if lengths[2] != 0 {
+        t.Fatalf("Third segment not correct: (%f)", lengths[2])
+    }
+}
+
+func TestTrackLengths(t *testing.T) {
+    lengths, err := TrackLengths(bytes.NewBufferString(testLengthGpxData), HaversineDistance)
+    log.PanicIf(err)
+
+    degree := EarthRadius * math.Pi / 180
+
+    if len(lengths) != 2 {
+        t.Fatalf("Track count not correct: (%d)", len(lengths))
+    } else if math.Abs(lengths[0]-2*degree) > 1e-6 {
+        t.Fatalf("First track not correct: (%f)", lengths[0])
+    } else if lengths[1] != 0 {
+        t.Fatalf("Second track not correct: (%f)", lengths[1])
+    }
+}
+
+func TestTrackLengths_TestData(t *testing.T) {
+    lengths, err := TrackLengths(bytes.NewBufferString(gpxreader.TestGpxData), Distance)
+    log.PanicIf(err)
+
+    points, err := gpxreader.ExtractTrackPoints(bytes.NewBufferString(gpxreader.TestGpxData))
+    log.PanicIf(err)
+
+    // There is only one track with one segment.
+    expected := PathLength(points, Distance)
+
+    if len(lengths) != 1 {
+        t.Fatalf("Track count not correct: (%d)", len(lengths))
+    } else if math.Abs(lengths[0]-expected) > 1e-6 {
+        t.Fatalf("Length not correct: (%f) != (%f)", lengths[0], expected)
+    }
+}
+
+func TestTrackLengths_Callback(t *testing.T) {
+    n := 0
+    counter := func(a, b *gpxcommon.TrackPoint) float64 {
+        n++
+        return 1
+    }
+
+    lengths, err := TrackLengths(bytes.NewBufferString(testLengthGpxData), counter)
+    log.PanicIf(err)
+
+    if n != 2 {
+        t.Fatalf("Distance calculated across segment boundary: (%d)", n)
+    } else if lengths[0] != 2 {
+        t.Fatalf("Length not correct: (%f)", lengths[0])
+    }
+}
@@ -0,0 +1,620 @@
+package gpxgeo
+
+import (
+    "container/heap"
+    "fmt"
+    "io"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/dsoprea/go-logging"
+
+    "github.com/dsoprea/go-gpx"
+    "github.com/dsoprea/go-gpx/reader"
+    "github.com/dsoprea/go-gpx/writer"
+)
+
+var (
+    // errMergeStopped stops the parse of a source that is no longer needed.
+    errMergeStopped = fmt.Errorf("merge stopped")
+)
+
+const (
+    // DefaultDedupeTime and DefaultDedupeDistance decide when a point is a
+    // duplicate of the point written before it (e.g. the same fix recorded
+    // by two devices).
+    DefaultDedupeTime     = time.Second
+    DefaultDedupeDistance = 5.0
+)
+
+// MergeOptions controls how the sources are combined.
+type MergeOptions struct {
+    // DedupeTime and DedupeDistance (meters) are how close in time and
+    // position a point has to be to the previous point to be dropped. A
+    // negative DedupeTime disables this.
+    DedupeTime     time.Duration
+    DedupeDistance float64
+
+    // PerSourceTracks writes the points of each source to their own track
+    // (in the order that the sources start) rather than interleaving them in
+    // one track.
+    PerSourceTracks bool
+
+    // Split decides where new segments are started. The zero value never
+    // starts one.
+    Split SplitOptions
+
+    // DistanceFunc defaults to Distance if not set.
+    DistanceFunc DistanceFunc
+}
+
+// DefaultMergeOptions returns the options used if none are given.
+func DefaultMergeOptions() MergeOptions {
+    return MergeOptions{
+        DedupeTime:     DefaultDedupeTime,
+        DedupeDistance: DefaultDedupeDistance,
+        Split:          DefaultSplitOptions(),
+        DistanceFunc:   Distance,
+    }
+}
+
+// mergeSource parses one input in its own goroutine and hands over its timed
+// points one at a time, so only one point per source is held in memory. The
+// metadata, the waypoints, and the first track are available once the first
+// point has been received (or the points are exhausted), since the schema
+// puts them ahead of the track points.
+type mergeSource struct {
+    index int
+
+    points chan gpxcommon.TrackPoint
+    done   chan struct{}
+    err    error
+
+    metadata  *gpxcommon.Metadata
+    waypoints []gpxcommon.Waypoint
+
+    currentTrack *gpxcommon.Track
+    firstTrack   *gpxcommon.Track
+
+    // current is the next point to be merged.
+    current gpxcommon.TrackPoint
+}
+
+func newMergeSource(index int, r io.Reader) *mergeSource {
+    ms := &mergeSource{
+        index:  index,
+        points: make(chan gpxcommon.TrackPoint),
+        done:   make(chan struct{}),
+    }
+
+    go func() {
+        defer close(ms.points)
+
+        gp := gpxreader.NewGpxParser(r, ms)
+        ms.err = gp.Parse()
+    }()
+
+    return ms
+}
+
+func (ms *mergeSource) MetadataOpen(md *gpxcommon.Metadata) error {
+    return nil
+}
+
+func (ms *mergeSource) MetadataClose(md *gpxcommon.Metadata) error {
+    ms.metadata = md
+    return nil
+}
+
+func (ms *mergeSource) WaypointOpen(w *gpxcommon.Waypoint) error {
+    return nil
+}
+
+func (ms *mergeSource) WaypointClose(w *gpxcommon.Waypoint) error {
+    ms.waypoints = append(ms.waypoints, *w)
+    return nil
+}
+
+func (ms *mergeSource) TrackOpen(t *gpxcommon.Track) error {
+    ms.currentTrack = t
+    return nil
+}
+
+func (ms *mergeSource) TrackClose(t *gpxcommon.Track) error {
+    return nil
+}
+
+func (ms *mergeSource) TrackPointOpen(tp *gpxcommon.TrackPoint) error {
+    return nil
+}
+
+func (ms *mergeSource) TrackPointClose(tp *gpxcommon.TrackPoint) error {
+    // Points without times can't be put in order.
+    if tp.Time.IsZero() == true {
+        return nil
+    }
+
+    if ms.firstTrack == nil && ms.currentTrack != nil {
+        copied := *ms.currentTrack
+        ms.firstTrack = &copied
+    }
+
+    select {
+    case ms.points <- *tp:
+        return nil
+    case <-ms.done:
+        return errMergeStopped
+    }
+}
+
+// next loads the next point into `current` and returns false when there are
+// no more.
+func (ms *mergeSource) next() (ok bool, err error) {
+    tp, ok := <-ms.points
+    if ok == false {
+        if ms.err != nil {
+            return false, ms.err
+        }
+
+        return false, nil
+    }
+
+    ms.current = tp
+
+    return true, nil
+}
+
+// stop ends the parse early and waits for the goroutine to finish.
+func (ms *mergeSource) stop() {
+    close(ms.done)
+
+    for range ms.points {
+    }
+}
+
+// mergeHeap orders the sources by their current point. Sources with points
+// at the same time are taken in the order given.
+type mergeHeap []*mergeSource
+
+func (mh mergeHeap) Len() int {
+    return len(mh)
+}
+
+func (mh mergeHeap) Less(i, j int) bool {
+    a := mh[i]
+    b := mh[j]
+
+    if a.current.Time.Equal(b.current.Time) == false {
+        return a.current.Time.Before(b.current.Time)
+    }
+
+    return a.index < b.index
+}
+
+func (mh mergeHeap) Swap(i, j int) {
+    mh[i], mh[j] = mh[j], mh[i]
+}
+
+func (mh *mergeHeap) Push(x interface{}) {
+    *mh = append(*mh, x.(*mergeSource))
+}
+
+func (mh *mergeHeap) Pop() interface{} {
+    old := *mh
+    n := len(old)
+
+    ms := old[n-1]
+    *mh = old[:n-1]
+
+    return ms
+}
+
+// MergeMetadata combines the metadata of several documents. The first name,
+// description, and author found are used, the links and keywords are unions,
+// and the time is the earliest. It returns nil if none of the documents had
+// metadata.
+func MergeMetadata(mds []*gpxcommon.Metadata) *gpxcommon.Metadata {
+    var merged *gpxcommon.Metadata
+
+    hrefs := make(map[string]struct{})
+    keywords := make([]string, 0)
+    seenKeywords := make(map[string]struct{})
+
+    for _, md := range mds {
+        if md == nil {
+            continue
+        }
+
+        if merged == nil {
+            merged = new(gpxcommon.Metadata)
+        }
+
+        if merged.Name == "" {
+            merged.Name = md.Name
+        }
+
+        if merged.Description == "" {
+            merged.Description = md.Description
+        }
+
+        if merged.AuthorName == "" {
+            merged.AuthorName = md.AuthorName
+        }
+
+        for _, link := range md.Links {
+            if _, found := hrefs[link.Href]; found == true {
+                continue
+            }
+
+            hrefs[link.Href] = struct{}{}
+            merged.Links = append(merged.Links, link)
+        }
+
+        if md.Time.IsZero() == false && (merged.Time.IsZero() == true || md.Time.Before(merged.Time) == true) {
+            merged.Time = md.Time
+        }
+
+        for _, keyword := range strings.Split(md.Keywords, ",") {
+            keyword = strings.TrimSpace(keyword)
+            if keyword == "" {
+                continue
+            }
+
+            if _, found := seenKeywords[keyword]; found == true {
+                continue
+            }
+
+            seenKeywords[keyword] = struct{}{}
+            keywords = append(keywords, keyword)
+        }
+    }
+
+    if merged != nil {
+        merged.Keywords = strings.Join(keywords, ", ")
+    }
+
+    return merged
+}
+
+// writeMetadata writes the metadata to a document that was just started.
+func writeMetadata(gb *gpxwriter.GpxBuilder, md *gpxcommon.Metadata) (err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    gmb := gb.Metadata()
+
+    gmb.Name = md.Name
+    gmb.Description = md.Description
+    gmb.AuthorName = md.AuthorName
+    gmb.Time = md.Time
+    gmb.Keywords = md.Keywords
+
+    for _, link := range md.Links {
+        gmb.Links = append(gmb.Links, gpxwriter.Link{Href: link.Href, Text: link.Text, Type: link.Type})
+    }
+
+    err = gmb.Write()
+    log.PanicIf(err)
+
+    return nil
+}
+
+// writeTrackInfo writes the name, description, and type of a track that was
+// just started.
+func writeTrackInfo(gtb *gpxwriter.GpxTrackBuilder, t *gpxcommon.Track) (err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    if t.Name != "" {
+        err := gtb.SetName(t.Name)
+        log.PanicIf(err)
+    }
+
+    if t.Description != "" {
+        err := gtb.SetDescription(t.Description)
+        log.PanicIf(err)
+    }
+
+    if t.Type != "" {
+        err := gtb.SetType(t.Type)
+        log.PanicIf(err)
+    }
+
+    return nil
+}
+
+// absDuration returns the magnitude of the duration.
+func absDuration(d time.Duration) time.Duration {
+    if d < 0 {
+        return -d
+    }
+
+    return d
+}
+
+// mergeWriter writes the merged points, starting tracks and segments as
+// needed and dropping duplicates.
+type mergeWriter struct {
+    options MergeOptions
+    df      DistanceFunc
+
+    gb   *gpxwriter.GpxBuilder
+    gtb  *gpxwriter.GpxTrackBuilder
+    gtsb *gpxwriter.GpxTrackSegmentBuilder
+
+    previous *gpxcommon.TrackPoint
+}
+
+// isDuplicate returns true if the point is too close to the one written
+// before it.
+func (mw *mergeWriter) isDuplicate(tp *gpxcommon.TrackPoint) bool {
+    if mw.previous == nil || mw.options.DedupeTime < 0 {
+        return false
+    }
+
+    if absDuration(tp.Time.Sub(mw.previous.Time)) > mw.options.DedupeTime {
+        return false
+    }
+
+    return mw.df(mw.previous, tp) <= mw.options.DedupeDistance
+}
+
+// startTrack starts a new track. The name, description, and type are taken
+// from `t` if not nil.
+func (mw *mergeWriter) startTrack(t *gpxcommon.Track) (err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    err = mw.endTrack()
+    log.PanicIf(err)
+
+    mw.gtb, err = mw.gb.Track()
+    log.PanicIf(err)
+
+    if t != nil {
+        err := writeTrackInfo(mw.gtb, t)
+        log.PanicIf(err)
+    }
+
+    mw.previous = nil
+
+    return nil
+}
+
+// endTrack closes the current track, if any.
+func (mw *mergeWriter) endTrack() (err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    if mw.gtsb != nil {
+        err := mw.gtsb.EndTrackSegment()
+        log.PanicIf(err)
+
+        mw.gtsb = nil
+    }
+
+    if mw.gtb != nil {
+        err := mw.gtb.EndTrack()
+        log.PanicIf(err)
+
+        mw.gtb = nil
+    }
+
+    return nil
+}
+
+func (mw *mergeWriter) write(tp *gpxcommon.TrackPoint) (err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    if mw.isDuplicate(tp) == true {
+        return nil
+    }
+
+    if mw.gtsb != nil && mw.previous != nil && mw.options.Split.IsBreak(mw.previous, tp) == true {
+        err := mw.gtsb.EndTrackSegment()
+        log.PanicIf(err)
+
+        mw.gtsb = nil
+    }
+
+    if mw.gtsb == nil {
+        mw.gtsb, err = mw.gtb.TrackSegment()
+        log.PanicIf(err)
+    }
+
+    gtpb := mw.gtsb.TrackPoint()
+    gtpb.SetTrackPoint(tp)
+
+    err = gtpb.Write()
+    log.PanicIf(err)
+
+    copied := *tp
+    mw.previous = &copied
+
+    return nil
+}
+
+// writeWaypoints writes the union of the waypoints. A waypoint with the same
+// name as one already written and within the dedupe distance of it is
+// dropped.
+func (mw *mergeWriter) writeWaypoints(waypoints []gpxcommon.Waypoint) (err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    written := make([]gpxcommon.Waypoint, 0)
+
+    for _, w := range waypoints {
+        a := gpxcommon.TrackPoint{LatitudeDecimal: w.LatitudeDecimal, LongitudeDecimal: w.LongitudeDecimal}
+
+        duplicate := false
+        for _, other := range written {
+            b := gpxcommon.TrackPoint{LatitudeDecimal: other.LatitudeDecimal, LongitudeDecimal: other.LongitudeDecimal}
+
+            if other.Name == w.Name && mw.df(&a, &b) <= mw.options.DedupeDistance {
+                duplicate = true
+                break
+            }
+        }
+
+        if duplicate == true {
+            continue
+        }
+
+        gwb := mw.gb.Waypoint()
+        gwb.SetWaypoint(&w)
+
+        err := gwb.Write()
+        log.PanicIf(err)
+
+        written = append(written, w)
+    }
+
+    return nil
+}
+
+// Merge writes the track points of all of the sources to the builder in
+// chronological order. Each source is assumed to already be in order. Points
+// without times are dropped, as are points that duplicate the point before
+// them. The metadata and waypoints of the sources are combined and written
+// first (the waypoints are held in memory to do this). Otherwise, only one
+// point per source is held in memory at a time. The document is closed when
+// done.
+func Merge(sources []io.Reader, b *gpxwriter.Builder, options MergeOptions) (err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    df := options.DistanceFunc
+    if df == nil {
+        df = Distance
+    }
+
+    all := make([]*mergeSource, len(sources))
+    for i, r := range sources {
+        all[i] = newMergeSource(i, r)
+    }
+
+    defer func() {
+        for _, ms := range all {
+            ms.stop()
+        }
+    }()
+
+    // Load the first point of every source. This also makes their metadata
+    // and waypoints available.
+
+    mh := make(mergeHeap, 0, len(all))
+    for _, ms := range all {
+        ok, err := ms.next()
+        log.PanicIf(err)
+
+        if ok == true {
+            mh = append(mh, ms)
+        }
+    }
+
+    heap.Init(&mh)
+
+    mds := make([]*gpxcommon.Metadata, len(all))
+    waypoints := make([]gpxcommon.Waypoint, 0)
+
+    for i, ms := range all {
+        mds[i] = ms.metadata
+        waypoints = append(waypoints, ms.waypoints...)
+    }
+
+    gb, err := b.Gpx()
+    log.PanicIf(err)
+
+    mw := &mergeWriter{
+        options: options,
+        df:      df,
+        gb:      gb,
+    }
+
+    if md := MergeMetadata(mds); md != nil {
+        err := writeMetadata(gb, md)
+        log.PanicIf(err)
+    }
+
+    err = mw.writeWaypoints(waypoints)
+    log.PanicIf(err)
+
+    if options.PerSourceTracks == true {
+        // Write the sources one after the other, in the order that they
+        // start. The others wait on their first point.
+
+        started := make([]*mergeSource, len(mh))
+        copy(started, mh)
+
+        sort.Slice(started, func(i, j int) bool {
+            return mergeHeap(started).Less(i, j)
+        })
+
+        for _, ms := range started {
+            err := mw.startTrack(ms.firstTrack)
+            log.PanicIf(err)
+
+            for {
+                err := mw.write(&ms.current)
+                log.PanicIf(err)
+
+                ok, err := ms.next()
+                log.PanicIf(err)
+
+                if ok == false {
+                    break
+                }
+            }
+        }
+    } else if len(mh) > 0 {
+        err := mw.startTrack(nil)
+        log.PanicIf(err)
+
+        for len(mh) > 0 {
+            ms := mh[0]
+
+            err := mw.write(&ms.current)
+            log.PanicIf(err)
+
+            ok, err := ms.next()
+            log.PanicIf(err)
+
+            if ok == true {
+                heap.Fix(&mh, 0)
+            } else {
+                heap.Pop(&mh)
+            }
+        }
+    }
+
+    err = mw.endTrack()
+    log.PanicIf(err)
+
+    err = gb.EndGpx()
+    log.PanicIf(err)
+
+    return nil
+}
@@ -0,0 +1,134 @@
+package gpxgeo
+
+import (
+    "bytes"
+    "io"
+    "strings"
+    "testing"
+
+    "github.com/dsoprea/go-logging"
+
+    "github.com/dsoprea/go-gpx"
+    "github.com/dsoprea/go-gpx/writer"
+)
+
+const (
+    testMergeGpxDataA = `<?xml version="1.0" encoding="UTF-8" ?><gpx version="1.1" creator="a" xmlns="http://www.topografix.com/GPX/1/1">
+<metadata><name>Trip</name><link href="http://example.com/trip"></link><time>2016-12-02T09:00:00Z</time><keywords>walk, city</keywords></metadata>
+<wpt lat="47.2" lon="-122.2"><name>Cafe</name></wpt>
+<trk><name>Watch</name><trkseg>
+<trkpt lat="47.1" lon="-122.1"><time>2016-12-02T08:00:00Z</time></trkpt>
+<trkpt lat="47.102" lon="-122.1"><time>2016-12-02T08:02:00Z</time></trkpt>
+<trkpt lat="47.104" lon="-122.1"><time>2016-12-02T08:04:00Z</time></trkpt>
+</trkseg></trk></gpx>`
+
+    testMergeGpxDataB = `<?xml version="1.0" encoding="UTF-8" ?><gpx version="1.1" creator="b" xmlns="http://www.topografix.com/GPX/1/1">
+<metadata><author><name>Someone</name></author><link href="http://example.com/trip"></link><link href="http://example.com/photos"></link><time>2016-12-02T08:30:00Z</time><keywords>city,park</keywords></metadata>
+<wpt lat="47.20001" lon="-122.2"><name>Cafe</name></wpt>
+<wpt lat="47.3" lon="-122.3"><name>Park</name></wpt>
+<trk><name>Phone</name><trkseg>
+<trkpt lat="47.101" lon="-122.1"><time>2016-12-02T08:01:00Z</time></trkpt>
+<trkpt lat="47.10201" lon="-122.1"><time>2016-12-02T08:02:00Z</time></trkpt>
+<trkpt lat="47.103" lon="-122.1"></trkpt>
+<trkpt lat="47.105" lon="-122.1"><time>2016-12-02T08:05:00Z</time></trkpt>
+</trkseg></trk></gpx>`
+)
+
+func mergeTestData(options MergeOptions, data ...string) (output string, err error) {
+    sources := make([]io.Reader, len(data))
+    for i, s := range data {
+        sources[i] = bytes.NewBufferString(s)
+    }
+
+    buffer := new(bytes.Buffer)
+
+    b, err := gpxwriter.NewBuilder(buffer)
+    log.PanicIf(err)
+
+    err = Merge(sources, b, options)
+
+    return buffer.String(), err
+}
+
+// assertInOrder fails if the phrases don't appear in the given order.
+func assertInOrder(t *testing.T, s string, phrases ...string) {
+    last := -1
+    for _, phrase := range phrases {
+        i := strings.Index(s, phrase)
+        if i == -1 || i < last {
+            t.Fatalf("[%s] not found in order:\n%s", phrase, s)
+        }
+
+        last = i
+    }
+}
+
+func TestMerge(t *testing.T) {
+    s, err := mergeTestData(DefaultMergeOptions(), testMergeGpxDataB, testMergeGpxDataA)
+    log.PanicIf(err)
+
+    if count := strings.Count(s, "<trk>"); count != 1 {
+        t.Fatalf("Track count not correct: (%d)\n%s", count, s)
+    } else if count := strings.Count(s, "<trkpt "); count != 5 {
+        t.Fatalf("Point count not correct: (%d)\n%s", count, s)
+    } else if count := strings.Count(s, "<wpt "); count != 2 {
+        t.Fatalf("Waypoint count not correct: (%d)\n%s", count, s)
+    }
+
+    assertInOrder(t, s, "T08:00:00", "T08:01:00", "T08:02:00", "T08:04:00", "T08:05:00")
+
+    // Both sources have a point at 08:02. The one from the source given first
+    // is kept.
+    if strings.Contains(s, `lat="47.102"`) == true || strings.Contains(s, `lat="47.10201"`) == false {
+        t.Fatalf("Duplicate point not dropped:\n%s", s)
+    }
+
+    if strings.Contains(s, "<keywords>city, park, walk</keywords>") == false {
+        t.Fatalf("Keywords not merged:\n%s", s)
+    } else if strings.Count(s, "<link ") != 2 || strings.Contains(s, "<name>Someone</name>") == false {
+        t.Fatalf("Metadata not merged:\n%s", s)
+    }
+}
+
+func TestMerge_PerSourceTracks(t *testing.T) {
+    options := DefaultMergeOptions()
+    options.PerSourceTracks = true
+
+    s, err := mergeTestData(options, testMergeGpxDataB, testMergeGpxDataA)
+    log.PanicIf(err)
+
+    if count := strings.Count(s, "<trk>"); count != 2 {
+        t.Fatalf("Track count not correct: (%d)\n%s", count, s)
+    } else if count := strings.Count(s, "<trkpt "); count != 6 {
+        t.Fatalf("Point count not correct: (%d)\n%s", count, s)
+    }
+
+    // The first source to start is written first.
+    assertInOrder(t, s, "<name>Watch</name>", "T08:04:00", "<name>Phone</name>", "T08:05:00")
+}
+
+func TestMerge_SourceError(t *testing.T) {
+    broken := strings.Replace(testMergeGpxDataB, "2016-12-02T08:05:00Z", "not a time", 1)
+
+    _, err := mergeTestData(DefaultMergeOptions(), testMergeGpxDataA, broken)
+    if err == nil {
+        t.Fatalf("Expected error for broken source.")
+    }
+}
+
+func TestMergeMetadata(t *testing.T) {
+    mds := []*gpxcommon.Metadata{
+        nil,
+        {Keywords: "a,b"},
+        {Name: "Trip", Keywords: "b, c"},
+    }
+
+    md := MergeMetadata(mds)
+    if md == nil || md.Name != "Trip" || md.Keywords != "a, b, c" {
+        t.Fatalf("Metadata not correct: %v", md)
+    }
+
+    if MergeMetadata([]*gpxcommon.Metadata{nil}) != nil {
+        t.Fatalf("Expected no metadata.")
+    }
+}
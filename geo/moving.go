@@ -0,0 +1,270 @@
+package gpxgeo
+
+import (
+    "io"
+    "time"
+
+    "github.com/dsoprea/go-logging"
+
+    "github.com/dsoprea/go-gpx"
+    "github.com/dsoprea/go-gpx/reader"
+)
+
+const (
+    // DefaultStoppedSpeedThreshold is one kilometer per hour, in meters per
+    // second.
+    DefaultStoppedSpeedThreshold = 1000.0 / 3600.0
+
+    // DefaultMaxSpeedWindow rejects a single bad fix, which produces two fast
+    // intervals (going there and coming back).
+    DefaultMaxSpeedWindow = 3
+)
+
+// MovingDataOptions controls how intervals are classified.
+type MovingDataOptions struct {
+    // StoppedSpeedThreshold is the speed (m/s) below which an interval is
+    // considered stopped.
+    StoppedSpeedThreshold float64
+
+    // MaxSpeedWindow is the number of consecutive intervals that a speed has
+    // to be sustained over in order to count toward the maximum speed. This
+    // keeps spikes from jittery fixes out of the maximum. Segments with fewer
+    // intervals than this don't contribute to the maximum at all since a
+    // spike can't be told apart in them. One disables this.
+    MaxSpeedWindow int
+
+    // MaxPlausibleSpeed is the speed (m/s) above which an interval is
+    // considered an error and ignored completely. Zero disables this.
+    MaxPlausibleSpeed float64
+
+    // DistanceFunc defaults to Distance if not set.
+    DistanceFunc DistanceFunc
+}
+
+// DefaultMovingDataOptions returns the options used if none are given.
+func DefaultMovingDataOptions() MovingDataOptions {
+    return MovingDataOptions{
+        StoppedSpeedThreshold: DefaultStoppedSpeedThreshold,
+        MaxSpeedWindow:        DefaultMaxSpeedWindow,
+        DistanceFunc:          Distance,
+    }
+}
+
+// movingDataCalculator accumulates the moving-data for one segment at a time.
+// Only the last few interval speeds are retained.
+type movingDataCalculator struct {
+    options MovingDataOptions
+
+    md       gpxcommon.MovingData
+    previous *gpxcommon.TrackPoint
+
+    // window has the speeds of the most-recent intervals.
+    window []float64
+}
+
+func newMovingDataCalculator(options MovingDataOptions) *movingDataCalculator {
+    if options.DistanceFunc == nil {
+        options.DistanceFunc = Distance
+    }
+
+    if options.MaxSpeedWindow < 1 {
+        options.MaxSpeedWindow = 1
+    }
+
+    return &movingDataCalculator{
+        options: options,
+        window:  make([]float64, 0, options.MaxSpeedWindow),
+    }
+}
+
+// reset starts a new segment.
+func (mdc *movingDataCalculator) reset() {
+    mdc.md = gpxcommon.MovingData{}
+    mdc.previous = nil
+    mdc.window = mdc.window[:0]
+}
+
+// add processes the next point in the segment. Points without timestamps are
+// skipped.
+func (mdc *movingDataCalculator) add(tp *gpxcommon.TrackPoint) {
+    if tp.Time.IsZero() == true {
+        return
+    }
+
+    current := *tp
+    previous := mdc.previous
+    mdc.previous = &current
+
+    if previous == nil {
+        return
+    }
+
+    duration := current.Time.Sub(previous.Time)
+    distance := mdc.options.DistanceFunc(previous, &current)
+
+    mdc.addInterval(duration, distance)
+}
+
+// addInterval processes an interval whose distance was already calculated.
+// Intervals that do not move forward in time are ignored.
+func (mdc *movingDataCalculator) addInterval(duration time.Duration, distance float64) {
+    if duration <= 0 {
+        return
+    }
+
+    speed := distance / duration.Seconds()
+
+    if mdc.options.MaxPlausibleSpeed > 0 && speed > mdc.options.MaxPlausibleSpeed {
+        return
+    }
+
+    if speed < mdc.options.StoppedSpeedThreshold {
+        mdc.md.StoppedTime += duration
+        mdc.md.StoppedDistance += distance
+    } else {
+        mdc.md.MovingTime += duration
+        mdc.md.MovingDistance += distance
+    }
+
+    if len(mdc.window) == mdc.options.MaxSpeedWindow {
+        copy(mdc.window, mdc.window[1:])
+        mdc.window = mdc.window[:len(mdc.window)-1]
+    }
+
+    mdc.window = append(mdc.window, speed)
+
+    if len(mdc.window) == mdc.options.MaxSpeedWindow {
+        mdc.updateMaxSpeed()
+    }
+}
+
+// updateMaxSpeed applies the slowest speed in the window.
+func (mdc *movingDataCalculator) updateMaxSpeed() {
+    sustained := mdc.window[0]
+    for _, speed := range mdc.window[1:] {
+        if speed < sustained {
+            sustained = speed
+        }
+    }
+
+    if sustained > mdc.md.MaxSpeed {
+        mdc.md.MaxSpeed = sustained
+    }
+}
+
+// result returns the moving-data for the segment. Short segments never fill
+// the window and so have no max speed.
+func (mdc *movingDataCalculator) result() gpxcommon.MovingData {
+    return mdc.md
+}
+
+// mergeMovingData adds the moving-data of a part to that of the whole.
+func mergeMovingData(whole *gpxcommon.MovingData, part gpxcommon.MovingData) {
+    whole.MovingTime += part.MovingTime
+    whole.StoppedTime += part.StoppedTime
+    whole.MovingDistance += part.MovingDistance
+    whole.StoppedDistance += part.StoppedDistance
+
+    if part.MaxSpeed > whole.MaxSpeed {
+        whole.MaxSpeed = part.MaxSpeed
+    }
+}
+
+// SegmentMovingData returns the moving-data for a single segment.
+func SegmentMovingData(points []gpxcommon.TrackPoint, options MovingDataOptions) gpxcommon.MovingData {
+    mdc := newMovingDataCalculator(options)
+
+    for i := range points {
+        mdc.add(&points[i])
+    }
+
+    return mdc.result()
+}
+
+// TrackMovingData has the moving-data for a track and each of its segments.
+type TrackMovingData struct {
+    Total    gpxcommon.MovingData
+    Segments []gpxcommon.MovingData
+}
+
+// MovingDataBreakdown has the moving-data for a file and each of its tracks.
+type MovingDataBreakdown struct {
+    Total  gpxcommon.MovingData
+    Tracks []TrackMovingData
+}
+
+// movingDataVisitor builds a breakdown while the document is parsed.
+type movingDataVisitor struct {
+    mdc *movingDataCalculator
+    mdb *MovingDataBreakdown
+}
+
+func (mdv *movingDataVisitor) TrackOpen(t *gpxcommon.Track) error {
+    tmd := TrackMovingData{
+        Segments: make([]gpxcommon.MovingData, 0),
+    }
+
+    mdv.mdb.Tracks = append(mdv.mdb.Tracks, tmd)
+
+    return nil
+}
+
+func (mdv *movingDataVisitor) TrackClose(t *gpxcommon.Track) error {
+    tmd := mdv.mdb.Tracks[len(mdv.mdb.Tracks)-1]
+    mergeMovingData(&mdv.mdb.Total, tmd.Total)
+
+    return nil
+}
+
+func (mdv *movingDataVisitor) TrackSegmentOpen(ts *gpxcommon.TrackSegment) error {
+    mdv.mdc.reset()
+
+    return nil
+}
+
+func (mdv *movingDataVisitor) TrackSegmentClose(ts *gpxcommon.TrackSegment) error {
+    md := mdv.mdc.result()
+
+    tmd := &mdv.mdb.Tracks[len(mdv.mdb.Tracks)-1]
+    tmd.Segments = append(tmd.Segments, md)
+    mergeMovingData(&tmd.Total, md)
+
+    return nil
+}
+
+func (mdv *movingDataVisitor) TrackPointOpen(tp *gpxcommon.TrackPoint) error {
+    return nil
+}
+
+func (mdv *movingDataVisitor) TrackPointClose(tp *gpxcommon.TrackPoint) error {
+    mdv.mdc.add(tp)
+
+    return nil
+}
+
+// CalculateMovingData streams the GPX data and returns the moving-data for
+// every segment, every track, and the whole file. Intervals are never formed
+// across segment boundaries.
+func CalculateMovingData(r io.Reader, options MovingDataOptions) (mdb *MovingDataBreakdown, err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    mdb = &MovingDataBreakdown{
+        Tracks: make([]TrackMovingData, 0),
+    }
+
+    mdv := &movingDataVisitor{
+        mdc: newMovingDataCalculator(options),
+        mdb: mdb,
+    }
+
+    gp := gpxreader.NewGpxParser(r, mdv)
+
+    err = gp.Parse()
+    log.PanicIf(err)
+
+    return mdb, nil
+}
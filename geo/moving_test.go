@@ -0,0 +1,157 @@
+package gpxgeo
+
+import (
+    "bytes"
+    "math"
+    "testing"
+    "time"
+
+    "github.com/dsoprea/go-logging"
+
+    "github.com/dsoprea/go-gpx"
+    "github.com/dsoprea/go-gpx/reader"
+)
+
+// getMovingTestPoints returns three moving intervals, two stopped intervals,
+// a bad fix (two very fast intervals), and one more stopped interval, all a
+// minute apart.
+func getMovingTestPoints() []gpxcommon.TrackPoint {
+    longitudes := []float64{0, 0.001, 0.002, 0.003, 0.003, 0.003, 0.1, 0.003, 0.003}
+
+    epoch := time.Date(2016, 12, 2, 8, 0, 0, 0, time.UTC)
+    points := make([]gpxcommon.TrackPoint, len(longitudes))
+
+    for i, longitude := range longitudes {
+        points[i] = gpxcommon.TrackPoint{
+            LongitudeDecimal: longitude,
+            Time:             epoch.Add(time.Duration(i) * time.Minute),
+        }
+    }
+
+    return points
+}
+
+func TestSegmentMovingData(t *testing.T) {
+    points := getMovingTestPoints()
+    md := SegmentMovingData(points, DefaultMovingDataOptions())
+
+    step := Distance(&points[0], &points[1])
+    spike := Distance(&points[5], &points[6]) + Distance(&points[6], &points[7])
+
+    if md.MovingTime != 5*time.Minute {
+        t.Fatalf("Moving time not correct: %s", &md)
+    } else if md.StoppedTime != 3*time.Minute {
+        t.Fatalf("Stopped time not correct: %s", &md)
+    } else if math.Abs(md.MovingDistance-(3*step+spike)) > 1e-6 {
+        t.Fatalf("Moving distance not correct: %s", &md)
+    } else if md.StoppedDistance != 0 {
+        t.Fatalf("Stopped distance not correct: %s", &md)
+    } else if math.Abs(md.MaxSpeed-step/60) > 1e-6 {
+        t.Fatalf("Spike not rejected from max speed: %s", &md)
+    }
+}
+
+func TestSegmentMovingData_NoWindow(t *testing.T) {
+    points := getMovingTestPoints()
+
+    options := DefaultMovingDataOptions()
+    options.MaxSpeedWindow = 1
+
+    md := SegmentMovingData(points, options)
+
+    expected := Distance(&points[5], &points[6]) / 60
+    if math.Abs(md.MaxSpeed-expected) > 1e-6 {
+        t.Fatalf("Max speed not correct: %s", &md)
+    }
+}
+
+func TestSegmentMovingData_MaxPlausibleSpeed(t *testing.T) {
+    points := getMovingTestPoints()
+
+    options := DefaultMovingDataOptions()
+    options.MaxPlausibleSpeed = 50
+
+    md := SegmentMovingData(points, options)
+
+    step := Distance(&points[0], &points[1])
+
+    if md.MovingTime != 3*time.Minute {
+        t.Fatalf("Moving time not correct: %s", &md)
+    } else if md.StoppedTime != 3*time.Minute {
+        t.Fatalf("Stopped time not correct: %s", &md)
+    } else if math.Abs(md.MovingDistance-3*step) > 1e-6 {
+        t.Fatalf("Moving distance not correct: %s", &md)
+    }
+}
+
+func TestSegmentMovingData_Short(t *testing.T) {
+    // Only the bad fix and the points on either side of it.
+    points := getMovingTestPoints()[5:8]
+    md := SegmentMovingData(points, DefaultMovingDataOptions())
+
+    if md.MaxSpeed != 0 {
+        t.Fatalf("Spike in short segment used as max speed: %s", &md)
+    } else if md.MovingTime != 2*time.Minute {
+        t.Fatalf("Moving time not correct for short segment: %s", &md)
+    }
+
+    // Without a window, the segment is used.
+    options := DefaultMovingDataOptions()
+    options.MaxSpeedWindow = 1
+
+    md = SegmentMovingData(points, options)
+
+    expected := Distance(&points[0], &points[1]) / 60
+    if math.Abs(md.MaxSpeed-expected) > 1e-6 {
+        t.Fatalf("Max speed not correct for short segment: %s", &md)
+    }
+}
+
+func TestCalculateMovingData(t *testing.T) {
+    mdb, err := CalculateMovingData(bytes.NewBufferString(testLengthGpxData), DefaultMovingDataOptions())
+    log.PanicIf(err)
+
+    if len(mdb.Tracks) != 2 {
+        t.Fatalf("Track count not correct: (%d)", len(mdb.Tracks))
+    } else if len(mdb.Tracks[0].Segments) != 2 {
+        t.Fatalf("Segment count not correct: (%d)", len(mdb.Tracks[0].Segments))
+    } else if len(mdb.Tracks[1].Segments) != 1 {
+        t.Fatalf("Segment count not correct: (%d)", len(mdb.Tracks[1].Segments))
+    }
+
+    // The hour between the segments must not be counted.
+    if mdb.Tracks[0].Total.MovingTime != 2*time.Minute {
+        t.Fatalf("Track moving time not correct: %s", &mdb.Tracks[0].Total)
+    } else if mdb.Total.MovingTime != 2*time.Minute || mdb.Total.StoppedTime != 0 {
+        t.Fatalf("File moving data not correct: %s", &mdb.Total)
+    }
+
+    first := mdb.Tracks[0].Segments[0].MaxSpeed
+    second := mdb.Tracks[0].Segments[1].MaxSpeed
+
+    if mdb.Tracks[0].Total.MaxSpeed != math.Max(first, second) {
+        t.Fatalf("Track max speed not correct: %s", &mdb.Tracks[0].Total)
+    }
+}
+
+func TestCalculateMovingData_TestData(t *testing.T) {
+    options := DefaultMovingDataOptions()
+
+    mdb, err := CalculateMovingData(bytes.NewBufferString(gpxreader.TestGpxData), options)
+    log.PanicIf(err)
+
+    points, err := gpxreader.ExtractTrackPoints(bytes.NewBufferString(gpxreader.TestGpxData))
+    log.PanicIf(err)
+
+    expected := SegmentMovingData(points, options)
+
+    if mdb.Total != expected {
+        t.Fatalf("File moving data not correct: %s != %s", &mdb.Total, &expected)
+    }
+
+    // Every interval is either moving or stopped.
+    elapsed := points[len(points)-1].Time.Sub(points[0].Time)
+    if mdb.Total.MovingTime+mdb.Total.StoppedTime != elapsed {
+        t.Fatalf("Times do not add up: %s", &mdb.Total)
+    }
+}
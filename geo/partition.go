@@ -0,0 +1,396 @@
+package gpxgeo
+
+import (
+    "io"
+    "os"
+    "time"
+
+    "github.com/dsoprea/go-logging"
+
+    "github.com/dsoprea/go-gpx"
+    "github.com/dsoprea/go-gpx/pipe"
+    "github.com/dsoprea/go-gpx/writer"
+)
+
+// PartitionOptions decides where a file is split into parts. A new part is
+// started before any point that would exceed one of the limits. Zero (or
+// false) disables a limit.
+type PartitionOptions struct {
+    // ByDay starts a new part whenever the date changes in Location (UTC if
+    // not set).
+    ByDay    bool
+    Location *time.Location
+
+    // MaxDuration is the longest time from the first to the last point of a
+    // part.
+    MaxDuration time.Duration
+
+    // MaxDistance is the longest distance (meters) covered by the segments of
+    // a part.
+    MaxDistance float64
+
+    // MaxPoints is the most points that a part can have.
+    MaxPoints int
+
+    // DistanceFunc defaults to Distance if not set.
+    DistanceFunc DistanceFunc
+}
+
+// PartOpener returns the writer for the part with the given index (from
+// zero). `first` is the first point that will be written to it. The writer is
+// closed once the part is complete.
+type PartOpener func(index int, first *gpxcommon.TrackPoint) (w io.WriteCloser, err error)
+
+// PartNamer returns the file-path for the part with the given index (from
+// zero). `first` is the first point that will be written to it.
+type PartNamer func(index int, first *gpxcommon.TrackPoint) string
+
+// partitioner receives the elements of the input and writes them to the
+// current part, starting a new one whenever a limit is reached.
+type partitioner struct {
+    opener  PartOpener
+    options PartitionOptions
+    df      DistanceFunc
+
+    metadata  *gpxcommon.Metadata
+    waypoints []gpxcommon.Waypoint
+    track     *gpxcommon.Track
+
+    count int
+    w     io.WriteCloser
+    gb    *gpxwriter.GpxBuilder
+    gtb   *gpxwriter.GpxTrackBuilder
+    gtsb  *gpxwriter.GpxTrackSegmentBuilder
+
+    // The following describe the current part.
+    points   int
+    start    time.Time
+    day      time.Time
+    distance float64
+
+    // previous is the last point of the current segment.
+    previous *gpxcommon.TrackPoint
+}
+
+// dayOf returns midnight of the date of `t` in the configured location.
+func (p *partitioner) dayOf(t time.Time) time.Time {
+    location := p.options.Location
+    if location == nil {
+        location = time.UTC
+    }
+
+    t = t.In(location)
+
+    return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, location)
+}
+
+// isBreak returns true if a new part has to be started before the point.
+// Points without times only count towards the point and distance limits.
+func (p *partitioner) isBreak(tp *gpxcommon.TrackPoint) bool {
+    if p.gb == nil || p.points == 0 {
+        return false
+    }
+
+    options := p.options
+
+    if options.MaxPoints > 0 && p.points >= options.MaxPoints {
+        return true
+    }
+
+    if tp.Time.IsZero() == false && p.start.IsZero() == false {
+        if options.ByDay == true && p.dayOf(tp.Time).Equal(p.day) == false {
+            return true
+        }
+
+        if options.MaxDuration > 0 && tp.Time.Sub(p.start) > options.MaxDuration {
+            return true
+        }
+    }
+
+    if options.MaxDistance > 0 && p.previous != nil && p.distance+p.df(p.previous, tp) > options.MaxDistance {
+        return true
+    }
+
+    return false
+}
+
+// open starts the next part and writes the metadata and waypoints to it.
+func (p *partitioner) open(first *gpxcommon.TrackPoint) (err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    w, err := p.opener(p.count, first)
+    log.PanicIf(err)
+
+    p.w = w
+    p.count++
+
+    b, err := gpxwriter.NewBuilder(w)
+    log.PanicIf(err)
+
+    p.gb, err = b.Gpx()
+    log.PanicIf(err)
+
+    if p.metadata != nil {
+        err := writeMetadata(p.gb, p.metadata)
+        log.PanicIf(err)
+    }
+
+    for i := range p.waypoints {
+        gwb := p.gb.Waypoint()
+        gwb.SetWaypoint(&p.waypoints[i])
+
+        err := gwb.Write()
+        log.PanicIf(err)
+    }
+
+    p.points = 0
+    p.start = time.Time{}
+    p.day = time.Time{}
+    p.distance = 0
+    p.previous = nil
+
+    return nil
+}
+
+// endSegment closes the current segment of the part, if any.
+func (p *partitioner) endSegment() (err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    if p.gtsb != nil {
+        err := p.gtsb.EndTrackSegment()
+        log.PanicIf(err)
+
+        p.gtsb = nil
+    }
+
+    return nil
+}
+
+// endTrack closes the current track of the part, if any.
+func (p *partitioner) endTrack() (err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    err = p.endSegment()
+    log.PanicIf(err)
+
+    if p.gtb != nil {
+        err := p.gtb.EndTrack()
+        log.PanicIf(err)
+
+        p.gtb = nil
+    }
+
+    return nil
+}
+
+// close completes the current part, if any.
+func (p *partitioner) close() (err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    if p.gb == nil {
+        return nil
+    }
+
+    err = p.endTrack()
+    log.PanicIf(err)
+
+    err = p.gb.EndGpx()
+    log.PanicIf(err)
+
+    p.gb = nil
+
+    w := p.w
+    p.w = nil
+
+    err = w.Close()
+    log.PanicIf(err)
+
+    return nil
+}
+
+// abandon closes the writer of the current part after a failure.
+func (p *partitioner) abandon() {
+    if p.w != nil {
+        p.w.Close()
+        p.w = nil
+    }
+}
+
+// write writes the point, starting a new part, track, or segment first as
+// needed. Tracks and segments that are split across parts are continued (with
+// the same track information) in the next part.
+func (p *partitioner) write(tp *gpxcommon.TrackPoint) (err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    if p.isBreak(tp) == true {
+        // The distance from the last point of the previous part isn't
+        // counted in either part.
+        err := p.close()
+        log.PanicIf(err)
+    }
+
+    if p.gb == nil {
+        err := p.open(tp)
+        log.PanicIf(err)
+    }
+
+    if p.gtb == nil {
+        p.gtb, err = p.gb.Track()
+        log.PanicIf(err)
+
+        if p.track != nil {
+            err := writeTrackInfo(p.gtb, p.track)
+            log.PanicIf(err)
+        }
+    }
+
+    if p.gtsb == nil {
+        p.gtsb, err = p.gtb.TrackSegment()
+        log.PanicIf(err)
+    }
+
+    gtpb := p.gtsb.TrackPoint()
+    gtpb.SetTrackPoint(tp)
+
+    err = gtpb.Write()
+    log.PanicIf(err)
+
+    if p.previous != nil {
+        p.distance += p.df(p.previous, tp)
+    }
+
+    if tp.Time.IsZero() == false && p.start.IsZero() == true {
+        p.start = tp.Time
+        p.day = p.dayOf(tp.Time)
+    }
+
+    p.points++
+
+    copied := *tp
+    p.previous = &copied
+
+    return nil
+}
+
+func (p *partitioner) emit(e gpxpipe.Element) (err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    switch e.Type {
+    case gpxpipe.ElementMetadata:
+        copied := *e.Metadata
+        p.metadata = &copied
+    case gpxpipe.ElementWaypoint:
+        p.waypoints = append(p.waypoints, *e.Waypoint)
+    case gpxpipe.ElementTrackOpen:
+        p.track = nil
+
+        if e.Track != nil {
+            copied := *e.Track
+            p.track = &copied
+        }
+    case gpxpipe.ElementTrackClose:
+        err := p.endTrack()
+        log.PanicIf(err)
+
+        p.track = nil
+    case gpxpipe.ElementSegmentOpen:
+        p.previous = nil
+    case gpxpipe.ElementSegmentClose:
+        err := p.endSegment()
+        log.PanicIf(err)
+
+        p.previous = nil
+    case gpxpipe.ElementPoint:
+        err := p.write(e.Point)
+        log.PanicIf(err)
+    }
+
+    return nil
+}
+
+// Partition streams the GPX data into as many documents as the options
+// require, using `opener` to get the writer for each. The metadata and the
+// waypoints are written to every part and the tracks and segments are kept
+// (and continued in the next part where they are split). Tracks and segments
+// without points are not written. It returns the number of parts.
+func Partition(r io.Reader, opener PartOpener, options PartitionOptions) (count int, err error) {
+    df := options.DistanceFunc
+    if df == nil {
+        df = Distance
+    }
+
+    p := &partitioner{
+        opener:  opener,
+        options: options,
+        df:      df,
+    }
+
+    defer func() {
+        if state := recover(); state != nil {
+            p.abandon()
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    err = gpxpipe.NewPipeline().Enumerate(r, p.emit)
+    log.PanicIf(err)
+
+    err = p.close()
+    log.PanicIf(err)
+
+    return p.count, nil
+}
+
+// PartitionFile is Partition with each part written to the file named by
+// `namer`. It returns the file-paths of the parts.
+func PartitionFile(r io.Reader, namer PartNamer, options PartitionOptions) (filepaths []string, err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    filepaths = make([]string, 0)
+
+    opener := func(index int, first *gpxcommon.TrackPoint) (w io.WriteCloser, err error) {
+        filepath := namer(index, first)
+
+        f, err := os.Create(filepath)
+        if err != nil {
+            return nil, err
+        }
+
+        filepaths = append(filepaths, filepath)
+
+        return f, nil
+    }
+
+    _, err = Partition(r, opener, options)
+    log.PanicIf(err)
+
+    return filepaths, nil
+}
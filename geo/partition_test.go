@@ -0,0 +1,143 @@
+package gpxgeo
+
+import (
+    "bytes"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "os"
+    "path"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/dsoprea/go-logging"
+
+    "github.com/dsoprea/go-gpx"
+)
+
+// The points are about 1.1 kilometers apart and cross midnight (UTC) between
+// the second and third points. The second track is empty. The waypoint is
+// written to every part.
+const testPartitionGpxData = `<?xml version="1.0" encoding="UTF-8" ?><gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1">
+<metadata><name>Trip</name></metadata>
+<wpt lat="10.02" lon="10.01"><name>Fuel</name></wpt>
+<trk><name>Drive</name><trkseg>
+<trkpt lat="10" lon="10"><time>2016-12-02T22:00:00Z</time></trkpt>
+<trkpt lat="10.01" lon="10"><time>2016-12-02T23:00:00Z</time></trkpt>
+<trkpt lat="10.02" lon="10"><time>2016-12-03T01:00:00Z</time></trkpt>
+<trkpt lat="10.03" lon="10"><time>2016-12-03T05:00:00Z</time></trkpt>
+<trkpt lat="10.04" lon="10"><time>2016-12-03T06:00:00Z</time></trkpt>
+</trkseg></trk>
+<trk><name>Empty</name><trkseg></trkseg></trk>
+</gpx>`
+
+type testPart struct {
+    bytes.Buffer
+
+    closed bool
+}
+
+func (tp *testPart) Close() error {
+    tp.closed = true
+    return nil
+}
+
+// partitionTestData returns the parts and the point count of each.
+func partitionTestData(options PartitionOptions) (parts []*testPart, counts []int) {
+    parts = make([]*testPart, 0)
+
+    opener := func(index int, first *gpxcommon.TrackPoint) (w io.WriteCloser, err error) {
+        if index != len(parts) {
+            log.Panicf("index not correct: (%d)", index)
+        }
+
+        part := new(testPart)
+        parts = append(parts, part)
+
+        return part, nil
+    }
+
+    count, err := Partition(bytes.NewBufferString(testPartitionGpxData), opener, options)
+    log.PanicIf(err)
+
+    if count != len(parts) {
+        log.Panicf("count not correct: (%d) != (%d)", count, len(parts))
+    }
+
+    counts = make([]int, len(parts))
+    for i, part := range parts {
+        s := part.String()
+
+        if part.closed == false {
+            log.Panicf("part (%d) not closed", i)
+        } else if strings.Contains(s, "<name>Trip</name>") == false || strings.Contains(s, "<name>Drive</name>") == false {
+            log.Panicf("part (%d) missing the metadata or track:\n%s", i, s)
+        } else if strings.Contains(s, "<name>Fuel</name>") == false {
+            log.Panicf("part (%d) missing the waypoint:\n%s", i, s)
+        } else if strings.Contains(s, "<name>Empty</name>") == true {
+            log.Panicf("part (%d) has the empty track:\n%s", i, s)
+        }
+
+        counts[i] = strings.Count(s, "<trkpt ")
+    }
+
+    return parts, counts
+}
+
+func TestPartition(t *testing.T) {
+    cases := []struct {
+        name     string
+        options  PartitionOptions
+        expected []int
+    }{
+        {"none", PartitionOptions{}, []int{5}},
+        {"day-utc", PartitionOptions{ByDay: true}, []int{2, 3}},
+        {"day-local", PartitionOptions{ByDay: true, Location: time.FixedZone("local", -8*60*60)}, []int{5}},
+        {"duration", PartitionOptions{MaxDuration: 2 * time.Hour}, []int{2, 1, 2}},
+        {"distance", PartitionOptions{MaxDistance: 2500}, []int{3, 2}},
+        {"points", PartitionOptions{MaxPoints: 2}, []int{2, 2, 1}},
+    }
+
+    for _, c := range cases {
+        _, counts := partitionTestData(c.options)
+
+        if fmt.Sprintf("%v", counts) != fmt.Sprintf("%v", c.expected) {
+            t.Fatalf("Parts not correct for [%s]: %v != %v", c.name, counts, c.expected)
+        }
+    }
+}
+
+func TestPartitionFile(t *testing.T) {
+    tempPath, err := ioutil.TempDir("", "")
+    log.PanicIf(err)
+
+    defer os.RemoveAll(tempPath)
+
+    namer := func(index int, first *gpxcommon.TrackPoint) string {
+        return path.Join(tempPath, first.Time.Format("2006-01-02")+".gpx")
+    }
+
+    options := PartitionOptions{
+        ByDay: true,
+    }
+
+    filepaths, err := PartitionFile(bytes.NewBufferString(testPartitionGpxData), namer, options)
+    log.PanicIf(err)
+
+    expected := []string{
+        path.Join(tempPath, "2016-12-02.gpx"),
+        path.Join(tempPath, "2016-12-03.gpx"),
+    }
+
+    if fmt.Sprintf("%v", filepaths) != fmt.Sprintf("%v", expected) {
+        t.Fatalf("File-paths not correct: %v", filepaths)
+    }
+
+    data, err := ioutil.ReadFile(expected[1])
+    log.PanicIf(err)
+
+    if count := strings.Count(string(data), "<trkpt "); count != 3 {
+        t.Fatalf("Point count not correct: (%d)\n%s", count, string(data))
+    }
+}
@@ -0,0 +1,349 @@
+package gpxgeo
+
+import (
+    "io"
+    "math"
+    "math/rand"
+    "time"
+
+    "github.com/dsoprea/go-logging"
+
+    "github.com/dsoprea/go-gpx"
+    "github.com/dsoprea/go-gpx/pipe"
+    "github.com/dsoprea/go-gpx/writer"
+)
+
+// PrivacyOptions describes what is hidden before a recording is shared.
+type PrivacyOptions struct {
+    // Zones are the areas (e.g. home and office) whose points are hidden.
+    Zones []Region
+
+    // FuzzDistance moves the points within a zone rather than removing them.
+    // Every point within the same zone is moved to one random point within
+    // the zone and within this many meters of where the track first entered
+    // it, so that neither averaging the points nor the jump at the edge of
+    // the zone gives away the real positions. Zero removes the points.
+    FuzzDistance float64
+
+    // TrimMin and TrimMax (meters) bound the distance that is removed from the
+    // start and from the end of every track. A different distance is chosen
+    // for each end so that the trimmed ends don't give away the length that
+    // was trimmed. Zero disables this.
+    TrimMin float64
+    TrimMax float64
+
+    // StripTimes removes the time of every point. The builder that the
+    // points are written to has to omit "time" (see
+    // gpxwriter.BuilderOptions.OmitFields) since points can't otherwise be
+    // written without times.
+    StripTimes bool
+
+    // TimeOffset is added to the time of every point (and of the metadata).
+    TimeOffset time.Duration
+
+    // StripAuthor removes the author and links from the metadata. (The
+    // writer never writes the creator of the original document.)
+    StripAuthor bool
+
+    // Random chooses the fuzzing and trimming. If nil, one seeded from the
+    // current time is used.
+    Random *rand.Rand
+
+    // DistanceFunc defaults to Distance if not set.
+    DistanceFunc DistanceFunc
+}
+
+// outsideRegions contains the points that aren't within any of the regions.
+type outsideRegions []Region
+
+func (or outsideRegions) Contains(tp *gpxcommon.TrackPoint) bool {
+    for _, region := range or {
+        if region.Contains(tp) == true {
+            return false
+        }
+    }
+
+    return true
+}
+
+const (
+    // privacySnapAttempts is how many random positions are tried when
+    // looking for one within a zone.
+    privacySnapAttempts = 100
+)
+
+// snapPosition returns a random position within the zone and within
+// `fuzzDistance` meters of `entry`, which is in the zone. `entry` itself is
+// returned if no other position is found.
+func snapPosition(zone Region, entry *gpxcommon.TrackPoint, fuzzDistance float64, random *rand.Rand) gpxcommon.TrackPoint {
+    for i := 0; i < privacySnapAttempts; i++ {
+        // Uniform over the area of the circle.
+        distance := fuzzDistance * math.Sqrt(random.Float64())
+
+        candidate := SphericalDestination(entry, random.Float64()*360, distance)
+        if zone.Contains(&candidate) == true {
+            return candidate
+        }
+    }
+
+    return gpxcommon.TrackPoint{
+        LatitudeDecimal:  entry.LatitudeDecimal,
+        LongitudeDecimal: entry.LongitudeDecimal,
+    }
+}
+
+// PrivacyZoneStage returns a pipeline stage that removes the points within any
+// of the zones, splitting the segment where it was passing through one. If
+// `fuzzDistance` is greater than zero, the points are instead moved. The first
+// time that a zone is entered, a random position within it (and within
+// `fuzzDistance` meters of the point where it was entered) is chosen, and
+// every point within that zone is moved to it. A point within more than one
+// zone is moved as for the first. Waypoints within any of the zones are always
+// removed.
+func PrivacyZoneStage(zones []Region, fuzzDistance float64, random *rand.Rand) gpxpipe.Stage {
+    if fuzzDistance <= 0 {
+        return CropRegionStage(outsideRegions(zones))
+    }
+
+    // Independent noise for every point would average out over the many
+    // points recorded while stopped within a zone, and moving every point by
+    // the same offset would show the offset as the jump where the track
+    // enters the zone. Collapsing the points to one position does neither.
+
+    snapped := make([]*gpxcommon.TrackPoint, len(zones))
+
+    fuzz := func(tp *gpxcommon.TrackPoint) error {
+        for i, zone := range zones {
+            if zone.Contains(tp) == false {
+                continue
+            }
+
+            if snapped[i] == nil {
+                position := snapPosition(zone, tp, fuzzDistance, random)
+                snapped[i] = &position
+            }
+
+            tp.LatitudeDecimal = snapped[i].LatitudeDecimal
+            tp.LongitudeDecimal = snapped[i].LongitudeDecimal
+
+            break
+        }
+
+        return nil
+    }
+
+    fuzzStage := gpxpipe.Map(fuzz)
+
+    return func(e gpxpipe.Element, emit gpxpipe.Emit) error {
+        if e.Type == gpxpipe.ElementWaypoint {
+            position := waypointPosition(e.Waypoint)
+
+            if outsideRegions(zones).Contains(&position) == false {
+                return nil
+            }
+        }
+
+        return fuzzStage(e, emit)
+    }
+}
+
+// trimmedElement is an element held by the trim stage along with the
+// distance of its point (if it is a point) from the start of the track.
+type trimmedElement struct {
+    e        gpxpipe.Element
+    distance float64
+}
+
+// TrimStage returns a pipeline stage that removes the points within a random
+// distance (from `min` to `max` meters) of the start and of the end of every
+// track. The distance is measured along the segments. Only the points within
+// `max` meters of the last point received are held in memory.
+func TrimStage(min, max float64, random *rand.Rand, df DistanceFunc) gpxpipe.Stage {
+    if df == nil {
+        df = Distance
+    }
+
+    choose := func() float64 {
+        return min + random.Float64()*(max-min)
+    }
+
+    var startTrim, endTrim, distance float64
+    var previous *gpxcommon.TrackPoint
+
+    held := make([]trimmedElement, 0)
+
+    return func(e gpxpipe.Element, emit gpxpipe.Emit) (err error) {
+        defer func() {
+            if state := recover(); state != nil {
+                err = log.Wrap(state.(error))
+            }
+        }()
+
+        switch e.Type {
+        case gpxpipe.ElementTrackOpen:
+            startTrim = choose()
+            endTrim = choose()
+            distance = 0
+            previous = nil
+        case gpxpipe.ElementSegmentOpen, gpxpipe.ElementSegmentClose:
+            previous = nil
+
+            held = append(held, trimmedElement{e: e})
+
+            return nil
+        case gpxpipe.ElementPoint:
+            if previous != nil {
+                distance += df(previous, e.Point)
+            }
+
+            copied := *e.Point
+            previous = &copied
+
+            if distance < startTrim {
+                return nil
+            }
+
+            held = append(held, trimmedElement{e: gpxpipe.Element{Type: gpxpipe.ElementPoint, Point: &copied}, distance: distance})
+
+            // Release everything that is far enough from the end of the
+            // track as it is so far.
+
+            i := 0
+            for ; i < len(held); i++ {
+                te := held[i]
+                if te.e.Type == gpxpipe.ElementPoint && distance-te.distance < endTrim {
+                    break
+                }
+
+                err := emit(te.e)
+                log.PanicIf(err)
+            }
+
+            held = held[i:]
+
+            return nil
+        case gpxpipe.ElementTrackClose:
+            // The points still held are at the end of the track. Only the
+            // segment boundaries are kept.
+
+            for _, te := range held {
+                if te.e.Type == gpxpipe.ElementPoint {
+                    continue
+                }
+
+                err := emit(te.e)
+                log.PanicIf(err)
+            }
+
+            held = held[:0]
+        }
+
+        err = emit(e)
+        log.PanicIf(err)
+
+        return nil
+    }
+}
+
+// PrivacyStages returns the pipeline stages that apply the options. The
+// tracks are trimmed before the zones are applied so that the distances are
+// measured along the original positions.
+func PrivacyStages(options PrivacyOptions) []gpxpipe.Stage {
+    random := options.Random
+    if random == nil {
+        random = rand.New(rand.NewSource(time.Now().UnixNano()))
+    }
+
+    stages := make([]gpxpipe.Stage, 0)
+
+    if options.TrimMax > 0 {
+        stages = append(stages, TrimStage(options.TrimMin, options.TrimMax, random, options.DistanceFunc))
+    }
+
+    if len(options.Zones) > 0 {
+        stages = append(stages, PrivacyZoneStage(options.Zones, options.FuzzDistance, random))
+    }
+
+    if options.StripTimes == true || options.TimeOffset != 0 {
+        shift := func(tp *gpxcommon.TrackPoint) error {
+            if options.StripTimes == true {
+                tp.Time = time.Time{}
+            } else if tp.Time.IsZero() == false {
+                tp.Time = tp.Time.Add(options.TimeOffset)
+            }
+
+            return nil
+        }
+
+        stages = append(stages, gpxpipe.Map(shift))
+    }
+
+    if options.StripAuthor == true || options.StripTimes == true || options.TimeOffset != 0 {
+        stages = append(stages, privacyMetadataStage(options))
+    }
+
+    return stages
+}
+
+// privacyMetadataStage returns a stage that removes the author, the links,
+// and the time from the metadata, and shifts or strips the times of the
+// waypoints, as the options require.
+func privacyMetadataStage(options PrivacyOptions) gpxpipe.Stage {
+    return func(e gpxpipe.Element, emit gpxpipe.Emit) (err error) {
+        defer func() {
+            if state := recover(); state != nil {
+                err = log.Wrap(state.(error))
+            }
+        }()
+
+        if e.Type == gpxpipe.ElementMetadata {
+            md := *e.Metadata
+
+            if options.StripAuthor == true {
+                md.AuthorName = ""
+                md.Links = nil
+            }
+
+            if options.StripTimes == true {
+                md.Time = time.Time{}
+            } else if md.Time.IsZero() == false {
+                md.Time = md.Time.Add(options.TimeOffset)
+            }
+
+            e.Metadata = &md
+        } else if e.Type == gpxpipe.ElementWaypoint {
+            w := *e.Waypoint
+
+            if options.StripTimes == true {
+                w.Time = time.Time{}
+            } else if w.Time.IsZero() == false {
+                w.Time = w.Time.Add(options.TimeOffset)
+            }
+
+            e.Waypoint = &w
+        }
+
+        err = emit(e)
+        log.PanicIf(err)
+
+        return nil
+    }
+}
+
+// Anonymize streams the GPX data to the builder with the options applied,
+// dropping the segments and tracks that end up empty. The document is closed
+// when done.
+func Anonymize(r io.Reader, b *gpxwriter.Builder, options PrivacyOptions) (err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    stages := append(PrivacyStages(options), gpxpipe.DropEmpty())
+
+    err = gpxpipe.NewPipeline(stages...).Write(r, b)
+    log.PanicIf(err)
+
+    return nil
+}
@@ -0,0 +1,224 @@
+package gpxgeo
+
+import (
+    "bytes"
+    "fmt"
+    "math/rand"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/dsoprea/go-logging"
+
+    "github.com/dsoprea/go-gpx"
+    "github.com/dsoprea/go-gpx/pipe"
+    "github.com/dsoprea/go-gpx/writer"
+)
+
+// getPrivacyTestGpxData returns a track of eleven points about 110 meters
+// apart (heading north), a minute apart, and a waypoint at each end of it.
+func getPrivacyTestGpxData() string {
+    epoch := time.Date(2016, 12, 2, 8, 0, 0, 0, time.UTC)
+
+    b := new(bytes.Buffer)
+    b.WriteString(`<?xml version="1.0" encoding="UTF-8" ?><gpx version="1.1" creator="Someone's Phone" xmlns="http://www.topografix.com/GPX/1/1">
+<metadata><name>Commute</name><author><name>Someone</name></author><link href="http://example.com/someone"></link><time>2016-12-02T08:00:00Z</time></metadata>
+<wpt lat="10" lon="10"><name>Home</name></wpt>
+<wpt lat="10.02" lon="10"><name>Shop</name></wpt>
+<trk><trkseg>`)
+
+    for i := 0; i < 11; i++ {
+        fmt.Fprintf(b, `<trkpt lat="%.3f" lon="10"><time>%s</time></trkpt>`, 10+float64(i)*0.001, epoch.Add(time.Duration(i)*time.Minute).Format(time.RFC3339))
+    }
+
+    b.WriteString(`</trkseg></trk></gpx>`)
+
+    return b.String()
+}
+
+func enumeratePrivacy(stages ...gpxpipe.Stage) (segments int, points []gpxcommon.TrackPoint) {
+    p := gpxpipe.NewPipeline(append(stages, gpxpipe.DropEmpty())...)
+
+    points = make([]gpxcommon.TrackPoint, 0)
+
+    sink := func(e gpxpipe.Element) error {
+        if e.Type == gpxpipe.ElementSegmentOpen {
+            segments++
+        } else if e.Type == gpxpipe.ElementPoint {
+            points = append(points, *e.Point)
+        }
+
+        return nil
+    }
+
+    err := p.Enumerate(bytes.NewBufferString(getPrivacyTestGpxData()), sink)
+    log.PanicIf(err)
+
+    return segments, points
+}
+
+func TestTrimStage(t *testing.T) {
+    random := rand.New(rand.NewSource(1))
+
+    segments, points := enumeratePrivacy(TrimStage(250, 250, random, nil))
+
+    if segments != 1 || len(points) != 5 {
+        t.Fatalf("Points not correct: (%d) %v", segments, points)
+    } else if points[0].LatitudeDecimal != 10.003 || points[4].LatitudeDecimal != 10.007 {
+        t.Fatalf("Wrong points trimmed: %v", points)
+    }
+
+    // Random distances within the bounds.
+
+    _, points = enumeratePrivacy(TrimStage(100, 300, random, nil))
+
+    if len(points) < 5 || len(points) > 9 {
+        t.Fatalf("Point count not correct: (%d)", len(points))
+    }
+}
+
+func TestPrivacyZoneStage(t *testing.T) {
+    zones := []Region{
+        &Circle{
+            Center: gpxcommon.TrackPoint{LatitudeDecimal: 10.005, LongitudeDecimal: 10},
+            Radius: 150,
+        },
+    }
+
+    segments, points := enumeratePrivacy(PrivacyZoneStage(zones, 0, nil))
+
+    if segments != 2 || len(points) != 8 {
+        t.Fatalf("Points not correct: (%d) %v", segments, points)
+    }
+
+    for _, tp := range points {
+        if zones[0].Contains(&tp) == true {
+            t.Fatalf("Point in zone not removed: %s", &tp)
+        }
+    }
+
+    // Fuzzed.
+
+    random := rand.New(rand.NewSource(1))
+
+    segments, points = enumeratePrivacy(PrivacyZoneStage(zones, 50, random))
+
+    if segments != 1 || len(points) != 11 {
+        t.Fatalf("Points not correct: (%d) %v", segments, points)
+    }
+
+    originals := make([]gpxcommon.TrackPoint, len(points))
+    for i := range originals {
+        originals[i] = gpxcommon.TrackPoint{LatitudeDecimal: 10 + float64(i)*0.001, LongitudeDecimal: 10}
+    }
+
+    // The points within the zone are all moved to one position within the
+    // zone and near where it was entered.
+
+    snapped := points[4]
+
+    if zones[0].Contains(&snapped) == false {
+        t.Fatalf("Fuzzed position not within the zone: %s", &snapped)
+    } else if distance := Distance(&originals[4], &snapped); distance > 50+1e-6 {
+        t.Fatalf("Fuzzed position too far from the entry: (%.3f)", distance)
+    }
+
+    for i, tp := range points {
+        if i >= 4 && i <= 6 {
+            if tp.LatitudeDecimal != snapped.LatitudeDecimal || tp.LongitudeDecimal != snapped.LongitudeDecimal {
+                t.Fatalf("Point (%d) not fuzzed correctly: %s", i, &tp)
+            }
+        } else if moved := Distance(&originals[i], &tp); moved > 1e-6 {
+            t.Fatalf("Point (%d) outside of the zone moved: (%.3f)", i, moved)
+        }
+    }
+
+    // The jump where the track enters the zone mustn't give away an offset
+    // that can be taken back off of the other points.
+
+    latitudeOffset := points[4].LatitudeDecimal - originals[4].LatitudeDecimal
+    longitudeOffset := points[4].LongitudeDecimal - originals[4].LongitudeDecimal
+
+    for i := 5; i <= 6; i++ {
+        recovered := gpxcommon.TrackPoint{
+            LatitudeDecimal:  points[i].LatitudeDecimal - latitudeOffset,
+            LongitudeDecimal: points[i].LongitudeDecimal - longitudeOffset,
+        }
+
+        if distance := Distance(&recovered, &originals[i]); distance < 100 {
+            t.Fatalf("Point (%d) recovered from the entry offset: (%.3f)", i, distance)
+        }
+    }
+
+    // Averaging the fuzzed points mustn't give back the original position.
+
+    var originalCentroid, fuzzedCentroid gpxcommon.TrackPoint
+    for i := 4; i <= 6; i++ {
+        originalCentroid.LatitudeDecimal += originals[i].LatitudeDecimal / 3
+        originalCentroid.LongitudeDecimal += originals[i].LongitudeDecimal / 3
+
+        fuzzedCentroid.LatitudeDecimal += points[i].LatitudeDecimal / 3
+        fuzzedCentroid.LongitudeDecimal += points[i].LongitudeDecimal / 3
+    }
+
+    if distance := Distance(&originalCentroid, &fuzzedCentroid); distance < 50 {
+        t.Fatalf("Centroid of fuzzed points too close to the original: (%.3f)", distance)
+    }
+}
+
+func TestPrivacyStages_TimeOffset(t *testing.T) {
+    options := PrivacyOptions{
+        TimeOffset: -time.Hour,
+    }
+
+    _, points := enumeratePrivacy(PrivacyStages(options)...)
+
+    if len(points) != 11 || points[0].Time.Format(time.RFC3339) != "2016-12-02T07:00:00Z" {
+        t.Fatalf("Times not shifted: %v", points)
+    }
+}
+
+func TestAnonymize(t *testing.T) {
+    output := new(bytes.Buffer)
+
+    builderOptions := gpxwriter.DefaultBuilderOptions()
+    builderOptions.OmitFields = []string{"time"}
+
+    b, err := gpxwriter.NewBuilderWithOptions(output, builderOptions)
+    log.PanicIf(err)
+
+    options := PrivacyOptions{
+        Zones: []Region{
+            &Circle{
+                Center: gpxcommon.TrackPoint{LatitudeDecimal: 10, LongitudeDecimal: 10},
+                Radius: 150,
+            },
+        },
+        TrimMin:     100,
+        TrimMax:     200,
+        StripTimes:  true,
+        StripAuthor: true,
+        Random:      rand.New(rand.NewSource(1)),
+    }
+
+    err = Anonymize(bytes.NewBufferString(getPrivacyTestGpxData()), b, options)
+    log.PanicIf(err)
+
+    s := output.String()
+
+    if strings.Contains(s, "<time>") == true {
+        t.Fatalf("Times not stripped:\n%s", s)
+    } else if strings.Contains(s, "Someone") == true || strings.Contains(s, "<link") == true {
+        t.Fatalf("Author not stripped:\n%s", s)
+    } else if strings.Contains(s, "<name>Commute</name>") == false {
+        t.Fatalf("Metadata name not kept:\n%s", s)
+    } else if strings.Contains(s, `lat="10"`) == true || strings.Contains(s, `lat="10.001"`) == true {
+        t.Fatalf("Start not hidden:\n%s", s)
+    } else if strings.Contains(s, "<name>Home</name>") == true || strings.Contains(s, "<name>Shop</name>") == false {
+        t.Fatalf("Waypoints not correct:\n%s", s)
+    }
+
+    if count := strings.Count(s, "<trkpt "); count < 7 || count > 9 {
+        t.Fatalf("Point count not correct: (%d)\n%s", count, s)
+    }
+}
@@ -0,0 +1,103 @@
+package gpxgeo
+
+import (
+    "fmt"
+
+    "github.com/dsoprea/go-gpx"
+)
+
+// Region is an area that points can be tested against.
+type Region interface {
+    Contains(tp *gpxcommon.TrackPoint) bool
+}
+
+// Rectangle is a region bounded by latitudes and longitudes (inclusive). It
+// crosses the antimeridian if the minimum longitude is greater than the
+// maximum.
+type Rectangle gpxcommon.Bounds
+
+func (r Rectangle) String() string {
+    return fmt.Sprintf("Rectangle<MIN-LAT=(%.8f) MIN-LON=(%.8f) MAX-LAT=(%.8f) MAX-LON=(%.8f)>", r.MinLatitude, r.MinLongitude, r.MaxLatitude, r.MaxLongitude)
+}
+
+func (r Rectangle) Contains(tp *gpxcommon.TrackPoint) bool {
+    if tp.LatitudeDecimal < r.MinLatitude || tp.LatitudeDecimal > r.MaxLatitude {
+        return false
+    }
+
+    if r.MinLongitude > r.MaxLongitude {
+        return tp.LongitudeDecimal >= r.MinLongitude || tp.LongitudeDecimal <= r.MaxLongitude
+    }
+
+    return tp.LongitudeDecimal >= r.MinLongitude && tp.LongitudeDecimal <= r.MaxLongitude
+}
+
+// Circle is the region within Radius meters of Center.
+type Circle struct {
+    Center gpxcommon.TrackPoint
+    Radius float64
+
+    // DistanceFunc defaults to Distance if not set.
+    DistanceFunc DistanceFunc
+}
+
+func (c *Circle) String() string {
+    return fmt.Sprintf("Circle<LAT=(%.8f) LON=(%.8f) RADIUS=(%.3f)>", c.Center.LatitudeDecimal, c.Center.LongitudeDecimal, c.Radius)
+}
+
+func (c *Circle) Contains(tp *gpxcommon.TrackPoint) bool {
+    df := c.DistanceFunc
+    if df == nil {
+        df = Distance
+    }
+
+    return df(&c.Center, tp) <= c.Radius
+}
+
+// Polygon is a region with an exterior ring and any number of holes. The
+// rings are closed implicitly (the last vertex connects to the first) and
+// the edges are treated as straight lines of latitude and longitude, so
+// polygons shouldn't cross the antimeridian or contain a pole.
+type Polygon struct {
+    Exterior []gpxcommon.TrackPoint
+    Holes    [][]gpxcommon.TrackPoint
+}
+
+func (p *Polygon) String() string {
+    return fmt.Sprintf("Polygon<VERTICES=(%d) HOLES=(%d)>", len(p.Exterior), len(p.Holes))
+}
+
+// ringContains tests the point against the ring using the even-odd rule.
+func ringContains(ring []gpxcommon.TrackPoint, tp *gpxcommon.TrackPoint) bool {
+    x := tp.LongitudeDecimal
+    y := tp.LatitudeDecimal
+
+    inside := false
+
+    for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+        xi, yi := ring[i].LongitudeDecimal, ring[i].LatitudeDecimal
+        xj, yj := ring[j].LongitudeDecimal, ring[j].LatitudeDecimal
+
+        if (yi > y) != (yj > y) && x < (xj-xi)*(y-yi)/(yj-yi)+xi {
+            inside = !inside
+        }
+    }
+
+    return inside
+}
+
+// Contains returns true if the point is within the exterior and not within
+// any of the holes.
+func (p *Polygon) Contains(tp *gpxcommon.TrackPoint) bool {
+    if len(p.Exterior) < 3 || ringContains(p.Exterior, tp) == false {
+        return false
+    }
+
+    for _, hole := range p.Holes {
+        if len(hole) >= 3 && ringContains(hole, tp) == true {
+            return false
+        }
+    }
+
+    return true
+}
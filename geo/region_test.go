@@ -0,0 +1,93 @@
+package gpxgeo
+
+import (
+    "testing"
+
+    "github.com/dsoprea/go-gpx"
+)
+
+func TestRectangle_Contains(t *testing.T) {
+    r := Rectangle{
+        MinLatitude:  -10,
+        MinLongitude: 170,
+        MaxLatitude:  10,
+        MaxLongitude: -170,
+    }
+
+    inside := []gpxcommon.TrackPoint{
+        {LatitudeDecimal: 0, LongitudeDecimal: 175},
+        {LatitudeDecimal: 10, LongitudeDecimal: -175},
+    }
+
+    for i := range inside {
+        if r.Contains(&inside[i]) == false {
+            t.Fatalf("Point should be inside: %s", &inside[i])
+        }
+    }
+
+    outside := []gpxcommon.TrackPoint{
+        {LatitudeDecimal: 0, LongitudeDecimal: 0},
+        {LatitudeDecimal: 11, LongitudeDecimal: 175},
+    }
+
+    for i := range outside {
+        if r.Contains(&outside[i]) == true {
+            t.Fatalf("Point should be outside: %s", &outside[i])
+        }
+    }
+}
+
+func TestCircle_Contains(t *testing.T) {
+    c := &Circle{
+        Center: gpxcommon.TrackPoint{LatitudeDecimal: 47.6, LongitudeDecimal: -122.3},
+        Radius: 200,
+    }
+
+    inside := SphericalDestination(&c.Center, 45, 190)
+    outside := SphericalDestination(&c.Center, 45, 210)
+
+    if c.Contains(&inside) == false {
+        t.Fatalf("Point should be inside: %s", &inside)
+    } else if c.Contains(&outside) == true {
+        t.Fatalf("Point should be outside: %s", &outside)
+    }
+}
+
+func TestPolygon_Contains(t *testing.T) {
+    // An "L" with a hole in the corner.
+    p := &Polygon{
+        Exterior: []gpxcommon.TrackPoint{
+            {LatitudeDecimal: 0, LongitudeDecimal: 0},
+            {LatitudeDecimal: 0, LongitudeDecimal: 4},
+            {LatitudeDecimal: 2, LongitudeDecimal: 4},
+            {LatitudeDecimal: 2, LongitudeDecimal: 2},
+            {LatitudeDecimal: 4, LongitudeDecimal: 2},
+            {LatitudeDecimal: 4, LongitudeDecimal: 0},
+        },
+        Holes: [][]gpxcommon.TrackPoint{
+            {
+                {LatitudeDecimal: 0.5, LongitudeDecimal: 0.5},
+                {LatitudeDecimal: 0.5, LongitudeDecimal: 1.5},
+                {LatitudeDecimal: 1.5, LongitudeDecimal: 1.5},
+                {LatitudeDecimal: 1.5, LongitudeDecimal: 0.5},
+            },
+        },
+    }
+
+    cases := []struct {
+        tp       gpxcommon.TrackPoint
+        expected bool
+    }{
+        {gpxcommon.TrackPoint{LatitudeDecimal: 1, LongitudeDecimal: 3}, true},
+        {gpxcommon.TrackPoint{LatitudeDecimal: 3, LongitudeDecimal: 1}, true},
+        {gpxcommon.TrackPoint{LatitudeDecimal: 3, LongitudeDecimal: 3}, false},
+        {gpxcommon.TrackPoint{LatitudeDecimal: 1, LongitudeDecimal: 1}, false},
+        {gpxcommon.TrackPoint{LatitudeDecimal: 5, LongitudeDecimal: 1}, false},
+    }
+
+    for _, c := range cases {
+        if p.Contains(&c.tp) != c.expected {
+            t.Fatalf("Contains not correct for %s: expected [%v]", &c.tp, c.expected)
+        }
+    }
+}
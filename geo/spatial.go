@@ -0,0 +1,409 @@
+package gpxgeo
+
+import (
+    "fmt"
+    "math"
+    "sort"
+
+    "github.com/dsoprea/go-logging"
+
+    "github.com/dsoprea/go-gpx"
+    "github.com/dsoprea/go-gpx/reader"
+)
+
+const (
+    // DefaultCellSize is the size of the grid cells in degrees (about 1km of
+    // latitude).
+    DefaultCellSize = 0.01
+
+    // radiusMargin pads the cells that are searched for a radius to cover
+    // the difference between the spherical and ellipsoidal distances.
+    radiusMargin = 1.01
+)
+
+// SpatialMatch is an indexed point. The indices are zero-based and the
+// point index is within the segment.
+type SpatialMatch struct {
+    Label        string
+    TrackIndex   int
+    SegmentIndex int
+    PointIndex   int
+    Point        gpxcommon.TrackPoint
+
+    // Distance is the distance (m) from the position that was searched for.
+    // It is zero for bounding-box searches.
+    Distance float64
+}
+
+func (sm SpatialMatch) String() string {
+    return fmt.Sprintf("SpatialMatch<LABEL=[%s] TRACK=(%d) SEGMENT=(%d) POINT=(%d) LAT=(%.8f) LON=(%.8f) DISTANCE=(%.3f)>", sm.Label, sm.TrackIndex, sm.SegmentIndex, sm.PointIndex, sm.Point.LatitudeDecimal, sm.Point.LongitudeDecimal, sm.Distance)
+}
+
+// spatialCell identifies a cell of the grid.
+type spatialCell struct {
+    x, y int
+}
+
+// SpatialIndex finds points by position over a set of GPX files. The points
+// are kept in a grid of fixed-size cells.
+type SpatialIndex struct {
+    accessor gpxreader.GpxDataAccessor
+    cellSize float64
+    df       DistanceFunc
+
+    // columns and rows are the size of the grid.
+    columns int
+    rows    int
+
+    entries []SpatialMatch
+    cells   map[spatialCell][]int
+}
+
+// NewSpatialIndex returns an empty index. `cellSize` (degrees) defaults to
+// DefaultCellSize and `df` defaults to Distance if not set.
+func NewSpatialIndex(accessor gpxreader.GpxDataAccessor, cellSize float64, df DistanceFunc) *SpatialIndex {
+    if cellSize <= 0 {
+        cellSize = DefaultCellSize
+    }
+
+    if df == nil {
+        df = Distance
+    }
+
+    return &SpatialIndex{
+        accessor: accessor,
+        cellSize: cellSize,
+        df:       df,
+        columns:  int(math.Ceil(360 / cellSize)),
+        rows:     int(math.Ceil(180 / cellSize)),
+        entries:  make([]SpatialMatch, 0),
+        cells:    make(map[spatialCell][]int),
+    }
+}
+
+// Len returns the number of indexed points.
+func (si *SpatialIndex) Len() int {
+    return len(si.entries)
+}
+
+func (si *SpatialIndex) column(longitude float64) int {
+    x := int(math.Floor((longitude + 180) / si.cellSize))
+
+    // Wrap around the antimeridian.
+    x %= si.columns
+    if x < 0 {
+        x += si.columns
+    }
+
+    return x
+}
+
+func (si *SpatialIndex) row(latitude float64) int {
+    // Clamp before converting so that infinities are handled.
+    y := math.Floor((latitude + 90) / si.cellSize)
+
+    if y < 0 {
+        return 0
+    } else if y >= float64(si.rows) {
+        return si.rows - 1
+    }
+
+    return int(y)
+}
+
+func (si *SpatialIndex) cellOf(tp *gpxcommon.TrackPoint) spatialCell {
+    return spatialCell{
+        x: si.column(tp.LongitudeDecimal),
+        y: si.row(tp.LatitudeDecimal),
+    }
+}
+
+// Insert adds a point that was already read (e.g. from a saved catalog).
+// `Distance` is ignored.
+func (si *SpatialIndex) Insert(sm SpatialMatch) {
+    sm.Distance = 0
+
+    cell := si.cellOf(&sm.Point)
+
+    si.cells[cell] = append(si.cells[cell], len(si.entries))
+    si.entries = append(si.entries, sm)
+}
+
+// spatialVisitor indexes the points while the document is parsed.
+type spatialVisitor struct {
+    si    *SpatialIndex
+    label string
+
+    trackIndex   int
+    segmentIndex int
+    pointIndex   int
+    count        int
+}
+
+func (sv *spatialVisitor) TrackOpen(t *gpxcommon.Track) error {
+    sv.trackIndex++
+    sv.segmentIndex = -1
+
+    return nil
+}
+
+func (sv *spatialVisitor) TrackClose(t *gpxcommon.Track) error {
+    return nil
+}
+
+func (sv *spatialVisitor) TrackSegmentOpen(ts *gpxcommon.TrackSegment) error {
+    sv.segmentIndex++
+    sv.pointIndex = -1
+
+    return nil
+}
+
+func (sv *spatialVisitor) TrackSegmentClose(ts *gpxcommon.TrackSegment) error {
+    return nil
+}
+
+func (sv *spatialVisitor) TrackPointOpen(tp *gpxcommon.TrackPoint) error {
+    return nil
+}
+
+func (sv *spatialVisitor) TrackPointClose(tp *gpxcommon.TrackPoint) error {
+    sv.pointIndex++
+
+    sm := SpatialMatch{
+        Label:        sv.label,
+        TrackIndex:   sv.trackIndex,
+        SegmentIndex: sv.segmentIndex,
+        PointIndex:   sv.pointIndex,
+        Point:        *tp,
+    }
+
+    sv.si.Insert(sm)
+    sv.count++
+
+    return nil
+}
+
+// Add streams the file and indexes every track point. The number of points
+// is returned.
+func (si *SpatialIndex) Add(label string) (count int, err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    rc, err := si.accessor.Open(label)
+    log.PanicIf(err)
+
+    defer rc.Close()
+
+    sv := &spatialVisitor{
+        si:           si,
+        label:        label,
+        trackIndex:   -1,
+        segmentIndex: -1,
+        pointIndex:   -1,
+    }
+
+    gp := gpxreader.NewGpxParser(rc, sv)
+
+    err = gp.Parse()
+    log.PanicIf(err)
+
+    return sv.count, nil
+}
+
+// visitCells calls `cb` for the points in every populated cell within the
+// rows and columns (inclusive). `fromColumn` is greater than `toColumn` if
+// the range crosses the antimeridian.
+func (si *SpatialIndex) visitCells(fromRow, toRow, fromColumn, toColumn int, cb func(i int)) {
+    columnCount := toColumn - fromColumn + 1
+    if columnCount <= 0 {
+        columnCount += si.columns
+    }
+
+    inColumns := func(x int) bool {
+        if fromColumn <= toColumn {
+            return x >= fromColumn && x <= toColumn
+        }
+
+        return x >= fromColumn || x <= toColumn
+    }
+
+    // Don't step through more cells than there are populated ones.
+    if (toRow-fromRow+1)*columnCount > len(si.cells) {
+        for cell, indices := range si.cells {
+            if cell.y < fromRow || cell.y > toRow || inColumns(cell.x) == false {
+                continue
+            }
+
+            for _, i := range indices {
+                cb(i)
+            }
+        }
+
+        return
+    }
+
+    for y := fromRow; y <= toRow; y++ {
+        for k := 0; k < columnCount; k++ {
+            x := (fromColumn + k) % si.columns
+
+            for _, i := range si.cells[spatialCell{x: x, y: y}] {
+                cb(i)
+            }
+        }
+    }
+}
+
+// sortMatches orders by distance, then label, then position in the file.
+func sortMatches(matches []SpatialMatch) {
+    sort.SliceStable(matches, func(i, j int) bool {
+        a, b := &matches[i], &matches[j]
+
+        if a.Distance != b.Distance {
+            return a.Distance < b.Distance
+        } else if a.Label != b.Label {
+            return a.Label < b.Label
+        } else if a.TrackIndex != b.TrackIndex {
+            return a.TrackIndex < b.TrackIndex
+        } else if a.SegmentIndex != b.SegmentIndex {
+            return a.SegmentIndex < b.SegmentIndex
+        }
+
+        return a.PointIndex < b.PointIndex
+    })
+}
+
+// WithinBounds returns the points within the rectangle (inclusive). The
+// rectangle crosses the antimeridian if the minimum longitude is greater
+// than the maximum.
+func (si *SpatialIndex) WithinBounds(b gpxcommon.Bounds) []SpatialMatch {
+    crosses := b.MinLongitude > b.MaxLongitude
+    rectangle := Rectangle(b)
+
+    matches := make([]SpatialMatch, 0)
+
+    cb := func(i int) {
+        if rectangle.Contains(&si.entries[i].Point) == true {
+            matches = append(matches, si.entries[i])
+        }
+    }
+
+    fromColumn := si.column(b.MinLongitude)
+    toColumn := si.column(b.MaxLongitude)
+
+    if crosses == false && b.MaxLongitude-b.MinLongitude >= 360 {
+        fromColumn, toColumn = 0, si.columns-1
+    }
+
+    si.visitCells(si.row(b.MinLatitude), si.row(b.MaxLatitude), fromColumn, toColumn, cb)
+
+    sortMatches(matches)
+
+    return matches
+}
+
+// WithinRadius returns the points within `radius` meters of `center`,
+// ordered by distance.
+func (si *SpatialIndex) WithinRadius(center *gpxcommon.TrackPoint, radius float64) []SpatialMatch {
+    matches := make([]SpatialMatch, 0)
+
+    cb := func(i int) {
+        distance := si.df(center, &si.entries[i].Point)
+        if distance > radius {
+            return
+        }
+
+        sm := si.entries[i]
+        sm.Distance = distance
+
+        matches = append(matches, sm)
+    }
+
+    // The rectangle (in degrees) that contains the circle.
+
+    angular := radius * radiusMargin / EarthRadius
+
+    minLatitude := center.LatitudeDecimal - toDegrees(angular)
+    maxLatitude := center.LatitudeDecimal + toDegrees(angular)
+
+    fromColumn, toColumn := 0, si.columns-1
+
+    // The longitudes are only bounded if neither pole is within the circle.
+    if minLatitude > -90 && maxLatitude < 90 {
+        ratio := math.Sin(angular) / math.Cos(toRadians(center.LatitudeDecimal))
+
+        if ratio < 1 {
+            spread := toDegrees(math.Asin(ratio))
+
+            if spread*2 < 360-si.cellSize {
+                fromColumn = si.column(center.LongitudeDecimal - spread)
+                toColumn = si.column(center.LongitudeDecimal + spread)
+            }
+        }
+    }
+
+    si.visitCells(si.row(minLatitude), si.row(maxLatitude), fromColumn, toColumn, cb)
+
+    sortMatches(matches)
+
+    return matches
+}
+
+// Nearest returns the `k` points nearest to `center`, ordered by distance.
+// Fewer are returned if fewer are indexed.
+func (si *SpatialIndex) Nearest(center *gpxcommon.TrackPoint, k int) []SpatialMatch {
+    if k <= 0 || len(si.entries) == 0 {
+        return make([]SpatialMatch, 0)
+    }
+
+    // Collect candidates from the rings of cells around the center until we
+    // have enough. The kth nearest candidate bounds the distance of the kth
+    // nearest point, which a radius search then finds exactly.
+
+    origin := si.cellOf(center)
+    candidates := make([]int, 0, k)
+
+    for ring := 0; len(candidates) < k && (2*ring+1)*(2*ring+1) <= len(si.cells) && 2*ring+1 <= si.columns; ring++ {
+        for y := origin.y - ring; y <= origin.y+ring; y++ {
+            if y < 0 || y >= si.rows {
+                continue
+            }
+
+            for dx := -ring; dx <= ring; dx++ {
+                if y != origin.y-ring && y != origin.y+ring && dx != -ring && dx != ring {
+                    continue
+                }
+
+                x := ((origin.x+dx)%si.columns + si.columns) % si.columns
+
+                candidates = append(candidates, si.cells[spatialCell{x: x, y: y}]...)
+            }
+        }
+    }
+
+    // The points are too spread out to be worth stepping through the cells.
+    if len(candidates) < k {
+        matches := si.WithinRadius(center, math.Inf(1))
+        if len(matches) > k {
+            matches = matches[:k]
+        }
+
+        return matches
+    }
+
+    distances := make([]float64, len(candidates))
+    for j, i := range candidates {
+        distances[j] = si.df(center, &si.entries[i].Point)
+    }
+
+    sort.Float64s(distances)
+
+    matches := si.WithinRadius(center, distances[k-1])
+    if len(matches) > k {
+        matches = matches[:k]
+    }
+
+    return matches
+}
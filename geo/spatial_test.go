@@ -0,0 +1,232 @@
+package gpxgeo
+
+import (
+    "bytes"
+    "io"
+    "io/ioutil"
+    "testing"
+
+    "github.com/dsoprea/go-logging"
+
+    "github.com/dsoprea/go-gpx"
+    "github.com/dsoprea/go-gpx/reader"
+)
+
+const (
+    testSpatialGpxData = `<?xml version="1.0" encoding="UTF-8" ?><gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1">
+<trk><trkseg>
+<trkpt lat="10" lon="10"></trkpt>
+<trkpt lat="10" lon="10.001"></trkpt>
+</trkseg><trkseg>
+<trkpt lat="10" lon="10.002"></trkpt>
+</trkseg></trk>
+<trk><trkseg>
+<trkpt lat="10.5" lon="10"></trkpt>
+<trkpt lat="0.5" lon="179.999"></trkpt>
+<trkpt lat="0.5" lon="-179.999"></trkpt>
+</trkseg></trk>
+</gpx>`
+)
+
+type testSpatialDataAccessor struct {
+}
+
+func (tsda *testSpatialDataAccessor) Open(label string) (io.ReadCloser, error) {
+    data := gpxreader.TestGpxData
+    if label == "a" {
+        data = testSpatialGpxData
+    }
+
+    return ioutil.NopCloser(bytes.NewBufferString(data)), nil
+}
+
+func getTestSpatialIndex(cellSize float64) *SpatialIndex {
+    si := NewSpatialIndex(new(testSpatialDataAccessor), cellSize, nil)
+
+    count, err := si.Add("a")
+    log.PanicIf(err)
+
+    if count != 6 {
+        log.Panicf("point count not correct: (%d)", count)
+    }
+
+    count, err = si.Add("b")
+    log.PanicIf(err)
+
+    if count != 204 {
+        log.Panicf("point count not correct: (%d)", count)
+    }
+
+    return si
+}
+
+func TestSpatialIndex_Add(t *testing.T) {
+    si := getTestSpatialIndex(0)
+
+    if si.Len() != 210 {
+        t.Fatalf("Length not correct: (%d)", si.Len())
+    }
+
+    last := si.entries[5]
+    if last.Label != "a" || last.TrackIndex != 1 || last.SegmentIndex != 0 || last.PointIndex != 2 {
+        t.Fatalf("Indices not correct: %s", last)
+    }
+}
+
+func TestSpatialIndex_WithinRadius(t *testing.T) {
+    si := getTestSpatialIndex(0)
+
+    center := &gpxcommon.TrackPoint{LatitudeDecimal: 10, LongitudeDecimal: 10.001}
+
+    matches := si.WithinRadius(center, 150)
+
+    if len(matches) != 3 {
+        t.Fatalf("Match count not correct: %v", matches)
+    } else if matches[0].Distance != 0 || matches[0].PointIndex != 1 {
+        t.Fatalf("First match not correct: %s", matches[0])
+    } else if matches[1].SegmentIndex != 0 || matches[1].PointIndex != 0 {
+        t.Fatalf("Second match not correct: %s", matches[1])
+    } else if matches[2].SegmentIndex != 1 || matches[2].PointIndex != 0 {
+        t.Fatalf("Third match not correct: %s", matches[2])
+    } else if matches[1].Distance < 100 || matches[1].Distance > 120 {
+        t.Fatalf("Distance not correct: (%f)", matches[1].Distance)
+    }
+}
+
+func TestSpatialIndex_WithinRadius_Antimeridian(t *testing.T) {
+    si := getTestSpatialIndex(0)
+
+    center := &gpxcommon.TrackPoint{LatitudeDecimal: 0.5, LongitudeDecimal: 180}
+
+    matches := si.WithinRadius(center, 200)
+
+    if len(matches) != 2 {
+        t.Fatalf("Match count not correct: %v", matches)
+    }
+}
+
+func TestSpatialIndex_WithinRadius_BruteForce(t *testing.T) {
+    si := getTestSpatialIndex(0.001)
+
+    points, err := gpxreader.ExtractTrackPoints(bytes.NewBufferString(gpxreader.TestGpxData))
+    log.PanicIf(err)
+
+    for _, radius := range []float64{50, 300, 2000} {
+        for i := 0; i < len(points); i += 25 {
+            center := &points[i]
+
+            expected := 0
+            for j := range si.entries {
+                if Distance(center, &si.entries[j].Point) <= radius {
+                    expected++
+                }
+            }
+
+            matches := si.WithinRadius(center, radius)
+            if len(matches) != expected {
+                t.Fatalf("Match count not correct for radius (%f) around (%d): (%d) != (%d)", radius, i, len(matches), expected)
+            }
+        }
+    }
+}
+
+func TestSpatialIndex_WithinBounds(t *testing.T) {
+    si := getTestSpatialIndex(0)
+
+    b := gpxcommon.Bounds{
+        MinLatitude:  47,
+        MinLongitude: -123,
+        MaxLatitude:  48,
+        MaxLongitude: -122,
+    }
+
+    expected := 0
+    for _, sm := range si.entries {
+        tp := sm.Point
+        if tp.LatitudeDecimal >= b.MinLatitude && tp.LatitudeDecimal <= b.MaxLatitude && tp.LongitudeDecimal >= b.MinLongitude && tp.LongitudeDecimal <= b.MaxLongitude {
+            expected++
+        }
+    }
+
+    matches := si.WithinBounds(b)
+
+    if len(matches) != 192 || len(matches) != expected {
+        t.Fatalf("Match count not correct: (%d) != (%d)", len(matches), expected)
+    }
+
+    for _, sm := range matches {
+        if sm.Label != "b" {
+            t.Fatalf("Match not correct: %s", sm)
+        }
+    }
+
+    // Across the antimeridian.
+
+    b = gpxcommon.Bounds{
+        MinLatitude:  0,
+        MinLongitude: 179.99,
+        MaxLatitude:  1,
+        MaxLongitude: -179.99,
+    }
+
+    matches = si.WithinBounds(b)
+
+    if len(matches) != 2 {
+        t.Fatalf("Match count not correct: %v", matches)
+    }
+}
+
+func TestSpatialIndex_Nearest(t *testing.T) {
+    si := getTestSpatialIndex(0)
+
+    center := &gpxcommon.TrackPoint{LatitudeDecimal: 10.4, LongitudeDecimal: 10}
+
+    matches := si.Nearest(center, 2)
+
+    if len(matches) != 2 {
+        t.Fatalf("Match count not correct: %v", matches)
+    } else if matches[0].TrackIndex != 1 || matches[0].PointIndex != 0 {
+        t.Fatalf("First match not correct: %s", matches[0])
+    } else if matches[1].TrackIndex != 0 || matches[1].SegmentIndex != 0 || matches[1].PointIndex != 0 {
+        t.Fatalf("Second match not correct: %s", matches[1])
+    }
+
+    matches = si.Nearest(center, 1000)
+
+    if len(matches) != 210 {
+        t.Fatalf("Match count not correct: (%d)", len(matches))
+    }
+
+    for i := 1; i < len(matches); i++ {
+        if matches[i].Distance < matches[i-1].Distance {
+            t.Fatalf("Matches not ordered by distance at (%d).", i)
+        }
+    }
+}
+
+func TestSpatialIndex_Nearest_BruteForce(t *testing.T) {
+    si := getTestSpatialIndex(0)
+
+    points, err := gpxreader.ExtractTrackPoints(bytes.NewBufferString(gpxreader.TestGpxData))
+    log.PanicIf(err)
+
+    for i := 0; i < len(points); i += 25 {
+        center := &points[i]
+
+        matches := si.Nearest(center, 5)
+        if len(matches) != 5 {
+            t.Fatalf("Match count not correct: (%d)", len(matches))
+        }
+
+        closer := 0
+        for j := range si.entries {
+            if Distance(center, &si.entries[j].Point) < matches[4].Distance {
+                closer++
+            }
+        }
+
+        if closer > 4 {
+            t.Fatalf("Points closer than the fifth match around (%d): (%d)", i, closer)
+        }
+    }
+}
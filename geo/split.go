@@ -0,0 +1,120 @@
+package gpxgeo
+
+import (
+    "io"
+    "time"
+
+    "github.com/dsoprea/go-logging"
+
+    "github.com/dsoprea/go-gpx"
+    "github.com/dsoprea/go-gpx/pipe"
+    "github.com/dsoprea/go-gpx/writer"
+)
+
+const (
+    // DefaultMaxTimeGap separates recordings from different outings.
+    DefaultMaxTimeGap = 30 * time.Minute
+
+    // DefaultMaxSegmentSpeed is 360 kilometers per hour, in meters per second.
+    // Anything faster is assumed to be a bad fix.
+    DefaultMaxSegmentSpeed = 100.0
+)
+
+// SplitOptions decides where segments are split. Zero disables a threshold.
+type SplitOptions struct {
+    // MaxTimeGap is the longest allowed time between consecutive points.
+    MaxTimeGap time.Duration
+
+    // MaxSpeed is the fastest allowed speed (m/s) implied by the distance and
+    // time between consecutive points.
+    MaxSpeed float64
+
+    // DistanceFunc defaults to Distance if not set.
+    DistanceFunc DistanceFunc
+}
+
+// DefaultSplitOptions returns the options used if none are given.
+func DefaultSplitOptions() SplitOptions {
+    return SplitOptions{
+        MaxTimeGap:   DefaultMaxTimeGap,
+        MaxSpeed:     DefaultMaxSegmentSpeed,
+        DistanceFunc: Distance,
+    }
+}
+
+// IsBreak returns true if a new segment should start at `current`. Points
+// without times never cause a split.
+func (so SplitOptions) IsBreak(previous, current *gpxcommon.TrackPoint) bool {
+    if previous.Time.IsZero() == true || current.Time.IsZero() == true {
+        return false
+    }
+
+    duration := current.Time.Sub(previous.Time)
+
+    if so.MaxTimeGap > 0 && duration > so.MaxTimeGap {
+        return true
+    }
+
+    if so.MaxSpeed > 0 && duration > 0 {
+        df := so.DistanceFunc
+        if df == nil {
+            df = Distance
+        }
+
+        speed := df(previous, current) / duration.Seconds()
+        if speed > so.MaxSpeed {
+            return true
+        }
+    }
+
+    return false
+}
+
+// SplitPoints splits the points of one segment into as many segments as the
+// options require. The points are not copied.
+func SplitPoints(points []gpxcommon.TrackPoint, options SplitOptions) [][]gpxcommon.TrackPoint {
+    segments := make([][]gpxcommon.TrackPoint, 0)
+
+    if len(points) == 0 {
+        return segments
+    }
+
+    start := 0
+    for i := 1; i < len(points); i++ {
+        if options.IsBreak(&points[i-1], &points[i]) == true {
+            segments = append(segments, points[start:i])
+            start = i
+        }
+    }
+
+    segments = append(segments, points[start:])
+
+    return segments
+}
+
+// SplitStage returns a pipeline stage that starts a new segment wherever the
+// options require.
+func SplitStage(options SplitOptions) gpxpipe.Stage {
+    pp := func(previous, current *gpxcommon.TrackPoint) (bool, error) {
+        return options.IsBreak(previous, current), nil
+    }
+
+    return gpxpipe.SplitSegment(pp)
+}
+
+// SplitSegments streams the GPX data to the builder, splitting segments
+// wherever the options require. The document is closed when done.
+func SplitSegments(r io.Reader, b *gpxwriter.Builder, options SplitOptions) (err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    p := gpxpipe.NewPipeline(SplitStage(options))
+
+    err = p.Write(r, b)
+    log.PanicIf(err)
+
+    return nil
+}
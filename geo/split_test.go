@@ -0,0 +1,86 @@
+package gpxgeo
+
+import (
+    "bytes"
+    "fmt"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/dsoprea/go-logging"
+
+    "github.com/dsoprea/go-gpx"
+    "github.com/dsoprea/go-gpx/writer"
+)
+
+// getSplitTestPoints returns points a minute apart, with a two hour gap
+// before the fourth point and a teleport (about 111 kilometers in a minute)
+// at the sixth point.
+func getSplitTestPoints() []gpxcommon.TrackPoint {
+    epoch := time.Date(2016, 12, 2, 8, 0, 0, 0, time.UTC)
+
+    offsets := []time.Duration{0, 1, 2, 122, 123, 124, 125}
+    latitudes := []float64{10, 10.001, 10.002, 10.003, 10.004, 11.004, 11.005}
+
+    points := make([]gpxcommon.TrackPoint, len(offsets))
+    for i := range points {
+        points[i] = gpxcommon.TrackPoint{
+            LatitudeDecimal:  latitudes[i],
+            LongitudeDecimal: 10,
+            Time:             epoch.Add(offsets[i] * time.Minute),
+        }
+    }
+
+    return points
+}
+
+func TestSplitPoints(t *testing.T) {
+    segments := SplitPoints(getSplitTestPoints(), DefaultSplitOptions())
+
+    if len(segments) != 3 {
+        t.Fatalf("Segment count not correct: (%d)", len(segments))
+    } else if len(segments[0]) != 3 || len(segments[1]) != 2 || len(segments[2]) != 2 {
+        t.Fatalf("Segment sizes not correct: (%d) (%d) (%d)", len(segments[0]), len(segments[1]), len(segments[2]))
+    }
+}
+
+func TestSplitPoints_Disabled(t *testing.T) {
+    segments := SplitPoints(getSplitTestPoints(), SplitOptions{})
+
+    if len(segments) != 1 || len(segments[0]) != 7 {
+        t.Fatalf("Points should not have been split: (%d)", len(segments))
+    }
+
+    segments = SplitPoints(nil, DefaultSplitOptions())
+
+    if len(segments) != 0 {
+        t.Fatalf("No segments expected for no points: (%d)", len(segments))
+    }
+}
+
+func TestSplitSegments(t *testing.T) {
+    points := getSplitTestPoints()
+
+    input := new(bytes.Buffer)
+    input.WriteString(`<?xml version="1.0" encoding="UTF-8" ?><gpx version="1.0"><trk><trkseg>`)
+
+    for _, tp := range points {
+        fmt.Fprintf(input, `<trkpt lat="%f" lon="%f"><time>%s</time></trkpt>`, tp.LatitudeDecimal, tp.LongitudeDecimal, tp.Time.Format(time.RFC3339))
+    }
+
+    input.WriteString(`</trkseg></trk></gpx>`)
+
+    output := new(bytes.Buffer)
+
+    b, err := gpxwriter.NewBuilder(output)
+    log.PanicIf(err)
+
+    err = SplitSegments(input, b, DefaultSplitOptions())
+    log.PanicIf(err)
+
+    if count := strings.Count(output.String(), "<trkseg>"); count != 3 {
+        t.Fatalf("Segment count not correct: (%d)\n%s", count, output.String())
+    } else if count := strings.Count(output.String(), "<trkpt "); count != 7 {
+        t.Fatalf("Point count not correct: (%d)", count)
+    }
+}
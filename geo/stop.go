@@ -0,0 +1,368 @@
+package gpxgeo
+
+import (
+    "fmt"
+    "io"
+    "time"
+
+    "github.com/dsoprea/go-logging"
+
+    "github.com/dsoprea/go-gpx"
+    "github.com/dsoprea/go-gpx/reader"
+    "github.com/dsoprea/go-gpx/writer"
+)
+
+const (
+    // DefaultStopRadius and DefaultStopMinDuration are the values commonly
+    // used for stay-point detection.
+    DefaultStopRadius      = 200.0
+    DefaultStopMinDuration = 20 * time.Minute
+)
+
+// Stop is a place where we stayed for a while.
+type Stop struct {
+    // Center is the average position (and elevation, if any) of the points.
+    Center gpxcommon.TrackPoint
+
+    Arrival    time.Time
+    Departure  time.Time
+    PointCount int
+}
+
+func (s *Stop) Duration() time.Duration {
+    return s.Departure.Sub(s.Arrival)
+}
+
+func (s *Stop) String() string {
+    return fmt.Sprintf("Stop<LAT=(%.8f) LON=(%.8f) ARRIVAL=[%s] DEPARTURE=[%s] POINTS=(%d)>", s.Center.LatitudeDecimal, s.Center.LongitudeDecimal, s.Arrival, s.Departure, s.PointCount)
+}
+
+// StopOptions controls stay-point detection.
+type StopOptions struct {
+    // Radius is how far (m) the points can be from the first point of the
+    // stop.
+    Radius float64
+
+    // MinDuration is how long we have to stay within the radius.
+    MinDuration time.Duration
+
+    // DistanceFunc defaults to Distance if not set.
+    DistanceFunc DistanceFunc
+}
+
+// DefaultStopOptions returns the options used if none are given.
+func DefaultStopOptions() StopOptions {
+    return StopOptions{
+        Radius:       DefaultStopRadius,
+        MinDuration:  DefaultStopMinDuration,
+        DistanceFunc: Distance,
+    }
+}
+
+// stopDetector finds stay-points in one segment at a time. Only the points
+// that might still be part of a stop are retained.
+type stopDetector struct {
+    options StopOptions
+
+    pending []gpxcommon.TrackPoint
+
+    // within is the number of pending points (including the first) that are
+    // known to be within the radius of the first.
+    within int
+}
+
+func newStopDetector(options StopOptions) *stopDetector {
+    if options.DistanceFunc == nil {
+        options.DistanceFunc = Distance
+    }
+
+    return &stopDetector{
+        options: options,
+        pending: make([]gpxcommon.TrackPoint, 0),
+    }
+}
+
+// add processes the next point and returns any stops that have ended. Points
+// without times are skipped.
+func (sd *stopDetector) add(tp *gpxcommon.TrackPoint) []Stop {
+    if tp.Time.IsZero() == true {
+        return nil
+    }
+
+    sd.pending = append(sd.pending, *tp)
+
+    return sd.evaluate(false)
+}
+
+// flush ends the segment and returns the last stop, if any.
+func (sd *stopDetector) flush() []Stop {
+    stops := sd.evaluate(true)
+
+    sd.pending = sd.pending[:0]
+    sd.within = 0
+
+    return stops
+}
+
+// evaluate finds the stops that are complete. If `final` is false then the
+// points at the end are kept because the next point might still be part of
+// the same stop.
+func (sd *stopDetector) evaluate(final bool) (stops []Stop) {
+    for len(sd.pending) > 0 {
+        if sd.within < 1 {
+            sd.within = 1
+        }
+
+        anchor := &sd.pending[0]
+
+        for sd.within < len(sd.pending) && sd.options.DistanceFunc(anchor, &sd.pending[sd.within]) <= sd.options.Radius {
+            sd.within++
+        }
+
+        if sd.within == len(sd.pending) && final == false {
+            break
+        }
+
+        last := &sd.pending[sd.within-1]
+
+        if last.Time.Sub(anchor.Time) >= sd.options.MinDuration {
+            stops = append(stops, newStop(sd.pending[:sd.within]))
+            sd.pending = append(sd.pending[:0], sd.pending[sd.within:]...)
+        } else {
+            sd.pending = append(sd.pending[:0], sd.pending[1:]...)
+        }
+
+        sd.within = 0
+    }
+
+    return stops
+}
+
+// averagePosition returns the average position of the points, and the
+// average elevation of those that have one.
+func averagePosition(points []gpxcommon.TrackPoint) gpxcommon.TrackPoint {
+    latitudeSum := 0.0
+    longitudeSum := 0.0
+    elevationSum := 0.0
+    elevationCount := 0
+
+    for _, tp := range points {
+        latitudeSum += tp.LatitudeDecimal
+        longitudeSum += tp.LongitudeDecimal
+
+        if tp.Elevation != 0 {
+            elevationSum += float64(tp.Elevation)
+            elevationCount++
+        }
+    }
+
+    average := gpxcommon.TrackPoint{
+        LatitudeDecimal:  latitudeSum / float64(len(points)),
+        LongitudeDecimal: longitudeSum / float64(len(points)),
+    }
+
+    if elevationCount > 0 {
+        average.Elevation = float32(elevationSum / float64(elevationCount))
+    }
+
+    return average
+}
+
+// newStop describes the given points.
+func newStop(points []gpxcommon.TrackPoint) Stop {
+    return Stop{
+        Center:     averagePosition(points),
+        Arrival:    points[0].Time,
+        Departure:  points[len(points)-1].Time,
+        PointCount: len(points),
+    }
+}
+
+// DetectStops returns the places in a single segment where we stayed within
+// the radius for at least the minimum duration.
+func DetectStops(points []gpxcommon.TrackPoint, options StopOptions) []Stop {
+    sd := newStopDetector(options)
+
+    stops := make([]Stop, 0)
+    for i := range points {
+        stops = append(stops, sd.add(&points[i])...)
+    }
+
+    stops = append(stops, sd.flush()...)
+
+    return stops
+}
+
+// stopVisitor runs the detector while the document is parsed.
+type stopVisitor struct {
+    sd    *stopDetector
+    stops []Stop
+}
+
+func (sv *stopVisitor) TrackSegmentOpen(ts *gpxcommon.TrackSegment) error {
+    return nil
+}
+
+func (sv *stopVisitor) TrackSegmentClose(ts *gpxcommon.TrackSegment) error {
+    sv.stops = append(sv.stops, sv.sd.flush()...)
+
+    return nil
+}
+
+func (sv *stopVisitor) TrackPointOpen(tp *gpxcommon.TrackPoint) error {
+    return nil
+}
+
+func (sv *stopVisitor) TrackPointClose(tp *gpxcommon.TrackPoint) error {
+    sv.stops = append(sv.stops, sv.sd.add(tp)...)
+
+    return nil
+}
+
+// FindStops streams the GPX data and returns the stops in every segment.
+// Stops never span segments.
+func FindStops(r io.Reader, options StopOptions) (stops []Stop, err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    sv := &stopVisitor{
+        sd:    newStopDetector(options),
+        stops: make([]Stop, 0),
+    }
+
+    gp := gpxreader.NewGpxParser(r, sv)
+
+    err = gp.Parse()
+    log.PanicIf(err)
+
+    return sv.stops, nil
+}
+
+// Place is a cluster of stops at the same location, such as from different
+// days or different files.
+type Place struct {
+    // Center is the average of the centers of the stops.
+    Center gpxcommon.TrackPoint
+
+    Stops []Stop
+}
+
+func (p *Place) String() string {
+    return fmt.Sprintf("Place<LAT=(%.8f) LON=(%.8f) STOPS=(%d)>", p.Center.LatitudeDecimal, p.Center.LongitudeDecimal, len(p.Stops))
+}
+
+// ClusterStops groups the stops into places using DBSCAN. Stops that are
+// within `epsilon` meters of each other are neighbors, and a place needs at
+// least `minStops` stops (counting the stop itself) within the neighborhood
+// of one of its stops. Stops that do not belong to a place are not returned.
+// `df` defaults to Distance if nil.
+func ClusterStops(stops []Stop, epsilon float64, minStops int, df DistanceFunc) []Place {
+    if df == nil {
+        df = Distance
+    }
+
+    const (
+        unvisited = 0
+        noise     = -1
+    )
+
+    // labels has the cluster number (starting from one) of every stop.
+    labels := make([]int, len(stops))
+
+    neighbors := func(i int) []int {
+        found := make([]int, 0)
+        for j := range stops {
+            if df(&stops[i].Center, &stops[j].Center) <= epsilon {
+                found = append(found, j)
+            }
+        }
+
+        return found
+    }
+
+    cluster := 0
+    for i := range stops {
+        if labels[i] != unvisited {
+            continue
+        }
+
+        seeds := neighbors(i)
+        if len(seeds) < minStops {
+            labels[i] = noise
+            continue
+        }
+
+        cluster++
+        labels[i] = cluster
+
+        for k := 0; k < len(seeds); k++ {
+            j := seeds[k]
+
+            if labels[j] == noise {
+                // A border stop.
+                labels[j] = cluster
+            }
+
+            if labels[j] != unvisited {
+                continue
+            }
+
+            labels[j] = cluster
+
+            if expanded := neighbors(j); len(expanded) >= minStops {
+                seeds = append(seeds, expanded...)
+            }
+        }
+    }
+
+    places := make([]Place, cluster)
+    for i, label := range labels {
+        if label <= 0 {
+            continue
+        }
+
+        places[label-1].Stops = append(places[label-1].Stops, stops[i])
+    }
+
+    for i := range places {
+        centers := make([]gpxcommon.TrackPoint, len(places[i].Stops))
+        for j, s := range places[i].Stops {
+            centers[j] = s.Center
+        }
+
+        places[i].Center = averagePosition(centers)
+    }
+
+    return places
+}
+
+// WriteStopWaypoints writes a waypoint at the center of each stop. The time is
+// the arrival, the type is "stop", and the description has the arrival,
+// departure, and duration.
+func WriteStopWaypoints(gb *gpxwriter.GpxBuilder, stops []Stop) (err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    for i, s := range stops {
+        gwb := gb.Waypoint()
+
+        gwb.LatitudeDecimal = s.Center.LatitudeDecimal
+        gwb.LongitudeDecimal = s.Center.LongitudeDecimal
+        gwb.Elevation = s.Center.Elevation
+        gwb.Time = s.Arrival
+        gwb.Name = fmt.Sprintf("Stop %d", i+1)
+        gwb.Description = fmt.Sprintf("%s to %s (%s)", s.Arrival.Format(time.RFC3339), s.Departure.Format(time.RFC3339), s.Duration())
+        gwb.Type = "stop"
+
+        err := gwb.Write()
+        log.PanicIf(err)
+    }
+
+    return nil
+}
@@ -0,0 +1,189 @@
+package gpxgeo
+
+import (
+    "bytes"
+    "fmt"
+    "math"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/dsoprea/go-logging"
+
+    "github.com/dsoprea/go-gpx"
+    "github.com/dsoprea/go-gpx/writer"
+)
+
+// getStopTestPoints drives for five minutes, parks for 30 minutes (with
+// about ten meters of jitter), drives for five more minutes, and then
+// briefly waits at a light. Points are a minute apart.
+func getStopTestPoints(epoch time.Time) []gpxcommon.TrackPoint {
+    points := make([]gpxcommon.TrackPoint, 0)
+
+    add := func(latitude, longitude float64) {
+        tp := gpxcommon.TrackPoint{
+            LatitudeDecimal:  latitude,
+            LongitudeDecimal: longitude,
+            Time:             epoch.Add(time.Duration(len(points)) * time.Minute),
+        }
+
+        points = append(points, tp)
+    }
+
+    for i := 0; i < 5; i++ {
+        add(10, 10+float64(i)*0.01)
+    }
+
+    for i := 0; i <= 30; i++ {
+        add(10+float64(i%2)*0.0001, 10.05)
+    }
+
+    for i := 1; i <= 5; i++ {
+        add(10, 10.05+float64(i)*0.01)
+    }
+
+    for i := 0; i < 3; i++ {
+        add(10, 10.1)
+    }
+
+    for i := 1; i <= 5; i++ {
+        add(10, 10.1+float64(i)*0.01)
+    }
+
+    return points
+}
+
+func TestDetectStops(t *testing.T) {
+    epoch := time.Date(2016, 12, 2, 8, 0, 0, 0, time.UTC)
+    points := getStopTestPoints(epoch)
+
+    stops := DetectStops(points, DefaultStopOptions())
+
+    if len(stops) != 1 {
+        t.Fatalf("Stop count not correct: (%d) %v", len(stops), stops)
+    }
+
+    s := stops[0]
+
+    if s.Arrival.Equal(epoch.Add(5*time.Minute)) == false {
+        t.Fatalf("Arrival not correct: %s", &s)
+    } else if s.Departure.Equal(epoch.Add(35*time.Minute)) == false {
+        t.Fatalf("Departure not correct: %s", &s)
+    } else if s.PointCount != 31 {
+        t.Fatalf("Point count not correct: %s", &s)
+    } else if math.Abs(s.Center.LongitudeDecimal-10.05) > 1e-9 || s.Center.LatitudeDecimal <= 10 || s.Center.LatitudeDecimal >= 10.0001 {
+        t.Fatalf("Center not correct: %s", &s)
+    }
+
+    // The light (where we arrive on the last driving point) is long enough
+    // if we lower the minimum.
+    options := DefaultStopOptions()
+    options.MinDuration = 2 * time.Minute
+
+    stops = DetectStops(points, options)
+
+    if len(stops) != 2 {
+        t.Fatalf("Stop count not correct: (%d) %v", len(stops), stops)
+    } else if stops[1].PointCount != 4 {
+        t.Fatalf("Second stop not correct: %s", &stops[1])
+    }
+}
+
+func TestDetectStops_EndsInStop(t *testing.T) {
+    epoch := time.Date(2016, 12, 2, 8, 0, 0, 0, time.UTC)
+    points := getStopTestPoints(epoch)[:36]
+
+    stops := DetectStops(points, DefaultStopOptions())
+
+    if len(stops) != 1 || stops[0].PointCount != 31 {
+        t.Fatalf("Stop at end of segment not found: %v", stops)
+    }
+}
+
+func TestFindStops(t *testing.T) {
+    epoch := time.Date(2016, 12, 2, 8, 0, 0, 0, time.UTC)
+    points := getStopTestPoints(epoch)
+
+    // Split the parked time across two segments.
+    b := new(bytes.Buffer)
+    b.WriteString(`<?xml version="1.0" encoding="UTF-8" ?><gpx version="1.0"><trk><trkseg>`)
+
+    for i, tp := range points {
+        if i == 20 {
+            b.WriteString(`</trkseg><trkseg>`)
+        }
+
+        fmt.Fprintf(b, `<trkpt lat="%f" lon="%f"><time>%s</time></trkpt>`, tp.LatitudeDecimal, tp.LongitudeDecimal, tp.Time.Format(time.RFC3339))
+    }
+
+    b.WriteString(`</trkseg></trk></gpx>`)
+
+    stops, err := FindStops(b, DefaultStopOptions())
+    log.PanicIf(err)
+
+    // Neither half is long enough by itself.
+    if len(stops) != 0 {
+        t.Fatalf("Stops should not span segments: %v", stops)
+    }
+}
+
+func TestClusterStops(t *testing.T) {
+    stops := make([]Stop, 0)
+
+    // Three days at the same place, plus one visit somewhere else.
+    for day := 0; day < 3; day++ {
+        epoch := time.Date(2016, 12, 2+day, 8, 0, 0, 0, time.UTC)
+        stops = append(stops, DetectStops(getStopTestPoints(epoch), DefaultStopOptions())...)
+    }
+
+    other := Stop{
+        Center: gpxcommon.TrackPoint{LatitudeDecimal: 20, LongitudeDecimal: 20},
+    }
+
+    stops = append(stops, other)
+
+    places := ClusterStops(stops, 100, 2, nil)
+
+    if len(places) != 1 {
+        t.Fatalf("Place count not correct: (%d)", len(places))
+    } else if len(places[0].Stops) != 3 {
+        t.Fatalf("Stop count not correct: %s", &places[0])
+    } else if math.Abs(places[0].Center.LongitudeDecimal-10.05) > 1e-9 {
+        t.Fatalf("Center not correct: %s", &places[0])
+    }
+
+    places = ClusterStops(stops, 100, 1, nil)
+
+    if len(places) != 2 {
+        t.Fatalf("Place count with a single stop not correct: (%d)", len(places))
+    }
+}
+
+func TestWriteStopWaypoints(t *testing.T) {
+    epoch := time.Date(2016, 12, 2, 8, 0, 0, 0, time.UTC)
+    stops := DetectStops(getStopTestPoints(epoch), DefaultStopOptions())
+
+    output := new(bytes.Buffer)
+
+    b, err := gpxwriter.NewBuilder(output)
+    log.PanicIf(err)
+
+    gb, err := b.Gpx()
+    log.PanicIf(err)
+
+    err = WriteStopWaypoints(gb, stops)
+    log.PanicIf(err)
+
+    err = gb.EndGpx()
+    log.PanicIf(err)
+
+    s := output.String()
+
+    if strings.Count(s, "<wpt ") != 1 {
+        t.Fatalf("Waypoint not written:\n%s", s)
+    } else if strings.Contains(s, "<name>Stop 1</name>") == false || strings.Contains(s, "<type>stop</type>") == false {
+        t.Fatalf("Waypoint not correct:\n%s", s)
+    } else if strings.Contains(s, "(30m0s)") == false {
+        t.Fatalf("Duration not described:\n%s", s)
+    }
+}
@@ -0,0 +1,301 @@
+package gpxgeo
+
+import (
+    "fmt"
+    "io"
+    "os"
+    "time"
+
+    "github.com/dsoprea/go-logging"
+
+    "github.com/dsoprea/go-gpx"
+    "github.com/dsoprea/go-gpx/reader"
+)
+
+// SummaryStatistics are collected for the whole file and for each track.
+// Distances are in meters and speeds in meters per second. Points with an
+// elevation of exactly zero are assumed to not have one.
+type SummaryStatistics struct {
+    Start time.Time
+    Stop  time.Time
+
+    PointCount   int
+    SegmentCount int
+
+    // SourceCounts is the number of points for each value of `src` (e.g.
+    // "gps" or "network"). Points without one are counted under "".
+    SourceCounts map[string]int
+
+    // Bounds is only meaningful if there are points.
+    Bounds gpxcommon.Bounds
+
+    Distance float64
+
+    // ElevationCount is the number of points with an elevation. The other
+    // elevation values are only meaningful if this is not zero.
+    ElevationCount   int
+    MinElevation     float32
+    MaxElevation     float32
+    AverageElevation float32
+
+    // Ascent and Descent are the sums of the climbs and drops between
+    // consecutive points that have elevations.
+    Ascent  float64
+    Descent float64
+
+    // AverageSpeed is over all of the timed intervals and
+    // AverageMovingSpeed is over just the moving ones. The maximum speed is
+    // in Moving.
+    AverageSpeed       float64
+    AverageMovingSpeed float64
+
+    Moving gpxcommon.MovingData
+}
+
+func (ss *SummaryStatistics) String() string {
+    return fmt.Sprintf("SummaryStatistics<START=[%s] STOP=[%s] POINTS=(%d) SEGMENTS=(%d) DIST=(%.3f) ASCENT=(%.3f) DESCENT=(%.3f) AVG-SPEED=(%.3f) MAX-SPEED=(%.3f)>", ss.Start, ss.Stop, ss.PointCount, ss.SegmentCount, ss.Distance, ss.Ascent, ss.Descent, ss.AverageSpeed, ss.Moving.MaxSpeed)
+}
+
+// DetailedSummary has the statistics for the whole file and for each track.
+type DetailedSummary struct {
+    SummaryStatistics
+
+    TrackCount int
+    Tracks     []SummaryStatistics
+}
+
+// summaryAccumulator collects the statistics for one scope (the file or a
+// track).
+type summaryAccumulator struct {
+    ss           *SummaryStatistics
+    elevationSum float64
+}
+
+func newSummaryAccumulator(ss *SummaryStatistics) *summaryAccumulator {
+    ss.SourceCounts = make(map[string]int)
+
+    return &summaryAccumulator{
+        ss: ss,
+    }
+}
+
+func (sa *summaryAccumulator) addSegment() {
+    sa.ss.SegmentCount++
+}
+
+// addPoint processes a point. `distance` and `climb` are relative to the
+// previous point (or previous point with an elevation) in the segment.
+func (sa *summaryAccumulator) addPoint(tp *gpxcommon.TrackPoint, distance float64, climb float64) {
+    ss := sa.ss
+
+    if ss.PointCount == 0 {
+        ss.Bounds = gpxcommon.Bounds{
+            MinLatitude:  tp.LatitudeDecimal,
+            MinLongitude: tp.LongitudeDecimal,
+            MaxLatitude:  tp.LatitudeDecimal,
+            MaxLongitude: tp.LongitudeDecimal,
+        }
+    } else {
+        if tp.LatitudeDecimal < ss.Bounds.MinLatitude {
+            ss.Bounds.MinLatitude = tp.LatitudeDecimal
+        } else if tp.LatitudeDecimal > ss.Bounds.MaxLatitude {
+            ss.Bounds.MaxLatitude = tp.LatitudeDecimal
+        }
+
+        if tp.LongitudeDecimal < ss.Bounds.MinLongitude {
+            ss.Bounds.MinLongitude = tp.LongitudeDecimal
+        } else if tp.LongitudeDecimal > ss.Bounds.MaxLongitude {
+            ss.Bounds.MaxLongitude = tp.LongitudeDecimal
+        }
+    }
+
+    ss.PointCount++
+    ss.SourceCounts[tp.Src]++
+    ss.Distance += distance
+
+    if climb > 0 {
+        ss.Ascent += climb
+    } else {
+        ss.Descent -= climb
+    }
+
+    if tp.Time.IsZero() == false {
+        if ss.Start.IsZero() == true || tp.Time.Before(ss.Start) == true {
+            ss.Start = tp.Time
+        }
+
+        if ss.Stop.IsZero() == true || tp.Time.After(ss.Stop) == true {
+            ss.Stop = tp.Time
+        }
+    }
+
+    if tp.Elevation != 0 {
+        if ss.ElevationCount == 0 || tp.Elevation < ss.MinElevation {
+            ss.MinElevation = tp.Elevation
+        }
+
+        if ss.ElevationCount == 0 || tp.Elevation > ss.MaxElevation {
+            ss.MaxElevation = tp.Elevation
+        }
+
+        ss.ElevationCount++
+        sa.elevationSum += float64(tp.Elevation)
+    }
+}
+
+func (sa *summaryAccumulator) addMovingData(md gpxcommon.MovingData) {
+    mergeMovingData(&sa.ss.Moving, md)
+}
+
+// finish calculates the averages.
+func (sa *summaryAccumulator) finish() {
+    ss := sa.ss
+
+    if ss.ElevationCount > 0 {
+        ss.AverageElevation = float32(sa.elevationSum / float64(ss.ElevationCount))
+    }
+
+    md := ss.Moving
+
+    if total := md.MovingTime + md.StoppedTime; total > 0 {
+        ss.AverageSpeed = (md.MovingDistance + md.StoppedDistance) / total.Seconds()
+    }
+
+    if md.MovingTime > 0 {
+        ss.AverageMovingSpeed = md.MovingDistance / md.MovingTime.Seconds()
+    }
+}
+
+// summaryVisitor feeds every point to the file and current-track accumulators
+// so that everything is calculated in one pass.
+type summaryVisitor struct {
+    df  DistanceFunc
+    mdc *movingDataCalculator
+
+    ds    *DetailedSummary
+    file  *summaryAccumulator
+    track *summaryAccumulator
+
+    previous          *gpxcommon.TrackPoint
+    previousElevation float32
+}
+
+func (sv *summaryVisitor) TrackOpen(t *gpxcommon.Track) error {
+    sv.ds.TrackCount++
+    sv.ds.Tracks = append(sv.ds.Tracks, SummaryStatistics{})
+    sv.track = newSummaryAccumulator(&sv.ds.Tracks[len(sv.ds.Tracks)-1])
+
+    return nil
+}
+
+func (sv *summaryVisitor) TrackClose(t *gpxcommon.Track) error {
+    sv.track.finish()
+    sv.track = nil
+
+    return nil
+}
+
+func (sv *summaryVisitor) TrackSegmentOpen(ts *gpxcommon.TrackSegment) error {
+    sv.previous = nil
+    sv.previousElevation = 0
+    sv.mdc.reset()
+
+    sv.file.addSegment()
+    sv.track.addSegment()
+
+    return nil
+}
+
+func (sv *summaryVisitor) TrackSegmentClose(ts *gpxcommon.TrackSegment) error {
+    md := sv.mdc.result()
+
+    sv.file.addMovingData(md)
+    sv.track.addMovingData(md)
+
+    return nil
+}
+
+func (sv *summaryVisitor) TrackPointOpen(tp *gpxcommon.TrackPoint) error {
+    return nil
+}
+
+func (sv *summaryVisitor) TrackPointClose(tp *gpxcommon.TrackPoint) error {
+    current := *tp
+
+    distance := 0.0
+    if sv.previous != nil {
+        distance = sv.df(sv.previous, &current)
+
+        if sv.previous.Time.IsZero() == false && current.Time.IsZero() == false {
+            sv.mdc.addInterval(current.Time.Sub(sv.previous.Time), distance)
+        }
+    }
+
+    climb := 0.0
+    if current.Elevation != 0 {
+        if sv.previousElevation != 0 {
+            climb = float64(current.Elevation) - float64(sv.previousElevation)
+        }
+
+        sv.previousElevation = current.Elevation
+    }
+
+    sv.file.addPoint(&current, distance, climb)
+    sv.track.addPoint(&current, distance, climb)
+
+    sv.previous = &current
+
+    return nil
+}
+
+// Summarize streams the GPX data and returns statistics for the whole file
+// and for each track, in a single pass. Intervals are never formed across
+// segment boundaries. `options` controls how speeds are calculated.
+func Summarize(r io.Reader, options MovingDataOptions) (ds *DetailedSummary, err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    ds = &DetailedSummary{
+        Tracks: make([]SummaryStatistics, 0),
+    }
+
+    mdc := newMovingDataCalculator(options)
+
+    sv := &summaryVisitor{
+        df:   mdc.options.DistanceFunc,
+        mdc:  mdc,
+        ds:   ds,
+        file: newSummaryAccumulator(&ds.SummaryStatistics),
+    }
+
+    gp := gpxreader.NewGpxParser(r, sv)
+
+    err = gp.Parse()
+    log.PanicIf(err)
+
+    sv.file.finish()
+
+    return ds, nil
+}
+
+// SummarizeFile is Summarize() for a file on disk.
+func SummarizeFile(filepath string, options MovingDataOptions) (ds *DetailedSummary, err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    f, err := os.Open(filepath)
+    log.PanicIf(err)
+
+    defer f.Close()
+
+    ds, err = Summarize(f, options)
+    log.PanicIf(err)
+
+    return ds, nil
+}
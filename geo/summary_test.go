@@ -0,0 +1,114 @@
+package gpxgeo
+
+import (
+    "bytes"
+    "math"
+    "testing"
+    "time"
+
+    "github.com/dsoprea/go-logging"
+
+    "github.com/dsoprea/go-gpx/reader"
+)
+
+func TestSummarize(t *testing.T) {
+    ds, err := Summarize(bytes.NewBufferString(gpxreader.TestGpxData), DefaultMovingDataOptions())
+    log.PanicIf(err)
+
+    if ds.Start.Format(time.RFC3339) != "2016-12-02T08:05:44Z" {
+        t.Fatalf("Start time is not correct.")
+    } else if ds.Stop.Format(time.RFC3339) != "2016-12-03T07:57:07Z" {
+        t.Fatalf("Stop time is not correct.")
+    } else if ds.PointCount != 204 {
+        t.Fatalf("Point count is not correct: (%d)", ds.PointCount)
+    } else if ds.TrackCount != 1 || len(ds.Tracks) != 1 {
+        t.Fatalf("Track count is not correct: (%d)", ds.TrackCount)
+    } else if ds.SegmentCount != 1 {
+        t.Fatalf("Segment count is not correct: (%d)", ds.SegmentCount)
+    }
+
+    if len(ds.SourceCounts) != 2 || ds.SourceCounts["gps"] != 37 || ds.SourceCounts["network"] != 167 {
+        t.Fatalf("Source counts not correct: %v", ds.SourceCounts)
+    }
+
+    b := ds.Bounds
+    if b.MinLatitude != 47.6072374 || b.MaxLatitude != 48.89830966221017 || b.MinLongitude != -122.60703299088209 || b.MaxLongitude != -122.17633570422109 {
+        t.Fatalf("Bounds not correct: %s", &b)
+    }
+
+    if ds.ElevationCount != 37 {
+        t.Fatalf("Elevation count not correct: (%d)", ds.ElevationCount)
+    } else if ds.MinElevation != float32(-36.559077848208034) {
+        t.Fatalf("Minimum elevation not correct: (%f)", ds.MinElevation)
+    } else if ds.MaxElevation != float32(186.34489492647512) {
+        t.Fatalf("Maximum elevation not correct: (%f)", ds.MaxElevation)
+    } else if math.Abs(float64(ds.AverageElevation)-53.98939643268204) > 1e-3 {
+        t.Fatalf("Average elevation not correct: (%f)", ds.AverageElevation)
+    }
+
+    if math.Abs(ds.Ascent-830.7012082288416) > 1e-3 {
+        t.Fatalf("Ascent not correct: (%f)", ds.Ascent)
+    } else if math.Abs(ds.Descent-839.4843471732198) > 1e-3 {
+        t.Fatalf("Descent not correct: (%f)", ds.Descent)
+    }
+
+    lengths, err := TrackLengths(bytes.NewBufferString(gpxreader.TestGpxData), Distance)
+    log.PanicIf(err)
+
+    if math.Abs(ds.Distance-lengths[0]) > 1e-6 {
+        t.Fatalf("Distance not correct: (%f) != (%f)", ds.Distance, lengths[0])
+    }
+
+    mdb, err := CalculateMovingData(bytes.NewBufferString(gpxreader.TestGpxData), DefaultMovingDataOptions())
+    log.PanicIf(err)
+
+    if ds.Moving != mdb.Total {
+        t.Fatalf("Moving data not correct: %s != %s", &ds.Moving, &mdb.Total)
+    }
+
+    elapsed := ds.Stop.Sub(ds.Start).Seconds()
+    if math.Abs(ds.AverageSpeed-ds.Distance/elapsed) > 1e-9 {
+        t.Fatalf("Average speed not correct: (%f)", ds.AverageSpeed)
+    } else if ds.AverageMovingSpeed < ds.AverageSpeed {
+        t.Fatalf("Average moving speed not correct: (%f)", ds.AverageMovingSpeed)
+    }
+
+    // With only one track, the track and the file should agree.
+    track := ds.Tracks[0]
+    if track.PointCount != ds.PointCount || track.Distance != ds.Distance || track.Ascent != ds.Ascent || track.Bounds != ds.Bounds {
+        t.Fatalf("Track summary not correct: %s", &track)
+    }
+}
+
+func TestSummarize_Tracks(t *testing.T) {
+    ds, err := Summarize(bytes.NewBufferString(testLengthGpxData), DefaultMovingDataOptions())
+    log.PanicIf(err)
+
+    if ds.TrackCount != 2 {
+        t.Fatalf("Track count not correct: (%d)", ds.TrackCount)
+    } else if ds.SegmentCount != 3 {
+        t.Fatalf("Segment count not correct: (%d)", ds.SegmentCount)
+    } else if ds.Tracks[0].SegmentCount != 2 || ds.Tracks[1].SegmentCount != 1 {
+        t.Fatalf("Track segment counts not correct.")
+    } else if ds.Tracks[0].PointCount != 4 || ds.Tracks[1].PointCount != 1 {
+        t.Fatalf("Track point counts not correct.")
+    }
+
+    first := ds.Tracks[0]
+    if first.Bounds.MaxLatitude != 11 || first.Bounds.MaxLongitude != 10 {
+        t.Fatalf("Track bounds not correct: %s", &first.Bounds)
+    } else if ds.Bounds.MaxLatitude != 20 || ds.Bounds.MinLatitude != 0 {
+        t.Fatalf("File bounds not correct: %s", &ds.Bounds)
+    }
+
+    if first.ElevationCount != 0 || first.Ascent != 0 {
+        t.Fatalf("Elevation should not be reported.")
+    }
+
+    // The gap between the segments is neither distance nor time.
+    if first.Distance != ds.Distance {
+        t.Fatalf("Distance not correct: (%f) != (%f)", first.Distance, ds.Distance)
+    } else if first.Moving.MovingTime+first.Moving.StoppedTime != 2*time.Minute {
+        t.Fatalf("Time not correct: %s", &first.Moving)
+    }
+}
@@ -0,0 +1,274 @@
+package gpxgeotag
+
+import (
+    "fmt"
+    "sort"
+    "time"
+
+    "github.com/dsoprea/go-logging"
+
+    "github.com/dsoprea/go-gpx"
+    "github.com/dsoprea/go-gpx/geo"
+    "github.com/dsoprea/go-gpx/reader"
+)
+
+var (
+    ErrToleranceTooSmall = fmt.Errorf("index tolerance is smaller than the gaps allowed")
+)
+
+const (
+    // DefaultMaxGap and DefaultMaxTimeDifference are the values used if no
+    // options are given.
+    DefaultMaxGap            = 5 * time.Minute
+    DefaultMaxTimeDifference = time.Minute
+)
+
+// Photo is a picture that was taken at the given time according to the
+// camera clock.
+type Photo struct {
+    Id   string
+    Time time.Time
+}
+
+func (p Photo) String() string {
+    return fmt.Sprintf("Photo<ID=[%s] TIME=[%s]>", p.Id, p.Time)
+}
+
+// Options describes the camera clock and how far we are willing to reach for
+// a position.
+type Options struct {
+    // Location is the time zone that the camera clock was set to. If not
+    // nil, the wall-clock time of each photo (e.g. from EXIF, which has no
+    // zone) is interpreted in this zone, ignoring the zone of the time.
+    Location *time.Location
+
+    // ClockOffset is added to the camera time to get the actual time (e.g.
+    // one minute if the camera clock was a minute slow).
+    ClockOffset time.Duration
+
+    // MaxGap is the longest interval between the points on either side of a
+    // photo that will be interpolated across. Points in different segments
+    // are never interpolated between.
+    MaxGap time.Duration
+
+    // MaxTimeDifference is how far from the nearest point a photo can be
+    // when it can't be interpolated (e.g. before the first point of a file
+    // or within a longer gap). Zero disables this.
+    MaxTimeDifference time.Duration
+}
+
+// DefaultOptions assumes that the camera time is correct.
+func DefaultOptions() Options {
+    return Options{
+        MaxGap:            DefaultMaxGap,
+        MaxTimeDifference: DefaultMaxTimeDifference,
+    }
+}
+
+// CorrectedTime returns the actual time that the photo was taken.
+func (o Options) CorrectedTime(cameraTime time.Time) time.Time {
+    t := cameraTime
+
+    if o.Location != nil {
+        t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), o.Location)
+    }
+
+    return t.Add(o.ClockOffset)
+}
+
+// Match is the position found for a photo.
+type Match struct {
+    Photo Photo
+
+    // Time is the corrected time of the photo.
+    Time time.Time
+
+    // Point only has a position, an elevation (if the points used have one),
+    // and a time.
+    Point gpxcommon.TrackPoint
+
+    // Label is the file that the position came from.
+    Label string
+
+    // Interpolated is true if the position is between two points rather than
+    // at one point.
+    Interpolated bool
+
+    // Confidence is one for a point at exactly the same time and falls
+    // towards zero as the time to the nearest point approaches the limit.
+    // Interpolated positions are limited by half of MaxGap and are at least
+    // one-half. Positions taken from the nearest point are limited by
+    // MaxTimeDifference and are at most one-half.
+    Confidence float64
+}
+
+func (m Match) String() string {
+    return fmt.Sprintf("Match<ID=[%s] TIME=[%s] LAT=(%.8f) LON=(%.8f) LABEL=[%s] INTERPOLATED=[%v] CONFIDENCE=(%.3f)>", m.Photo.Id, m.Time, m.Point.LatitudeDecimal, m.Point.LongitudeDecimal, m.Label, m.Interpolated, m.Confidence)
+}
+
+// absDuration returns the magnitude of the duration.
+func absDuration(d time.Duration) time.Duration {
+    if d < 0 {
+        return -d
+    }
+
+    return d
+}
+
+// positionOf returns only the fields of the point that are kept in a match.
+func positionOf(tp *gpxcommon.TrackPoint) gpxcommon.TrackPoint {
+    return gpxcommon.TrackPoint{
+        LatitudeDecimal:  tp.LatitudeDecimal,
+        LongitudeDecimal: tp.LongitudeDecimal,
+        Elevation:        tp.Elevation,
+        Time:             tp.Time,
+    }
+}
+
+// locate finds the position at `t` from the points of one file, which are in
+// chronological order and are all within the tolerance of `t`. Positions are
+// not interpolated between points from different segments.
+func locate(found []gpxreader.GpxIndexMatch, t time.Time, options Options) (m Match, ok bool) {
+    // The first point at or after `t`.
+    i := sort.Search(len(found), func(i int) bool {
+        return found[i].Time.Before(t) == false
+    })
+
+    if i < len(found) && found[i].Time.Equal(t) == true {
+        m = Match{
+            Point:      positionOf(&found[i].Point),
+            Confidence: 1,
+        }
+
+        return m, true
+    }
+
+    var before, after *gpxcommon.TrackPoint
+
+    if i > 0 {
+        before = &found[i-1].Point
+    }
+
+    if i < len(found) {
+        after = &found[i].Point
+    }
+
+    sameSegment := i > 0 && i < len(found) && found[i-1].IsSameSegment(found[i]) == true
+
+    if sameSegment == true && after.Time.Sub(before.Time) <= options.MaxGap {
+        fraction := float64(t.Sub(before.Time)) / float64(after.Time.Sub(before.Time))
+
+        tp := gpxgeo.IntermediatePoint(before, after, fraction)
+        tp.Time = t
+
+        nearest := t.Sub(before.Time)
+        if after.Time.Sub(t) < nearest {
+            nearest = after.Time.Sub(t)
+        }
+
+        m = Match{
+            Point:        tp,
+            Interpolated: true,
+            Confidence:   1 - 0.5*float64(nearest)/float64(options.MaxGap/2),
+        }
+
+        return m, true
+    }
+
+    if options.MaxTimeDifference <= 0 {
+        return m, false
+    }
+
+    var nearest *gpxcommon.TrackPoint
+    if before != nil {
+        nearest = before
+    }
+
+    if after != nil && (nearest == nil || after.Time.Sub(t) < t.Sub(nearest.Time)) {
+        nearest = after
+    }
+
+    if nearest == nil {
+        return m, false
+    }
+
+    difference := absDuration(nearest.Time.Sub(t))
+    if difference > options.MaxTimeDifference {
+        return m, false
+    }
+
+    m = Match{
+        Point:      positionOf(nearest),
+        Confidence: 0.5 * (1 - float64(difference)/float64(options.MaxTimeDifference)),
+    }
+
+    return m, true
+}
+
+// Tag finds the position of every photo from the files in the index. If more
+// than one file has a position, the one with the highest confidence is used.
+// The index tolerance must be at least MaxGap and MaxTimeDifference. Photos
+// without a position are returned separately.
+func Tag(gi *gpxreader.GpxIndex, photos []Photo, options Options) (matches []Match, unmatched []Photo, err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    if gi.Tolerance() < options.MaxGap || gi.Tolerance() < options.MaxTimeDifference {
+        log.Panic(ErrToleranceTooSmall)
+    }
+
+    matches = make([]Match, 0)
+    unmatched = make([]Photo, 0)
+
+    for _, p := range photos {
+        t := options.CorrectedTime(p.Time)
+
+        found, err := gi.Search(t)
+        log.PanicIf(err)
+
+        // Group the points by file. They are already in chronological order.
+
+        labels := make([]string, 0)
+        byLabel := make(map[string][]gpxreader.GpxIndexMatch)
+
+        for _, gim := range found {
+            label := gim.FileInfo.Label
+
+            if _, exists := byLabel[label]; exists == false {
+                labels = append(labels, label)
+            }
+
+            byLabel[label] = append(byLabel[label], gim)
+        }
+
+        sort.Strings(labels)
+
+        var best *Match
+        for _, label := range labels {
+            m, ok := locate(byLabel[label], t, options)
+            if ok == false {
+                continue
+            }
+
+            if best == nil || m.Confidence > best.Confidence {
+                m.Label = label
+                best = &m
+            }
+        }
+
+        if best == nil {
+            unmatched = append(unmatched, p)
+            continue
+        }
+
+        best.Photo = p
+        best.Time = t
+
+        matches = append(matches, *best)
+    }
+
+    return matches, unmatched, nil
+}
@@ -0,0 +1,159 @@
+package gpxgeotag
+
+import (
+    "bytes"
+    "io"
+    "io/ioutil"
+    "math"
+    "testing"
+    "time"
+
+    "github.com/dsoprea/go-logging"
+
+    "github.com/dsoprea/go-gpx/reader"
+)
+
+var (
+    testGeotagGpxData = map[string]string{
+        // There is an eighteen minute gap before the last point.
+        "a": `<?xml version="1.0" encoding="UTF-8" ?><gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1"><trk><trkseg>
+<trkpt lat="10" lon="10"><time>2016-12-02T10:00:00Z</time></trkpt>
+<trkpt lat="10.01" lon="10"><time>2016-12-02T10:02:00Z</time></trkpt>
+<trkpt lat="10.02" lon="10"><time>2016-12-02T10:20:00Z</time></trkpt>
+</trkseg></trk></gpx>`,
+
+        "b": `<?xml version="1.0" encoding="UTF-8" ?><gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1"><trk><trkseg>
+<trkpt lat="20" lon="20"><time>2016-12-02T10:21:00Z</time></trkpt>
+</trkseg></trk></gpx>`,
+
+        // The recording was interrupted between the segments.
+        "segments": `<?xml version="1.0" encoding="UTF-8" ?><gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1"><trk><trkseg>
+<trkpt lat="30" lon="30"><time>2016-12-02T12:00:00Z</time></trkpt>
+</trkseg><trkseg>
+<trkpt lat="30.01" lon="30"><time>2016-12-02T12:02:00Z</time></trkpt>
+</trkseg></trk></gpx>`,
+    }
+)
+
+type testDataAccessor struct {
+}
+
+func (tda *testDataAccessor) Open(label string) (io.ReadCloser, error) {
+    return ioutil.NopCloser(bytes.NewBufferString(testGeotagGpxData[label])), nil
+}
+
+func getTestIndex(tolerance time.Duration) *gpxreader.GpxIndex {
+    gi := gpxreader.NewGpxIndex(new(testDataAccessor), tolerance, 0)
+
+    _, err := gi.Add("a")
+    log.PanicIf(err)
+
+    _, err = gi.Add("b")
+    log.PanicIf(err)
+
+    return gi
+}
+
+// cameraTime returns the wall-clock time as EXIF would have it (no zone).
+func cameraTime(hour, minute, second int) time.Time {
+    return time.Date(2016, 12, 2, hour, minute, second, 0, time.UTC)
+}
+
+func TestOptions_CorrectedTime(t *testing.T) {
+    options := DefaultOptions()
+    options.Location = time.FixedZone("camera", -5*60*60)
+    options.ClockOffset = 90 * time.Second
+
+    corrected := options.CorrectedTime(cameraTime(5, 0, 0))
+
+    if corrected.UTC().Format(time.RFC3339) != "2016-12-02T10:01:30Z" {
+        t.Fatalf("Corrected time not correct: [%s]", corrected)
+    }
+}
+
+func TestTag(t *testing.T) {
+    gi := getTestIndex(DefaultMaxGap)
+
+    options := DefaultOptions()
+    options.Location = time.FixedZone("camera", -5*60*60)
+
+    photos := []Photo{
+        {Id: "exact", Time: cameraTime(5, 0, 0)},
+        {Id: "interpolated", Time: cameraTime(5, 1, 0)},
+        {Id: "gap", Time: cameraTime(5, 10, 0)},
+        {Id: "between-files", Time: cameraTime(5, 20, 30)},
+        {Id: "near-second-file", Time: cameraTime(5, 20, 50)},
+    }
+
+    matches, unmatched, err := Tag(gi, photos, options)
+    log.PanicIf(err)
+
+    if len(unmatched) != 1 || unmatched[0].Id != "gap" {
+        t.Fatalf("Unmatched not correct: %v", unmatched)
+    } else if len(matches) != 4 {
+        t.Fatalf("Match count not correct: %v", matches)
+    }
+
+    exact := matches[0]
+    if exact.Photo.Id != "exact" || exact.Label != "a" || exact.Confidence != 1 || exact.Interpolated != false || exact.Point.LatitudeDecimal != 10 {
+        t.Fatalf("Exact match not correct: %s", exact)
+    } else if exact.Time.UTC().Format(time.RFC3339) != "2016-12-02T10:00:00Z" {
+        t.Fatalf("Exact time not correct: [%s]", exact.Time)
+    }
+
+    interpolated := matches[1]
+    if interpolated.Photo.Id != "interpolated" || interpolated.Interpolated != true {
+        t.Fatalf("Interpolated match not correct: %s", interpolated)
+    } else if math.Abs(interpolated.Point.LatitudeDecimal-10.005) > 1e-6 {
+        t.Fatalf("Interpolated position not correct: %s", &interpolated.Point)
+    } else if math.Abs(interpolated.Confidence-0.8) > 1e-9 {
+        t.Fatalf("Interpolated confidence not correct: (%f)", interpolated.Confidence)
+    }
+
+    // Equally near the end of the first file and the start of the second.
+    between := matches[2]
+    if between.Label != "a" || between.Interpolated != false || math.Abs(between.Confidence-0.25) > 1e-9 || between.Point.LatitudeDecimal != 10.02 {
+        t.Fatalf("Match between files not correct: %s", between)
+    }
+
+    near := matches[3]
+    if near.Label != "b" || near.Point.LatitudeDecimal != 20 || math.Abs(near.Confidence-0.5*(1-10.0/60)) > 1e-9 {
+        t.Fatalf("Match near second file not correct: %s", near)
+    }
+}
+
+func TestTag_SegmentBreak(t *testing.T) {
+    gi := gpxreader.NewGpxIndex(new(testDataAccessor), DefaultMaxGap, 0)
+
+    _, err := gi.Add("segments")
+    log.PanicIf(err)
+
+    photos := []Photo{
+        {Id: "break", Time: cameraTime(12, 0, 40)},
+    }
+
+    matches, _, err := Tag(gi, photos, DefaultOptions())
+    log.PanicIf(err)
+
+    if len(matches) != 1 {
+        t.Fatalf("Match count not correct: %v", matches)
+    }
+
+    // The points are within MaxGap but aren't interpolated between, so the
+    // nearest one is used.
+    m := matches[0]
+    if m.Interpolated != false || m.Point.LatitudeDecimal != 30 || math.Abs(m.Confidence-0.5*(1-40.0/60)) > 1e-9 {
+        t.Fatalf("Match across segment break not correct: %s", m)
+    }
+}
+
+func TestTag_ToleranceTooSmall(t *testing.T) {
+    gi := getTestIndex(time.Minute)
+
+    _, _, err := Tag(gi, []Photo{}, DefaultOptions())
+    if err == nil {
+        t.Fatalf("Expected error for small tolerance.")
+    } else if log.Is(err, ErrToleranceTooSmall) == false {
+        log.Panic(err)
+    }
+}
@@ -0,0 +1,349 @@
+package gpxpipe
+
+import (
+    "fmt"
+    "io"
+
+    "github.com/dsoprea/go-logging"
+
+    "github.com/dsoprea/go-gpx"
+    "github.com/dsoprea/go-gpx/reader"
+    "github.com/dsoprea/go-gpx/writer"
+)
+
+var (
+    ErrPointOutsideSegment   = fmt.Errorf("point emitted outside of a track-segment")
+    ErrSegmentOutsideTrack   = fmt.Errorf("track-segment emitted outside of a track")
+    ErrUnbalancedElementTree = fmt.Errorf("close emitted without a matching open")
+)
+
+type ElementType int
+
+const (
+    ElementTrackOpen ElementType = iota
+    ElementTrackClose
+    ElementSegmentOpen
+    ElementSegmentClose
+    ElementPoint
+    ElementMetadata
+    ElementWaypoint
+)
+
+func (et ElementType) String() string {
+    switch et {
+    case ElementTrackOpen:
+        return "TrackOpen"
+    case ElementTrackClose:
+        return "TrackClose"
+    case ElementSegmentOpen:
+        return "SegmentOpen"
+    case ElementSegmentClose:
+        return "SegmentClose"
+    case ElementPoint:
+        return "Point"
+    case ElementMetadata:
+        return "Metadata"
+    case ElementWaypoint:
+        return "Waypoint"
+    }
+
+    return fmt.Sprintf("ElementType<%d>", int(et))
+}
+
+// Element is one step in the document as it streams through the pipeline.
+// Only the field that corresponds to the type is set.
+type Element struct {
+    Type ElementType
+
+    Metadata *gpxcommon.Metadata
+    Track    *gpxcommon.Track
+    Segment  *gpxcommon.TrackSegment
+    Point    *gpxcommon.TrackPoint
+    Waypoint *gpxcommon.Waypoint
+}
+
+func (e Element) String() string {
+    switch e.Type {
+    case ElementTrackOpen, ElementTrackClose:
+        return fmt.Sprintf("Element<TYPE=[%s] %s>", e.Type, e.Track)
+    case ElementSegmentOpen, ElementSegmentClose:
+        return fmt.Sprintf("Element<TYPE=[%s] %s>", e.Type, e.Segment)
+    case ElementPoint:
+        return fmt.Sprintf("Element<TYPE=[%s] %s>", e.Type, e.Point)
+    case ElementMetadata:
+        return fmt.Sprintf("Element<TYPE=[%s] %s>", e.Type, e.Metadata)
+    case ElementWaypoint:
+        return fmt.Sprintf("Element<TYPE=[%s] %s>", e.Type, e.Waypoint)
+    }
+
+    return fmt.Sprintf("Element<TYPE=[%s]>", e.Type)
+}
+
+// Emit passes an element to the next stage.
+type Emit func(e Element) error
+
+// Stage receives every element that reaches it and calls `emit` for each
+// element (the same, changed, or new ones) that should continue down the
+// pipeline. Not calling `emit` drops the element.
+type Stage func(e Element, emit Emit) error
+
+// Pipeline passes the elements read from a GPX stream through a chain of
+// stages. Only the element currently being processed (and whatever the stages
+// themselves retain) is held in memory.
+type Pipeline struct {
+    stages []Stage
+}
+
+func NewPipeline(stages ...Stage) *Pipeline {
+    return &Pipeline{
+        stages: stages,
+    }
+}
+
+// chain returns an Emit that feeds the first stage and ends at `sink`.
+func (p *Pipeline) chain(sink Emit) Emit {
+    emit := sink
+
+    for i := len(p.stages) - 1; i >= 0; i-- {
+        stage := p.stages[i]
+        next := emit
+
+        emit = func(e Element) error {
+            return stage(e, next)
+        }
+    }
+
+    return emit
+}
+
+// Enumerate reads the GPX data and sends every element that makes it through
+// the stages to `sink`.
+func (p *Pipeline) Enumerate(r io.Reader, sink Emit) (err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    ev := &elementVisitor{
+        emit: p.chain(sink),
+    }
+
+    gp := gpxreader.NewGpxParser(r, ev)
+
+    err = gp.Parse()
+    log.PanicIf(err)
+
+    return nil
+}
+
+// Write reads the GPX data and writes every element that makes it through the
+// stages to the given builder. The document is closed when done.
+func (p *Pipeline) Write(r io.Reader, b *gpxwriter.Builder) (err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    gb, err := b.Gpx()
+    log.PanicIf(err)
+
+    bs := &builderSink{
+        gb: gb,
+    }
+
+    err = p.Enumerate(r, bs.emit)
+    log.PanicIf(err)
+
+    err = bs.gb.EndGpx()
+    log.PanicIf(err)
+
+    return nil
+}
+
+// elementVisitor converts the reader callbacks to elements. The metadata and
+// waypoints are emitted once they close. Tracks are emitted when their first segment opens
+// (or when they close) so that their name, description, and type are known.
+type elementVisitor struct {
+    emit Emit
+
+    pendingTrack *gpxcommon.Track
+}
+
+func (ev *elementVisitor) MetadataOpen(md *gpxcommon.Metadata) error {
+    return nil
+}
+
+func (ev *elementVisitor) MetadataClose(md *gpxcommon.Metadata) error {
+    return ev.emit(Element{Type: ElementMetadata, Metadata: md})
+}
+
+func (ev *elementVisitor) WaypointOpen(w *gpxcommon.Waypoint) error {
+    return nil
+}
+
+func (ev *elementVisitor) WaypointClose(w *gpxcommon.Waypoint) error {
+    copied := *w
+
+    return ev.emit(Element{Type: ElementWaypoint, Waypoint: &copied})
+}
+
+func (ev *elementVisitor) flushTrack() error {
+    if ev.pendingTrack == nil {
+        return nil
+    }
+
+    t := ev.pendingTrack
+    ev.pendingTrack = nil
+
+    return ev.emit(Element{Type: ElementTrackOpen, Track: t})
+}
+
+func (ev *elementVisitor) TrackOpen(t *gpxcommon.Track) error {
+    ev.pendingTrack = t
+
+    return nil
+}
+
+func (ev *elementVisitor) TrackClose(t *gpxcommon.Track) error {
+    if err := ev.flushTrack(); err != nil {
+        return err
+    }
+
+    return ev.emit(Element{Type: ElementTrackClose, Track: t})
+}
+
+func (ev *elementVisitor) TrackSegmentOpen(ts *gpxcommon.TrackSegment) error {
+    if err := ev.flushTrack(); err != nil {
+        return err
+    }
+
+    return ev.emit(Element{Type: ElementSegmentOpen, Segment: ts})
+}
+
+func (ev *elementVisitor) TrackSegmentClose(ts *gpxcommon.TrackSegment) error {
+    return ev.emit(Element{Type: ElementSegmentClose, Segment: ts})
+}
+
+func (ev *elementVisitor) TrackPointOpen(tp *gpxcommon.TrackPoint) error {
+    return nil
+}
+
+func (ev *elementVisitor) TrackPointClose(tp *gpxcommon.TrackPoint) error {
+    // Give the stages their own copy to modify.
+    copied := *tp
+
+    return ev.emit(Element{Type: ElementPoint, Point: &copied})
+}
+
+// builderSink writes elements to a builder.
+type builderSink struct {
+    gb   *gpxwriter.GpxBuilder
+    gtb  *gpxwriter.GpxTrackBuilder
+    gtsb *gpxwriter.GpxTrackSegmentBuilder
+}
+
+func (bs *builderSink) emit(e Element) (err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    switch e.Type {
+    case ElementMetadata:
+        gmb := bs.gb.Metadata()
+
+        gmb.Name = e.Metadata.Name
+        gmb.Description = e.Metadata.Description
+        gmb.AuthorName = e.Metadata.AuthorName
+        gmb.Time = e.Metadata.Time
+        gmb.Keywords = e.Metadata.Keywords
+
+        for _, link := range e.Metadata.Links {
+            gmb.Links = append(gmb.Links, gpxwriter.Link{Href: link.Href, Text: link.Text, Type: link.Type})
+        }
+
+        err = gmb.Write()
+        log.PanicIf(err)
+    case ElementWaypoint:
+        gwb := bs.gb.Waypoint()
+        gwb.SetWaypoint(e.Waypoint)
+
+        err = gwb.Write()
+        log.PanicIf(err)
+    case ElementTrackOpen:
+        bs.gtb, err = bs.gb.Track()
+        log.PanicIf(err)
+
+        if e.Track != nil {
+            err := bs.writeTrackInfo(e.Track)
+            log.PanicIf(err)
+        }
+    case ElementTrackClose:
+        if bs.gtb == nil {
+            log.Panic(ErrUnbalancedElementTree)
+        }
+
+        err = bs.gtb.EndTrack()
+        log.PanicIf(err)
+
+        bs.gtb = nil
+    case ElementSegmentOpen:
+        if bs.gtb == nil {
+            log.Panic(ErrSegmentOutsideTrack)
+        }
+
+        bs.gtsb, err = bs.gtb.TrackSegment()
+        log.PanicIf(err)
+    case ElementSegmentClose:
+        if bs.gtsb == nil {
+            log.Panic(ErrUnbalancedElementTree)
+        }
+
+        err = bs.gtsb.EndTrackSegment()
+        log.PanicIf(err)
+
+        bs.gtsb = nil
+    case ElementPoint:
+        if bs.gtsb == nil {
+            log.Panic(ErrPointOutsideSegment)
+        }
+
+        gtpb := bs.gtsb.TrackPoint()
+        gtpb.SetTrackPoint(e.Point)
+
+        err = gtpb.Write()
+        log.PanicIf(err)
+    }
+
+    return nil
+}
+
+// writeTrackInfo writes the name, description, and type of the track that was
+// just started.
+func (bs *builderSink) writeTrackInfo(t *gpxcommon.Track) (err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    if t.Name != "" {
+        err := bs.gtb.SetName(t.Name)
+        log.PanicIf(err)
+    }
+
+    if t.Description != "" {
+        err := bs.gtb.SetDescription(t.Description)
+        log.PanicIf(err)
+    }
+
+    if t.Type != "" {
+        err := bs.gtb.SetType(t.Type)
+        log.PanicIf(err)
+    }
+
+    return nil
+}
@@ -0,0 +1,180 @@
+package gpxpipe
+
+import (
+    "bytes"
+    "fmt"
+    "strings"
+    "testing"
+
+    "github.com/dsoprea/go-logging"
+
+    "github.com/dsoprea/go-gpx"
+    "github.com/dsoprea/go-gpx/reader"
+    "github.com/dsoprea/go-gpx/writer"
+)
+
+const (
+    testSmallGpxData = `<?xml version="1.0" encoding="UTF-8" ?><gpx version="1.0" creator="test"><trk><trkseg><trkpt lat="47.1" lon="-122.1"><ele>10</ele><time>2016-12-02T08:00:00Z</time><src>gps</src></trkpt>
+<trkpt lat="47.2" lon="-122.2"><time>2016-12-02T08:01:00Z</time><src>network</src></trkpt>
+<trkpt lat="47.3" lon="-122.3"><time>2016-12-02T09:00:00Z</time><src>gps</src></trkpt>
+</trkseg></trk></gpx>`
+)
+
+// collectElements returns the type of every element that reaches the end of
+// the pipeline.
+func collectElements(p *Pipeline, data string) (types []ElementType, points []gpxcommon.TrackPoint) {
+    types = make([]ElementType, 0)
+    points = make([]gpxcommon.TrackPoint, 0)
+
+    sink := func(e Element) error {
+        types = append(types, e.Type)
+
+        if e.Type == ElementPoint {
+            points = append(points, *e.Point)
+        }
+
+        return nil
+    }
+
+    b := bytes.NewBufferString(data)
+
+    err := p.Enumerate(b, sink)
+    log.PanicIf(err)
+
+    return types, points
+}
+
+func TestPipeline_Enumerate(t *testing.T) {
+    p := NewPipeline()
+
+    types, points := collectElements(p, gpxreader.TestGpxData)
+
+    if len(points) != 204 {
+        t.Fatalf("Point count not correct: (%d)", len(points))
+    } else if len(types) != 208 {
+        t.Fatalf("Element count not correct: (%d)", len(types))
+    }
+
+    expectedHead := []ElementType{ElementTrackOpen, ElementSegmentOpen, ElementPoint}
+    expectedTail := []ElementType{ElementPoint, ElementSegmentClose, ElementTrackClose}
+
+    if fmt.Sprintf("%v", types[:3]) != fmt.Sprintf("%v", expectedHead) {
+        t.Fatalf("Leading elements not correct: %v", types[:3])
+    } else if fmt.Sprintf("%v", types[len(types)-3:]) != fmt.Sprintf("%v", expectedTail) {
+        t.Fatalf("Trailing elements not correct: %v", types[len(types)-3:])
+    }
+}
+
+func TestPipeline_Write(t *testing.T) {
+    isGps := func(tp *gpxcommon.TrackPoint) (bool, error) {
+        return tp.Src == "gps", nil
+    }
+
+    p := NewPipeline(Filter(isGps))
+
+    buffer := new(bytes.Buffer)
+
+    options := gpxwriter.DefaultBuilderOptions()
+    options.Compact = true
+
+    b, err := gpxwriter.NewBuilderWithOptions(buffer, options)
+    log.PanicIf(err)
+
+    err = p.Write(bytes.NewBufferString(testSmallGpxData), b)
+    log.PanicIf(err)
+
+    expected := `<?xml version="1.0" encoding="UTF-8"?>
+<gpx xmlns="http://www.topografix.com/GPX/1/1" xmlns:gpxx="http://www.garmin.com/xmlschemas/GpxExtensions/v3" gpxtpx="http://www.garmin.com/xmlschemas/TrackPointExtension/v1" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:schemaLocation="http://www.topografix.com/GPX/1/1/gpx.xsd http://www.garmin.com/xmlschemas/GpxExtensions/v3 http://www.garmin.com/xmlschemas/GpxExtensionsv3.xsd http://www.garmin.com/xmlschemas/TrackPointExtension/v1 http://www.garmin.com/xmlschemas/TrackPointExtensionv1.xsd"><trk><trkseg><trkpt lat="47.1" lon="-122.1"><ele>10</ele><time>2016-12-02T08:00:00Z</time><src>gps</src></trkpt><trkpt lat="47.3" lon="-122.3"><time>2016-12-02T09:00:00Z</time><src>gps</src></trkpt></trkseg></trk></gpx>`
+
+    if buffer.String() != expected {
+        t.Fatalf("Output not expected:\n%s", buffer.String())
+    }
+}
+
+func TestPipeline_Write_PointOutsideSegment(t *testing.T) {
+    dropSegments := func(e Element, emit Emit) error {
+        if e.Type == ElementSegmentOpen || e.Type == ElementSegmentClose {
+            return nil
+        }
+
+        return emit(e)
+    }
+
+    p := NewPipeline(dropSegments)
+
+    b, err := gpxwriter.NewBuilder(new(bytes.Buffer))
+    log.PanicIf(err)
+
+    err = p.Write(bytes.NewBufferString(testSmallGpxData), b)
+    if err == nil {
+        t.Fatalf("Expected error.")
+    } else if log.Is(err, ErrPointOutsideSegment) == false {
+        log.Panic(err)
+    }
+}
+
+func TestPipeline_Write_MetadataAndTrackInfo(t *testing.T) {
+    data := `<?xml version="1.0" encoding="UTF-8" ?><gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1">
+<metadata><name>Trip</name><author><name>Someone</name></author><link href="http://example.com/trip"><text>Trip page</text></link><keywords>walk</keywords></metadata>
+<trk><name>Morning</name><type>walk</type><trkseg>
+<trkpt lat="47.1" lon="-122.1"><time>2016-12-02T08:00:00Z</time></trkpt>
+</trkseg></trk></gpx>`
+
+    p := NewPipeline()
+
+    buffer := new(bytes.Buffer)
+
+    options := gpxwriter.DefaultBuilderOptions()
+    options.Compact = true
+
+    b, err := gpxwriter.NewBuilderWithOptions(buffer, options)
+    log.PanicIf(err)
+
+    err = p.Write(bytes.NewBufferString(data), b)
+    log.PanicIf(err)
+
+    expectedMetadata := `<metadata><name>Trip</name><author><name>Someone</name></author><link href="http://example.com/trip"><text>Trip page</text></link><keywords>walk</keywords></metadata>`
+    expectedTrack := `<trk><name>Morning</name><type>walk</type><trkseg>`
+
+    if strings.Contains(buffer.String(), expectedMetadata) == false {
+        t.Fatalf("Metadata not written:\n%s", buffer.String())
+    } else if strings.Contains(buffer.String(), expectedTrack) == false {
+        t.Fatalf("Track info not written:\n%s", buffer.String())
+    }
+}
+
+func TestPipeline_Write_Waypoints(t *testing.T) {
+    data := `<?xml version="1.0" encoding="UTF-8" ?><gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1">
+<metadata><name>Trip</name></metadata>
+<wpt lat="47.2" lon="-122.2"><ele>50</ele><name>Cafe</name><sym>Restaurant</sym></wpt>
+<wpt lat="47.3" lon="-122.3"><name>Park</name></wpt>
+<trk><trkseg>
+<trkpt lat="47.1" lon="-122.1"><time>2016-12-02T08:00:00Z</time></trkpt>
+</trkseg></trk></gpx>`
+
+    p := NewPipeline()
+
+    types, _ := collectElements(p, data)
+
+    expected := []ElementType{ElementMetadata, ElementWaypoint, ElementWaypoint, ElementTrackOpen}
+    if fmt.Sprintf("%v", types[:4]) != fmt.Sprintf("%v", expected) {
+        t.Fatalf("Leading elements not correct: %v", types)
+    }
+
+    buffer := new(bytes.Buffer)
+
+    options := gpxwriter.DefaultBuilderOptions()
+    options.Compact = true
+
+    b, err := gpxwriter.NewBuilderWithOptions(buffer, options)
+    log.PanicIf(err)
+
+    err = p.Write(bytes.NewBufferString(data), b)
+    log.PanicIf(err)
+
+    expectedWaypoints := `</metadata><wpt lat="47.2" lon="-122.2"><ele>50</ele><name>Cafe</name><sym>Restaurant</sym></wpt><wpt lat="47.3" lon="-122.3"><name>Park</name></wpt><trk>`
+
+    if strings.Contains(buffer.String(), expectedWaypoints) == false {
+        t.Fatalf("Waypoints not written:\n%s", buffer.String())
+    }
+}
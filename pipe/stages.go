@@ -0,0 +1,253 @@
+package gpxpipe
+
+import (
+    "github.com/dsoprea/go-logging"
+
+    "github.com/dsoprea/go-gpx"
+)
+
+// PointMapper modifies a point in place.
+type PointMapper func(tp *gpxcommon.TrackPoint) error
+
+// PointPredicate decides something about a single point.
+type PointPredicate func(tp *gpxcommon.TrackPoint) (bool, error)
+
+// PairPredicate decides something about a point given the point before it in
+// the same segment. `previous` is nil for the first point of a segment.
+type PairPredicate func(previous, current *gpxcommon.TrackPoint) (bool, error)
+
+// PointInserter returns points to insert before `current`. `previous` is nil
+// for the first point of a segment.
+type PointInserter func(previous, current *gpxcommon.TrackPoint) ([]gpxcommon.TrackPoint, error)
+
+// SegmentTransform replaces all of the points of a segment at once.
+type SegmentTransform func(points []gpxcommon.TrackPoint) ([]gpxcommon.TrackPoint, error)
+
+// Map returns a stage that applies `pm` to every point.
+func Map(pm PointMapper) Stage {
+    return func(e Element, emit Emit) (err error) {
+        defer func() {
+            if state := recover(); state != nil {
+                err = log.Wrap(state.(error))
+            }
+        }()
+
+        if e.Type == ElementPoint {
+            err := pm(e.Point)
+            log.PanicIf(err)
+        }
+
+        err = emit(e)
+        log.PanicIf(err)
+
+        return nil
+    }
+}
+
+// Filter returns a stage that only passes the points for which `pp` returns
+// true. Tracks and segments are always passed, even if they end up empty.
+func Filter(pp PointPredicate) Stage {
+    return func(e Element, emit Emit) (err error) {
+        defer func() {
+            if state := recover(); state != nil {
+                err = log.Wrap(state.(error))
+            }
+        }()
+
+        if e.Type == ElementPoint {
+            keep, err := pp(e.Point)
+            log.PanicIf(err)
+
+            if keep == false {
+                return nil
+            }
+        }
+
+        err = emit(e)
+        log.PanicIf(err)
+
+        return nil
+    }
+}
+
+// Insert returns a stage that emits the points returned by `pi` ahead of each
+// point. The comparison is always against the previous point that was
+// received, not the ones that were inserted.
+func Insert(pi PointInserter) Stage {
+    var previous *gpxcommon.TrackPoint
+
+    return func(e Element, emit Emit) (err error) {
+        defer func() {
+            if state := recover(); state != nil {
+                err = log.Wrap(state.(error))
+            }
+        }()
+
+        switch e.Type {
+        case ElementSegmentOpen:
+            previous = nil
+        case ElementPoint:
+            inserted, err := pi(previous, e.Point)
+            log.PanicIf(err)
+
+            for i := range inserted {
+                err := emit(Element{Type: ElementPoint, Point: &inserted[i]})
+                log.PanicIf(err)
+            }
+
+            // Keep our own copy in case a later stage modifies it.
+            copied := *e.Point
+            previous = &copied
+        }
+
+        err = emit(e)
+        log.PanicIf(err)
+
+        return nil
+    }
+}
+
+// SplitSegment returns a stage that closes the current segment and opens a
+// new one before any point for which `pp` returns true.
+func SplitSegment(pp PairPredicate) Stage {
+    var previous *gpxcommon.TrackPoint
+
+    return func(e Element, emit Emit) (err error) {
+        defer func() {
+            if state := recover(); state != nil {
+                err = log.Wrap(state.(error))
+            }
+        }()
+
+        switch e.Type {
+        case ElementSegmentOpen:
+            previous = nil
+        case ElementPoint:
+            if previous != nil {
+                split, err := pp(previous, e.Point)
+                log.PanicIf(err)
+
+                if split == true {
+                    err := emit(Element{Type: ElementSegmentClose, Segment: new(gpxcommon.TrackSegment)})
+                    log.PanicIf(err)
+
+                    err = emit(Element{Type: ElementSegmentOpen, Segment: new(gpxcommon.TrackSegment)})
+                    log.PanicIf(err)
+                }
+            }
+
+            copied := *e.Point
+            previous = &copied
+        }
+
+        err = emit(e)
+        log.PanicIf(err)
+
+        return nil
+    }
+}
+
+// Segment returns a stage that collects the points of each segment and emits
+// the points returned by `st` when the segment closes. This is for
+// transformations that need to see the whole segment. Only one segment is
+// held in memory at a time.
+func Segment(st SegmentTransform) Stage {
+    points := make([]gpxcommon.TrackPoint, 0)
+
+    return func(e Element, emit Emit) (err error) {
+        defer func() {
+            if state := recover(); state != nil {
+                err = log.Wrap(state.(error))
+            }
+        }()
+
+        switch e.Type {
+        case ElementSegmentOpen:
+            points = points[:0]
+        case ElementPoint:
+            points = append(points, *e.Point)
+            return nil
+        case ElementSegmentClose:
+            transformed, err := st(points)
+            log.PanicIf(err)
+
+            for i := range transformed {
+                err := emit(Element{Type: ElementPoint, Point: &transformed[i]})
+                log.PanicIf(err)
+            }
+        }
+
+        err = emit(e)
+        log.PanicIf(err)
+
+        return nil
+    }
+}
+
+// DropEmpty returns a stage that drops segments without points and tracks
+// without segments. The opening elements are held until the first point.
+func DropEmpty() Stage {
+    var pendingTrack, pendingSegment *Element
+    trackOpened := false
+    segmentOpened := false
+
+    return func(e Element, emit Emit) (err error) {
+        defer func() {
+            if state := recover(); state != nil {
+                err = log.Wrap(state.(error))
+            }
+        }()
+
+        switch e.Type {
+        case ElementTrackOpen:
+            copied := e
+            pendingTrack = &copied
+            trackOpened = false
+
+            return nil
+        case ElementSegmentOpen:
+            copied := e
+            pendingSegment = &copied
+            segmentOpened = false
+
+            return nil
+        case ElementPoint:
+            if pendingTrack != nil {
+                err := emit(*pendingTrack)
+                log.PanicIf(err)
+
+                pendingTrack = nil
+                trackOpened = true
+            }
+
+            if pendingSegment != nil {
+                err := emit(*pendingSegment)
+                log.PanicIf(err)
+
+                pendingSegment = nil
+                segmentOpened = true
+            }
+        case ElementSegmentClose:
+            pendingSegment = nil
+
+            if segmentOpened == false {
+                return nil
+            }
+
+            segmentOpened = false
+        case ElementTrackClose:
+            pendingTrack = nil
+
+            if trackOpened == false {
+                return nil
+            }
+
+            trackOpened = false
+        }
+
+        err = emit(e)
+        log.PanicIf(err)
+
+        return nil
+    }
+}
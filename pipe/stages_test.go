@@ -0,0 +1,176 @@
+package gpxpipe
+
+import (
+    "fmt"
+    "testing"
+    "time"
+
+    "github.com/dsoprea/go-gpx"
+)
+
+func TestMap(t *testing.T) {
+    clearSrc := func(tp *gpxcommon.TrackPoint) error {
+        tp.Src = ""
+        return nil
+    }
+
+    p := NewPipeline(Map(clearSrc))
+
+    _, points := collectElements(p, testSmallGpxData)
+
+    if len(points) != 3 {
+        t.Fatalf("Point count not correct: (%d)", len(points))
+    }
+
+    for _, tp := range points {
+        if tp.Src != "" {
+            t.Fatalf("Point not mapped: %s", &tp)
+        }
+    }
+}
+
+func TestFilter(t *testing.T) {
+    isNetwork := func(tp *gpxcommon.TrackPoint) (bool, error) {
+        return tp.Src == "network", nil
+    }
+
+    p := NewPipeline(Filter(isNetwork))
+
+    types, points := collectElements(p, testSmallGpxData)
+
+    if len(points) != 1 {
+        t.Fatalf("Point count not correct: (%d)", len(points))
+    } else if points[0].LatitudeDecimal != 47.2 {
+        t.Fatalf("Wrong point kept: %s", &points[0])
+    } else if len(types) != 5 {
+        t.Fatalf("Structure not preserved: %v", types)
+    }
+}
+
+func TestInsert(t *testing.T) {
+    midpoint := func(previous, current *gpxcommon.TrackPoint) ([]gpxcommon.TrackPoint, error) {
+        if previous == nil {
+            return nil, nil
+        }
+
+        tp := gpxcommon.TrackPoint{
+            LatitudeDecimal:  (previous.LatitudeDecimal + current.LatitudeDecimal) / 2,
+            LongitudeDecimal: (previous.LongitudeDecimal + current.LongitudeDecimal) / 2,
+            Time:             previous.Time.Add(current.Time.Sub(previous.Time) / 2),
+        }
+
+        return []gpxcommon.TrackPoint{tp}, nil
+    }
+
+    p := NewPipeline(Insert(midpoint))
+
+    _, points := collectElements(p, testSmallGpxData)
+
+    if len(points) != 5 {
+        t.Fatalf("Point count not correct: (%d)", len(points))
+    }
+
+    actual := make([]string, len(points))
+    for i, tp := range points {
+        actual[i] = tp.Time.Format(time.RFC3339)
+    }
+
+    expected := "[2016-12-02T08:00:00Z 2016-12-02T08:00:30Z 2016-12-02T08:01:00Z 2016-12-02T08:30:30Z 2016-12-02T09:00:00Z]"
+
+    if fmt.Sprintf("%v", actual) != expected {
+        t.Fatalf("Points not correct: %v", actual)
+    }
+}
+
+func TestSplitSegment(t *testing.T) {
+    isGap := func(previous, current *gpxcommon.TrackPoint) (bool, error) {
+        return current.Time.Sub(previous.Time) > 10*time.Minute, nil
+    }
+
+    p := NewPipeline(SplitSegment(isGap))
+
+    types, points := collectElements(p, testSmallGpxData)
+
+    if len(points) != 3 {
+        t.Fatalf("Point count not correct: (%d)", len(points))
+    }
+
+    expected := []ElementType{
+        ElementTrackOpen,
+        ElementSegmentOpen,
+        ElementPoint,
+        ElementPoint,
+        ElementSegmentClose,
+        ElementSegmentOpen,
+        ElementPoint,
+        ElementSegmentClose,
+        ElementTrackClose,
+    }
+
+    if fmt.Sprintf("%v", types) != fmt.Sprintf("%v", expected) {
+        t.Fatalf("Elements not correct: %v", types)
+    }
+}
+
+func TestSegment(t *testing.T) {
+    reverse := func(points []gpxcommon.TrackPoint) ([]gpxcommon.TrackPoint, error) {
+        reversed := make([]gpxcommon.TrackPoint, len(points))
+        for i, tp := range points {
+            reversed[len(points)-1-i] = tp
+        }
+
+        return reversed, nil
+    }
+
+    p := NewPipeline(Segment(reverse))
+
+    types, points := collectElements(p, testSmallGpxData)
+
+    if len(points) != 3 {
+        t.Fatalf("Point count not correct: (%d)", len(points))
+    } else if points[0].LatitudeDecimal != 47.3 || points[2].LatitudeDecimal != 47.1 {
+        t.Fatalf("Points not transformed: %v", points)
+    }
+
+    expected := []ElementType{
+        ElementTrackOpen,
+        ElementSegmentOpen,
+        ElementPoint,
+        ElementPoint,
+        ElementPoint,
+        ElementSegmentClose,
+        ElementTrackClose,
+    }
+
+    if fmt.Sprintf("%v", types) != fmt.Sprintf("%v", expected) {
+        t.Fatalf("Elements not correct: %v", types)
+    }
+}
+
+func TestDropEmpty(t *testing.T) {
+    data := `<?xml version="1.0" encoding="UTF-8" ?><gpx version="1.0" creator="test">
+<trk><trkseg></trkseg></trk>
+<trk><trkseg><trkpt lat="47.1" lon="-122.1"></trkpt></trkseg><trkseg></trkseg></trk>
+<trk></trk>
+</gpx>`
+
+    p := NewPipeline(DropEmpty())
+
+    types, points := collectElements(p, data)
+
+    if len(points) != 1 {
+        t.Fatalf("Point count not correct: (%d)", len(points))
+    }
+
+    expected := []ElementType{
+        ElementTrackOpen,
+        ElementSegmentOpen,
+        ElementPoint,
+        ElementSegmentClose,
+        ElementTrackClose,
+    }
+
+    if fmt.Sprintf("%v", types) != fmt.Sprintf("%v", expected) {
+        t.Fatalf("Elements not correct: %v", types)
+    }
+}
@@ -3,6 +3,7 @@ package gpxreader
 import (
     "bytes"
     "testing"
+    "time"
 
     "github.com/dsoprea/go-gpx"
     "github.com/dsoprea/go-logging"
@@ -112,3 +113,87 @@ func TestFullGpxRead(t *testing.T) {
         t.Fatalf("Points not correct size: (%d)", gpc.TrackPointVisits)
     }
 }
+
+const (
+    testMetadataGpxData = `<?xml version="1.0" encoding="UTF-8" ?><gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1">
+<metadata>
+<name>Trip</name><desc>Around town</desc>
+<author><name>Someone</name><link href="http://example.com/author"><text>Author</text></link></author>
+<link href="http://example.com/trip"><text>Trip page</text><type>text/html</type></link>
+<time>2016-12-02T08:00:00Z</time><keywords>walk</keywords>
+</metadata>
+<wpt lat="47.2" lon="-122.2"><ele>12</ele><time>2016-12-02T08:30:00Z</time><name>Cafe</name><cmt>Open late</cmt><desc>Coffee</desc><link href="http://example.com/cafe"></link><sym>Restaurant</sym><type>food</type></wpt>
+<trk><name>Morning</name><desc>To work</desc><type>walk</type><trkseg>
+<trkpt lat="47.1" lon="-122.1"><name>Ignored</name><time>2016-12-02T08:00:00Z</time></trkpt>
+</trkseg></trk></gpx>`
+)
+
+type metadataCollector struct {
+    metadata  *gpxcommon.Metadata
+    waypoints []gpxcommon.Waypoint
+    tracks    []gpxcommon.Track
+}
+
+func (mc *metadataCollector) MetadataOpen(md *gpxcommon.Metadata) error {
+    return nil
+}
+
+func (mc *metadataCollector) MetadataClose(md *gpxcommon.Metadata) error {
+    mc.metadata = md
+    return nil
+}
+
+func (mc *metadataCollector) WaypointOpen(w *gpxcommon.Waypoint) error {
+    return nil
+}
+
+func (mc *metadataCollector) WaypointClose(w *gpxcommon.Waypoint) error {
+    mc.waypoints = append(mc.waypoints, *w)
+    return nil
+}
+
+func (mc *metadataCollector) TrackOpen(track *gpxcommon.Track) error {
+    return nil
+}
+
+func (mc *metadataCollector) TrackClose(track *gpxcommon.Track) error {
+    mc.tracks = append(mc.tracks, *track)
+    return nil
+}
+
+func TestMetadataWaypointAndTrackRead(t *testing.T) {
+    mc := new(metadataCollector)
+    gp := NewGpxParser(bytes.NewBufferString(testMetadataGpxData), mc)
+
+    if err := gp.Parse(); err != nil {
+        log.Panic(err)
+    }
+
+    md := mc.metadata
+    if md == nil {
+        t.Fatalf("No metadata.")
+    } else if md.Name != "Trip" || md.Description != "Around town" || md.AuthorName != "Someone" || md.Keywords != "walk" {
+        t.Fatalf("Metadata not correct: %s", md)
+    } else if md.Time.Format(time.RFC3339) != "2016-12-02T08:00:00Z" {
+        t.Fatalf("Metadata time not correct: [%s]", md.Time)
+    } else if len(md.Links) != 1 || md.Links[0] != (gpxcommon.Link{Href: "http://example.com/trip", Text: "Trip page", Type: "text/html"}) {
+        t.Fatalf("Metadata links not correct: %v", md.Links)
+    }
+
+    if len(mc.waypoints) != 1 {
+        t.Fatalf("Waypoint count not correct: (%d)", len(mc.waypoints))
+    }
+
+    w := mc.waypoints[0]
+    if w.LatitudeDecimal != 47.2 || w.LongitudeDecimal != -122.2 || w.Elevation != 12 || w.Time.Format(time.RFC3339) != "2016-12-02T08:30:00Z" {
+        t.Fatalf("Waypoint position not correct: %s", &w)
+    } else if w.Name != "Cafe" || w.Comment != "Open late" || w.Description != "Coffee" || w.Symbol != "Restaurant" || w.Type != "food" {
+        t.Fatalf("Waypoint fields not correct: %v", w)
+    }
+
+    if len(mc.tracks) != 1 {
+        t.Fatalf("Track count not correct: (%d)", len(mc.tracks))
+    } else if mc.tracks[0] != (gpxcommon.Track{Name: "Morning", Description: "To work", Type: "walk"}) {
+        t.Fatalf("Track not correct: %s", &mc.tracks[0])
+    }
+}
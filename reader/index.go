@@ -0,0 +1,417 @@
+package gpxreader
+
+import (
+    "container/list"
+    "fmt"
+    "io"
+    "os"
+    "sort"
+    "time"
+
+    "github.com/dsoprea/go-gpx"
+    "github.com/dsoprea/go-logging"
+)
+
+var (
+    ErrAlreadyIndexed = fmt.Errorf("file already indexed")
+)
+
+// TimeInterval is the first and last time represented by a file.
+type TimeInterval [2]time.Time
+
+func (ti TimeInterval) String() string {
+    return fmt.Sprintf("TimeInterval<FROM=[%s] TO=[%s]>", ti[0], ti[1])
+}
+
+// Overlaps returns true if the intervals have any time in common.
+func (ti TimeInterval) Overlaps(other TimeInterval) bool {
+    return ti[0].After(other[1]) == false && ti[1].Before(other[0]) == false
+}
+
+// GpxDataAccessor provides the GPX data for the labels given to the index
+// (e.g. file-paths).
+type GpxDataAccessor interface {
+    Open(label string) (io.ReadCloser, error)
+}
+
+// GpxPointAccessor can also be implemented by a GpxDataAccessor that already
+// has the points of the files (e.g. from a catalog). The index then uses them
+// instead of reading the data.
+type GpxPointAccessor interface {
+    // Points returns every point of the file, in the order of the file, or
+    // false if the points have to be read from the data. The points are not
+    // modified.
+    Points(label string) (points []GpxIndexPoint, found bool)
+}
+
+// GpxFileDataAccessor treats labels as file-paths.
+type GpxFileDataAccessor struct {
+}
+
+func (gfda *GpxFileDataAccessor) Open(label string) (io.ReadCloser, error) {
+    return os.Open(label)
+}
+
+// GpxFileInfo describes an indexed file.
+type GpxFileInfo struct {
+    Label    string
+    Interval TimeInterval
+    Count    int
+}
+
+func (gfi *GpxFileInfo) String() string {
+    return fmt.Sprintf("GpxFileInfo<LABEL=[%s] FROM=[%s] TO=[%s] COUNT=(%d)>", gfi.Label, gfi.Interval[0], gfi.Interval[1], gfi.Count)
+}
+
+// GpxIndexPoint is a point along with the track and segment (counted from
+// zero within the file) that it was found in.
+type GpxIndexPoint struct {
+    TrackIndex   int
+    SegmentIndex int
+    Point        gpxcommon.TrackPoint
+}
+
+// GpxIndexMatch is a point that was found within the tolerance of the time
+// that was searched for. Consecutive matches from different segments (or
+// tracks) have a break in the recording between them.
+type GpxIndexMatch struct {
+    Time         time.Time
+    Point        gpxcommon.TrackPoint
+    FileInfo     *GpxFileInfo
+    TrackIndex   int
+    SegmentIndex int
+}
+
+func (gim GpxIndexMatch) String() string {
+    return fmt.Sprintf("GpxIndexMatch<TIME=[%s] LAT=(%.8f) LON=(%.8f) LABEL=[%s] TRACK=(%d) SEGMENT=(%d)>", gim.Time, gim.Point.LatitudeDecimal, gim.Point.LongitudeDecimal, gim.FileInfo.Label, gim.TrackIndex, gim.SegmentIndex)
+}
+
+// IsSameSegment returns true if both matches are from the same segment of the
+// same file.
+func (gim GpxIndexMatch) IsSameSegment(other GpxIndexMatch) bool {
+    return gim.FileInfo == other.FileInfo && gim.TrackIndex == other.TrackIndex && gim.SegmentIndex == other.SegmentIndex
+}
+
+// loadedFile has the timestamped points of a file in chronological order.
+type loadedFile struct {
+    info   *GpxFileInfo
+    points []GpxIndexPoint
+}
+
+// indexVisitor collects the timestamped points of a file along with the track
+// and segment that they were found in.
+type indexVisitor struct {
+    *SimpleGpxTrackVisitor
+
+    points       []GpxIndexPoint
+    trackIndex   int
+    segmentIndex int
+}
+
+func newIndexVisitor(count int) *indexVisitor {
+    iv := &indexVisitor{
+        points:       make([]GpxIndexPoint, 0, count),
+        trackIndex:   -1,
+        segmentIndex: -1,
+    }
+
+    iv.SimpleGpxTrackVisitor = NewSimpleGpxTrackVisitor(iv.addPoint)
+
+    return iv
+}
+
+func (iv *indexVisitor) TrackOpen(track *gpxcommon.Track) error {
+    iv.trackIndex++
+    iv.segmentIndex = -1
+
+    return nil
+}
+
+func (iv *indexVisitor) TrackClose(track *gpxcommon.Track) error {
+    return nil
+}
+
+func (iv *indexVisitor) TrackSegmentOpen(trackSegment *gpxcommon.TrackSegment) error {
+    iv.segmentIndex++
+
+    return nil
+}
+
+func (iv *indexVisitor) TrackSegmentClose(trackSegment *gpxcommon.TrackSegment) error {
+    return nil
+}
+
+func (iv *indexVisitor) addPoint(tp *gpxcommon.TrackPoint) error {
+    if tp.Time.IsZero() == false {
+        gip := GpxIndexPoint{
+            TrackIndex:   iv.trackIndex,
+            SegmentIndex: iv.segmentIndex,
+            Point:        *tp,
+        }
+
+        iv.points = append(iv.points, gip)
+    }
+
+    return nil
+}
+
+// GpxIndex searches for timestamps over a set of GPX files. Only the
+// intervals are kept for every file. The points are loaded when a search
+// needs them and, if `maxFilesLoaded` is not zero, the least-recently used
+// files are unloaded to stay within that limit.
+type GpxIndex struct {
+    accessor       GpxDataAccessor
+    tolerance      time.Duration
+    maxFilesLoaded int
+
+    // files is ordered by the start of the interval once `sorted` is true.
+    // Files are appended as they are added and sorted before they are next
+    // used.
+    files  []*GpxFileInfo
+    sorted bool
+    labels map[string]struct{}
+
+    // loaded has the most-recently used file at the front.
+    loaded  *list.List
+    byLabel map[string]*list.Element
+}
+
+func NewGpxIndex(accessor GpxDataAccessor, tolerance time.Duration, maxFilesLoaded int) *GpxIndex {
+    return &GpxIndex{
+        accessor:       accessor,
+        tolerance:      tolerance,
+        maxFilesLoaded: maxFilesLoaded,
+        files:          make([]*GpxFileInfo, 0),
+        sorted:         true,
+        labels:         make(map[string]struct{}),
+        loaded:         list.New(),
+        byLabel:        make(map[string]*list.Element),
+    }
+}
+
+// Files returns the indexed files, ordered by the start of their intervals.
+func (gi *GpxIndex) Files() []*GpxFileInfo {
+    gi.sort()
+    return gi.files
+}
+
+// Tolerance returns how far from the searched time a match can be.
+func (gi *GpxIndex) Tolerance() time.Duration {
+    return gi.tolerance
+}
+
+// LoadedCount returns the number of files whose points are in memory.
+func (gi *GpxIndex) LoadedCount() int {
+    return gi.loaded.Len()
+}
+
+// Add reads the file to determine the range of time that it represents. The
+// points are not retained.
+func (gi *GpxIndex) Add(label string) (ti TimeInterval, err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    if gi.has(label) == true {
+        log.Panic(ErrAlreadyIndexed)
+    }
+
+    rc, err := gi.accessor.Open(label)
+    log.PanicIf(err)
+
+    defer rc.Close()
+
+    gs, err := Summary(rc)
+    log.PanicIf(err)
+
+    gfi := GpxFileInfo{
+        Label:    label,
+        Interval: TimeInterval{gs.Start, gs.Stop},
+        Count:    gs.Count,
+    }
+
+    err = gi.AddFileInfo(gfi)
+    log.PanicIf(err)
+
+    return gfi.Interval, nil
+}
+
+func (gi *GpxIndex) has(label string) bool {
+    _, found := gi.labels[label]
+    return found
+}
+
+// sort orders the files by the start of their intervals. Files with the same
+// start stay in the order that they were added.
+func (gi *GpxIndex) sort() {
+    if gi.sorted == true {
+        return
+    }
+
+    sort.SliceStable(gi.files, func(i, j int) bool {
+        return gi.files[i].Interval[0].Before(gi.files[j].Interval[0])
+    })
+
+    gi.sorted = true
+}
+
+// AddFileInfo adds a file whose interval is already known (e.g. from a saved
+// catalog) without reading it. `Count` is the number of points with times.
+func (gi *GpxIndex) AddFileInfo(gfi GpxFileInfo) (err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    if gi.has(gfi.Label) == true {
+        log.Panic(ErrAlreadyIndexed)
+    }
+
+    if n := len(gi.files); n > 0 && gi.files[n-1].Interval[0].After(gfi.Interval[0]) == true {
+        gi.sorted = false
+    }
+
+    gi.files = append(gi.files, &gfi)
+    gi.labels[gfi.Label] = struct{}{}
+
+    return nil
+}
+
+// readPoints returns the timestamped points of the file in the order of the
+// file, from the accessor if it has them or otherwise from the data.
+func (gi *GpxIndex) readPoints(gfi *GpxFileInfo) (points []GpxIndexPoint, err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    if gpa, ok := gi.accessor.(GpxPointAccessor); ok == true {
+        if all, found := gpa.Points(gfi.Label); found == true {
+            points = make([]GpxIndexPoint, 0, gfi.Count)
+            for _, gip := range all {
+                if gip.Point.Time.IsZero() == false {
+                    points = append(points, gip)
+                }
+            }
+
+            return points, nil
+        }
+    }
+
+    rc, err := gi.accessor.Open(gfi.Label)
+    log.PanicIf(err)
+
+    defer rc.Close()
+
+    iv := newIndexVisitor(gfi.Count)
+
+    gp := NewGpxParser(rc, iv)
+
+    err = gp.Parse()
+    log.PanicIf(err)
+
+    return iv.points, nil
+}
+
+// load returns the points for the file, reading them if they are not already
+// loaded.
+func (gi *GpxIndex) load(gfi *GpxFileInfo) (lf *loadedFile, err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    if e, found := gi.byLabel[gfi.Label]; found == true {
+        gi.loaded.MoveToFront(e)
+        return e.Value.(*loadedFile), nil
+    }
+
+    points, err := gi.readPoints(gfi)
+    log.PanicIf(err)
+
+    sort.SliceStable(points, func(i, j int) bool {
+        return points[i].Point.Time.Before(points[j].Point.Time)
+    })
+
+    lf = &loadedFile{
+        info:   gfi,
+        points: points,
+    }
+
+    gi.byLabel[gfi.Label] = gi.loaded.PushFront(lf)
+
+    if gi.maxFilesLoaded > 0 {
+        for gi.loaded.Len() > gi.maxFilesLoaded {
+            e := gi.loaded.Back()
+            gi.loaded.Remove(e)
+
+            delete(gi.byLabel, e.Value.(*loadedFile).info.Label)
+        }
+    }
+
+    return lf, nil
+}
+
+// Search returns every point within the tolerance of `t`, sorted first by
+// time and then by label.
+func (gi *GpxIndex) Search(t time.Time) (matches []GpxIndexMatch, err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    window := TimeInterval{t.Add(-gi.tolerance), t.Add(gi.tolerance)}
+
+    gi.sort()
+
+    matches = make([]GpxIndexMatch, 0)
+
+    for _, gfi := range gi.files {
+        // The files are ordered by their start so none of the rest can match.
+        if gfi.Interval[0].After(window[1]) == true {
+            break
+        }
+
+        if gfi.Count == 0 || gfi.Interval.Overlaps(window) == false {
+            continue
+        }
+
+        lf, err := gi.load(gfi)
+        log.PanicIf(err)
+
+        // The first point that isn't too early.
+        i := sort.Search(len(lf.points), func(i int) bool {
+            return lf.points[i].Point.Time.Before(window[0]) == false
+        })
+
+        for ; i < len(lf.points) && lf.points[i].Point.Time.After(window[1]) == false; i++ {
+            gip := lf.points[i]
+
+            match := GpxIndexMatch{
+                Time:         gip.Point.Time,
+                Point:        gip.Point,
+                FileInfo:     gfi,
+                TrackIndex:   gip.TrackIndex,
+                SegmentIndex: gip.SegmentIndex,
+            }
+
+            matches = append(matches, match)
+        }
+    }
+
+    sort.SliceStable(matches, func(i, j int) bool {
+        if matches[i].Time.Equal(matches[j].Time) == false {
+            return matches[i].Time.Before(matches[j].Time)
+        }
+
+        return matches[i].FileInfo.Label < matches[j].FileInfo.Label
+    })
+
+    return matches, nil
+}
@@ -0,0 +1,252 @@
+package gpxreader
+
+import (
+    "bytes"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "os"
+    "path"
+    "testing"
+    "time"
+
+    "github.com/dsoprea/go-logging"
+)
+
+const (
+    testIndexSecondGpxData = `<?xml version="1.0" encoding="UTF-8" ?><gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1"><trk><trkseg>
+<trkpt lat="8.967136" lon="-79.533077"><time>2016-12-02T13:01:00Z</time></trkpt>
+<trkpt lat="8.967136" lon="-79.533077"><time>2016-12-02T13:00:01Z</time></trkpt>
+<trkpt lat="8.967136" lon="-79.533077"><time>2016-12-22T14:30:59Z</time></trkpt>
+<trkpt lat="8.967136" lon="-79.533077"><time>2016-12-22T14:37:21Z</time></trkpt>
+</trkseg></trk></gpx>`
+)
+
+type testDataAccessor struct {
+    data  map[string]string
+    opens int
+}
+
+func (tda *testDataAccessor) Open(label string) (io.ReadCloser, error) {
+    tda.opens++
+
+    return ioutil.NopCloser(bytes.NewBufferString(tda.data[label])), nil
+}
+
+func newTestIndex(maxFilesLoaded int) (*GpxIndex, *testDataAccessor) {
+    tda := &testDataAccessor{
+        data: map[string]string{
+            "day1": TestGpxData,
+            "day2": testIndexSecondGpxData,
+        },
+    }
+
+    gi := NewGpxIndex(tda, 5*time.Minute, maxFilesLoaded)
+
+    ti, err := gi.Add("day2")
+    log.PanicIf(err)
+
+    if ti[0].Format(time.RFC3339) != "2016-12-02T13:00:01Z" || ti[1].Format(time.RFC3339) != "2016-12-22T14:37:21Z" {
+        log.Panicf("interval not correct: %s", ti)
+    }
+
+    _, err = gi.Add("day1")
+    log.PanicIf(err)
+
+    return gi, tda
+}
+
+func TestGpxIndex_Add(t *testing.T) {
+    gi, tda := newTestIndex(0)
+
+    files := gi.Files()
+    if len(files) != 2 {
+        t.Fatalf("File count not correct: (%d)", len(files))
+    } else if files[0].Label != "day1" || files[1].Label != "day2" {
+        t.Fatalf("Files not ordered by start: [%s] [%s]", files[0].Label, files[1].Label)
+    } else if files[0].Count != 204 {
+        t.Fatalf("Point count not correct: (%d)", files[0].Count)
+    } else if gi.LoadedCount() != 0 {
+        t.Fatalf("Points should not be loaded by Add().")
+    }
+
+    _, err := gi.Add("day1")
+    if err == nil {
+        t.Fatalf("Expected error for duplicate file.")
+    } else if log.Is(err, ErrAlreadyIndexed) == false {
+        log.Panic(err)
+    }
+
+    if tda.opens != 2 {
+        t.Fatalf("Open count not correct: (%d)", tda.opens)
+    }
+}
+
+func TestGpxIndex_AddFileInfo(t *testing.T) {
+    gi := NewGpxIndex(new(testDataAccessor), time.Minute, 0)
+
+    epoch := time.Date(2016, 12, 2, 0, 0, 0, 0, time.UTC)
+
+    // Added latest-first, with two files starting at the same time.
+    for i := 1000; i > 0; i-- {
+        gfi := GpxFileInfo{
+            Label:    fmt.Sprintf("file%d", i),
+            Interval: TimeInterval{epoch.Add(time.Duration(i/2) * time.Hour), epoch.Add(time.Duration(i/2+1) * time.Hour)},
+            Count:    1,
+        }
+
+        err := gi.AddFileInfo(gfi)
+        log.PanicIf(err)
+    }
+
+    err := gi.AddFileInfo(GpxFileInfo{Label: "file500"})
+    if err == nil {
+        t.Fatalf("Expected error for duplicate file.")
+    } else if log.Is(err, ErrAlreadyIndexed) == false {
+        log.Panic(err)
+    }
+
+    files := gi.Files()
+    if len(files) != 1000 {
+        t.Fatalf("File count not correct: (%d)", len(files))
+    }
+
+    for i := 1; i < len(files); i++ {
+        if files[i].Interval[0].Before(files[i-1].Interval[0]) == true {
+            t.Fatalf("Files not ordered by start: (%d)", i)
+        }
+    }
+
+    // Files with the same start keep the order that they were added in.
+    if files[1].Label != "file3" || files[2].Label != "file2" {
+        t.Fatalf("Files with the same start not in order: [%s] [%s]", files[1].Label, files[2].Label)
+    }
+}
+
+func TestGpxIndex_Search(t *testing.T) {
+    gi, _ := newTestIndex(0)
+
+    q, err := time.Parse(time.RFC3339, "2016-12-02T13:02:01Z")
+    log.PanicIf(err)
+
+    matches, err := gi.Search(q)
+    log.PanicIf(err)
+
+    expected := []struct {
+        time  string
+        label string
+    }{
+        {"2016-12-02T13:00:01Z", "day1"},
+        {"2016-12-02T13:00:01Z", "day2"},
+        {"2016-12-02T13:01:00Z", "day2"},
+        {"2016-12-02T13:06:02Z", "day1"},
+    }
+
+    if len(matches) != len(expected) {
+        t.Fatalf("Match count not correct: %v", matches)
+    }
+
+    for i, e := range expected {
+        match := matches[i]
+
+        if match.Time.Format(time.RFC3339) != e.time || match.FileInfo.Label != e.label {
+            t.Fatalf("Match (%d) not correct: %s", i, match)
+        } else if match.Point.Time.Equal(match.Time) == false {
+            t.Fatalf("Match (%d) point not correct: %s", i, &match.Point)
+        }
+    }
+
+    q, err = time.Parse(time.RFC3339, "2016-12-22T14:32:59Z")
+    log.PanicIf(err)
+
+    matches, err = gi.Search(q)
+    log.PanicIf(err)
+
+    if len(matches) != 2 {
+        t.Fatalf("Match count not correct: %v", matches)
+    } else if matches[0].Time.Format(time.RFC3339) != "2016-12-22T14:30:59Z" || matches[1].Time.Format(time.RFC3339) != "2016-12-22T14:37:21Z" {
+        t.Fatalf("Matches not correct: %v", matches)
+    } else if matches[0].Point.LatitudeDecimal != 8.967136 {
+        t.Fatalf("Match point not correct: %s", &matches[0].Point)
+    }
+
+    // Within the interval of the second file but not near any of its points.
+
+    q, err = time.Parse(time.RFC3339, "2016-12-10T00:00:00Z")
+    log.PanicIf(err)
+
+    matches, err = gi.Search(q)
+    log.PanicIf(err)
+
+    if len(matches) != 0 {
+        t.Fatalf("Expected no matches: %v", matches)
+    }
+}
+
+func TestGpxIndex_Search_MaxFilesLoaded(t *testing.T) {
+    gi, tda := newTestIndex(1)
+
+    q1, err := time.Parse(time.RFC3339, "2016-12-02T13:02:01Z")
+    log.PanicIf(err)
+
+    q2, err := time.Parse(time.RFC3339, "2016-12-22T14:32:59Z")
+    log.PanicIf(err)
+
+    // Both files are needed, so the first is unloaded for the second.
+
+    _, err = gi.Search(q1)
+    log.PanicIf(err)
+
+    if gi.LoadedCount() != 1 {
+        t.Fatalf("Loaded count not correct: (%d)", gi.LoadedCount())
+    } else if tda.opens != 4 {
+        t.Fatalf("Open count not correct: (%d)", tda.opens)
+    }
+
+    // Only the second file is needed and it is still loaded.
+
+    _, err = gi.Search(q2)
+    log.PanicIf(err)
+
+    if tda.opens != 4 {
+        t.Fatalf("Open count not correct: (%d)", tda.opens)
+    }
+
+    // The first file has to be loaded again.
+
+    matches, err := gi.Search(q1)
+    log.PanicIf(err)
+
+    if len(matches) != 4 {
+        t.Fatalf("Match count not correct: %v", matches)
+    } else if tda.opens != 6 {
+        t.Fatalf("Open count not correct: (%d)", tda.opens)
+    }
+}
+
+func TestGpxFileDataAccessor(t *testing.T) {
+    tempPath, err := ioutil.TempDir("", "")
+    log.PanicIf(err)
+
+    defer os.RemoveAll(tempPath)
+
+    filepath := path.Join(tempPath, "day2.gpx")
+
+    err = ioutil.WriteFile(filepath, []byte(testIndexSecondGpxData), 0644)
+    log.PanicIf(err)
+
+    gi := NewGpxIndex(new(GpxFileDataAccessor), time.Minute, 0)
+
+    _, err = gi.Add(filepath)
+    log.PanicIf(err)
+
+    q, err := time.Parse(time.RFC3339, "2016-12-22T14:37:00Z")
+    log.PanicIf(err)
+
+    matches, err := gi.Search(q)
+    log.PanicIf(err)
+
+    if len(matches) != 1 || matches[0].FileInfo.Label != filepath {
+        t.Fatalf("Matches not correct: %v", matches)
+    }
+}
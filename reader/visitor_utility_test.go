@@ -35,4 +35,9 @@ func TestExtractTrackPoints(t *testing.T) {
     if len(points) != 204 {
         t.Fatalf("Point count not correct: (%d)", len(points))
     }
+
+    tp := points[0]
+    if tp.Hdop != 3.8 || tp.Vdop != 1.0 || tp.Pdop != 3.9 || tp.SatelliteCount != 4 {
+        t.Fatalf("Dilution of precision not correct: %s", &tp)
+    }
 }
@@ -14,6 +14,20 @@ type GpxFileVisitor interface {
     GpxClose(g *gpxcommon.Gpx) error
 }
 
+// GpxMetadataVisitor is given the metadata of the document. The fields are
+// only populated by the time that the metadata closes.
+type GpxMetadataVisitor interface {
+    MetadataOpen(md *gpxcommon.Metadata) error
+    MetadataClose(md *gpxcommon.Metadata) error
+}
+
+// GpxWaypointVisitor is given each waypoint. The fields are only populated by
+// the time that the waypoint closes.
+type GpxWaypointVisitor interface {
+    WaypointOpen(w *gpxcommon.Waypoint) error
+    WaypointClose(w *gpxcommon.Waypoint) error
+}
+
 type GpxTrackVisitor interface {
     TrackOpen(t *gpxcommon.Track) error
     TrackClose(t *gpxcommon.Track) error
@@ -34,6 +48,10 @@ type xmlVisitor struct {
     v  interface{}
 
     currentGpx          *gpxcommon.Gpx
+    currentMetadata     *gpxcommon.Metadata
+    currentLink         *gpxcommon.Link
+    inAuthor            bool
+    currentWaypoint     *gpxcommon.Waypoint
     currentTrack        *gpxcommon.Track
     currentTrackSegment *gpxcommon.TrackSegment
     currentTrackPoint   *gpxcommon.TrackPoint
@@ -64,6 +82,34 @@ func (xv *xmlVisitor) HandleStart(tagName string, attr map[string]string, xp *xm
                 log.Panic(err)
             }
         }
+    case "metadata":
+        xv.currentMetadata = new(gpxcommon.Metadata)
+
+        if gmv, ok := xv.v.(GpxMetadataVisitor); ok == true {
+            if err := gmv.MetadataOpen(xv.currentMetadata); err != nil {
+                log.Panic(err)
+            }
+        }
+    case "author":
+        xv.inAuthor = true
+    case "link":
+        // Only the links of the metadata itself are kept.
+        if xv.currentMetadata != nil && xv.inAuthor == false {
+            xv.currentLink = &gpxcommon.Link{
+                Href: attr["href"],
+            }
+        }
+    case "wpt":
+        xv.currentWaypoint = &gpxcommon.Waypoint{
+            LatitudeDecimal:  parseFloat64(attr["lat"]),
+            LongitudeDecimal: parseFloat64(attr["lon"]),
+        }
+
+        if gwv, ok := xv.v.(GpxWaypointVisitor); ok == true {
+            if err := gwv.WaypointOpen(xv.currentWaypoint); err != nil {
+                log.Panic(err)
+            }
+        }
     case "trk":
         xv.currentTrack = new(gpxcommon.Track)
 
@@ -111,6 +157,29 @@ func (xv *xmlVisitor) HandleEnd(tagName string, xp *xmlvisitor.XmlParser) (err e
         }
 
         xv.currentGpx = nil
+    case "metadata":
+        if gmv, ok := xv.v.(GpxMetadataVisitor); ok == true {
+            if err := gmv.MetadataClose(xv.currentMetadata); err != nil {
+                log.Panic(err)
+            }
+        }
+
+        xv.currentMetadata = nil
+    case "author":
+        xv.inAuthor = false
+    case "link":
+        if xv.currentLink != nil {
+            xv.currentMetadata.Links = append(xv.currentMetadata.Links, *xv.currentLink)
+            xv.currentLink = nil
+        }
+    case "wpt":
+        if gwv, ok := xv.v.(GpxWaypointVisitor); ok == true {
+            if err := gwv.WaypointClose(xv.currentWaypoint); err != nil {
+                log.Panic(err)
+            }
+        }
+
+        xv.currentWaypoint = nil
     case "trk":
         if gtv, ok := xv.v.(GpxTrackVisitor); ok == true {
             if err := gtv.TrackClose(xv.currentTrack); err != nil {
@@ -157,6 +226,24 @@ func (xv *xmlVisitor) HandleValue(tagName string, value string, xp *xmlvisitor.X
             if err := xv.handleTrackPointValue(tagName, value); err != nil {
                 log.Panic(err)
             }
+        } else if parentName == "wpt" && xv.currentWaypoint != nil {
+            if err := xv.handleWaypointValue(tagName, value); err != nil {
+                log.Panic(err)
+            }
+        } else if parentName == "trk" {
+            xv.handleTrackValue(tagName, value)
+        } else if parentName == "metadata" && xv.currentMetadata != nil {
+            if err := xv.handleMetadataValue(tagName, value); err != nil {
+                log.Panic(err)
+            }
+        } else if parentName == "author" && xv.currentMetadata != nil && tagName == "name" {
+            xv.currentMetadata.AuthorName = value
+        } else if parentName == "link" && xv.currentLink != nil {
+            if tagName == "text" {
+                xv.currentLink.Text = value
+            } else if tagName == "type" {
+                xv.currentLink.Type = value
+            }
         }
     }
 
@@ -235,10 +322,16 @@ func (xv *xmlVisitor) handleTrackPointValue(tagName string, s string) (err error
         xv.currentTrackPoint.Elevation = parseFloat32(s)
     case "course":
         xv.currentTrackPoint.Course = parseFloat32(s)
+        xv.currentTrackPoint.HasCourse = true
     case "speed":
         xv.currentTrackPoint.Speed = parseFloat32(s)
+        xv.currentTrackPoint.HasSpeed = true
     case "hdop":
         xv.currentTrackPoint.Hdop = parseFloat32(s)
+    case "vdop":
+        xv.currentTrackPoint.Vdop = parseFloat32(s)
+    case "pdop":
+        xv.currentTrackPoint.Pdop = parseFloat32(s)
     case "src":
         xv.currentTrackPoint.Src = s
     case "sat":
@@ -250,3 +343,69 @@ func (xv *xmlVisitor) handleTrackPointValue(tagName string, s string) (err error
 
     return nil
 }
+
+// Handle values for the child nodes of a waypoint node.
+func (xv *xmlVisitor) handleWaypointValue(tagName string, s string) (err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    switch tagName {
+    case "ele":
+        xv.currentWaypoint.Elevation = parseFloat32(s)
+    case "time":
+        xv.currentWaypoint.Time, err = xv.parseTimestamp(s)
+        log.PanicIf(err)
+    case "name":
+        xv.currentWaypoint.Name = s
+    case "cmt":
+        xv.currentWaypoint.Comment = s
+    case "desc":
+        xv.currentWaypoint.Description = s
+    case "src":
+        xv.currentWaypoint.Src = s
+    case "sym":
+        xv.currentWaypoint.Symbol = s
+    case "type":
+        xv.currentWaypoint.Type = s
+    }
+
+    return nil
+}
+
+// Handle values for the child nodes of a metadata node.
+func (xv *xmlVisitor) handleMetadataValue(tagName string, s string) (err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    switch tagName {
+    case "name":
+        xv.currentMetadata.Name = s
+    case "desc":
+        xv.currentMetadata.Description = s
+    case "keywords":
+        xv.currentMetadata.Keywords = s
+    case "time":
+        xv.currentMetadata.Time, err = xv.parseTimestamp(s)
+        log.PanicIf(err)
+    }
+
+    return nil
+}
+
+// Handle values for the child nodes of a track node.
+func (xv *xmlVisitor) handleTrackValue(tagName string, s string) {
+    switch tagName {
+    case "name":
+        xv.currentTrack.Name = s
+    case "desc":
+        xv.currentTrack.Description = s
+    case "type":
+        xv.currentTrack.Type = s
+    }
+}
@@ -0,0 +1,87 @@
+package gpxsimplify
+
+import (
+    "math"
+
+    "github.com/dsoprea/go-gpx"
+    "github.com/dsoprea/go-gpx/geo"
+)
+
+// ErrorFunc measures how much is lost by dropping `p` and going straight from
+// `a` to `b`. The units depend on the function.
+type ErrorFunc func(a, p, b *gpxcommon.TrackPoint) float64
+
+// CrossTrackError returns the great-circle distance in meters from `p` to the
+// path between `a` and `b`. If `p` is beyond either end then the distance to
+// that end is returned.
+func CrossTrackError(a, p, b *gpxcommon.TrackPoint) float64 {
+    distanceAP := gpxgeo.HaversineDistance(a, p)
+    distanceAB := gpxgeo.HaversineDistance(a, b)
+
+    if distanceAB == 0 {
+        return distanceAP
+    }
+
+    theta := (gpxgeo.SphericalInitialBearing(a, p) - gpxgeo.SphericalInitialBearing(a, b)) * math.Pi / 180
+
+    // Behind `a`.
+    if math.Cos(theta) < 0 {
+        return distanceAP
+    }
+
+    deltaAP := distanceAP / gpxgeo.EarthRadius
+    crossTrack := math.Asin(math.Sin(deltaAP) * math.Sin(theta))
+    alongTrack := math.Acos(math.Min(1, math.Cos(deltaAP)/math.Cos(crossTrack))) * gpxgeo.EarthRadius
+
+    // Past `b`.
+    if alongTrack > distanceAB {
+        return gpxgeo.HaversineDistance(b, p)
+    }
+
+    return math.Abs(crossTrack) * gpxgeo.EarthRadius
+}
+
+// SynchronizedError returns the synchronized Euclidean distance (SED) in
+// meters: the distance between `p` and where we would have been at the same
+// time if we had gone from `a` to `b` at a constant speed. Unlike the
+// cross-track error, this keeps the points where we sped up, slowed down, or
+// stopped. CrossTrackError() is used if any of the points are missing a time
+// or `b` is not after `a`.
+func SynchronizedError(a, p, b *gpxcommon.TrackPoint) float64 {
+    if a.Time.IsZero() == true || p.Time.IsZero() == true || b.Time.IsZero() == true {
+        return CrossTrackError(a, p, b)
+    }
+
+    total := b.Time.Sub(a.Time)
+    if total <= 0 {
+        return CrossTrackError(a, p, b)
+    }
+
+    fraction := float64(p.Time.Sub(a.Time)) / float64(total)
+    fraction = math.Max(0, math.Min(1, fraction))
+
+    expected := gpxgeo.IntermediatePoint(a, b, fraction)
+
+    return gpxgeo.HaversineDistance(&expected, p)
+}
+
+// TriangleArea returns the area in square meters of the triangle formed by
+// the three points. The points are projected onto a plane tangent at `p`,
+// which is accurate for the short distances between consecutive points.
+func TriangleArea(a, p, b *gpxcommon.TrackPoint) float64 {
+    ax, ay := project(p, a)
+    bx, by := project(p, b)
+
+    return math.Abs(ax*by-bx*ay) / 2
+}
+
+// project returns the position of `tp` in meters east and north of `origin`.
+func project(origin, tp *gpxcommon.TrackPoint) (x, y float64) {
+    deltaLongitude := math.Mod(tp.LongitudeDecimal-origin.LongitudeDecimal+540, 360) - 180
+    deltaLatitude := tp.LatitudeDecimal - origin.LatitudeDecimal
+
+    x = deltaLongitude * math.Pi / 180 * gpxgeo.EarthRadius * math.Cos(origin.LatitudeDecimal*math.Pi/180)
+    y = deltaLatitude * math.Pi / 180 * gpxgeo.EarthRadius
+
+    return x, y
+}
@@ -0,0 +1,75 @@
+package gpxsimplify
+
+import (
+    "math"
+    "testing"
+    "time"
+
+    "github.com/dsoprea/go-gpx"
+)
+
+func TestCrossTrackError(t *testing.T) {
+    a := &gpxcommon.TrackPoint{LatitudeDecimal: 0, LongitudeDecimal: 0}
+    b := &gpxcommon.TrackPoint{LatitudeDecimal: 0, LongitudeDecimal: 1}
+    p := &gpxcommon.TrackPoint{LatitudeDecimal: 0.001, LongitudeDecimal: 0.5}
+
+    // A thousandth of a degree of latitude.
+    expected := 0.001 * math.Pi / 180 * 6371008.8
+
+    if e := CrossTrackError(a, p, b); math.Abs(e-expected) > 1e-3 {
+        t.Fatalf("Cross-track error not correct: (%f) != (%f)", e, expected)
+    }
+}
+
+func TestCrossTrackError_BeyondEnds(t *testing.T) {
+    a := &gpxcommon.TrackPoint{LatitudeDecimal: 0, LongitudeDecimal: 0}
+    b := &gpxcommon.TrackPoint{LatitudeDecimal: 0, LongitudeDecimal: 1}
+
+    before := &gpxcommon.TrackPoint{LatitudeDecimal: 0, LongitudeDecimal: -0.5}
+    after := &gpxcommon.TrackPoint{LatitudeDecimal: 0, LongitudeDecimal: 1.5}
+
+    expected := 0.5 * math.Pi / 180 * 6371008.8
+
+    if e := CrossTrackError(a, before, b); math.Abs(e-expected) > 1e-3 {
+        t.Fatalf("Error before the start not correct: (%f)", e)
+    } else if e := CrossTrackError(a, after, b); math.Abs(e-expected) > 1e-3 {
+        t.Fatalf("Error after the end not correct: (%f)", e)
+    }
+}
+
+func TestSynchronizedError(t *testing.T) {
+    epoch := time.Date(2016, 12, 2, 8, 0, 0, 0, time.UTC)
+
+    a := &gpxcommon.TrackPoint{LongitudeDecimal: 0, Time: epoch}
+    b := &gpxcommon.TrackPoint{LongitudeDecimal: 1, Time: epoch.Add(10 * time.Minute)}
+
+    // Right on the line, but we should only have been halfway there.
+    p := &gpxcommon.TrackPoint{LongitudeDecimal: 0.75, Time: epoch.Add(5 * time.Minute)}
+
+    expected := 0.25 * math.Pi / 180 * 6371008.8
+
+    if e := CrossTrackError(a, p, b); e > 1e-6 {
+        t.Fatalf("Cross-track error not zero: (%f)", e)
+    } else if e := SynchronizedError(a, p, b); math.Abs(e-expected) > 1e-3 {
+        t.Fatalf("Synchronized error not correct: (%f) != (%f)", e, expected)
+    }
+
+    p.Time = time.Time{}
+
+    if e := SynchronizedError(a, p, b); e > 1e-6 {
+        t.Fatalf("Missing time did not fall back to cross-track error: (%f)", e)
+    }
+}
+
+func TestTriangleArea(t *testing.T) {
+    a := &gpxcommon.TrackPoint{LatitudeDecimal: 0, LongitudeDecimal: 0}
+    p := &gpxcommon.TrackPoint{LatitudeDecimal: 0, LongitudeDecimal: 0.001}
+    b := &gpxcommon.TrackPoint{LatitudeDecimal: 0.001, LongitudeDecimal: 0.001}
+
+    side := 0.001 * math.Pi / 180 * 6371008.8
+    expected := side * side / 2
+
+    if area := TriangleArea(a, p, b); math.Abs(area-expected) > 1e-6 {
+        t.Fatalf("Area not correct: (%f) != (%f)", area, expected)
+    }
+}
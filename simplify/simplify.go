@@ -0,0 +1,205 @@
+package gpxsimplify
+
+import (
+    "container/heap"
+
+    "github.com/dsoprea/go-gpx"
+    "github.com/dsoprea/go-gpx/pipe"
+)
+
+// DouglasPeucker simplifies the points using the Ramer-Douglas-Peucker
+// algorithm. The first and last points are always kept, and every dropped
+// point is within `tolerance` (as measured by `ef`) of the simplified path
+// that replaces it. Use CrossTrackError() for a tolerance in meters or
+// SynchronizedError() to also preserve changes in speed. A new slice is
+// returned.
+func DouglasPeucker(points []gpxcommon.TrackPoint, tolerance float64, ef ErrorFunc) []gpxcommon.TrackPoint {
+    if len(points) <= 2 {
+        return append([]gpxcommon.TrackPoint{}, points...)
+    }
+
+    keep := make([]bool, len(points))
+    keep[0] = true
+    keep[len(points)-1] = true
+
+    // Use our own stack so that long recordings can't exhaust the real one.
+    stack := [][2]int{{0, len(points) - 1}}
+
+    for len(stack) > 0 {
+        span := stack[len(stack)-1]
+        stack = stack[:len(stack)-1]
+
+        first, last := span[0], span[1]
+
+        worstIndex := -1
+        worstError := tolerance
+
+        for i := first + 1; i < last; i++ {
+            e := ef(&points[first], &points[i], &points[last])
+
+            if e > worstError {
+                worstIndex = i
+                worstError = e
+            }
+        }
+
+        if worstIndex == -1 {
+            continue
+        }
+
+        keep[worstIndex] = true
+
+        stack = append(stack, [2]int{first, worstIndex}, [2]int{worstIndex, last})
+    }
+
+    simplified := make([]gpxcommon.TrackPoint, 0)
+    for i, tp := range points {
+        if keep[i] == true {
+            simplified = append(simplified, tp)
+        }
+    }
+
+    return simplified
+}
+
+// vwCandidate is a point that can still be removed.
+type vwCandidate struct {
+    index      int
+    importance float64
+
+    // heapIndex is our position in the heap, so that we can be updated.
+    heapIndex int
+}
+
+// vwHeap orders the candidates by importance, least important first.
+type vwHeap []*vwCandidate
+
+func (vh vwHeap) Len() int {
+    return len(vh)
+}
+
+func (vh vwHeap) Less(i, j int) bool {
+    if vh[i].importance != vh[j].importance {
+        return vh[i].importance < vh[j].importance
+    }
+
+    return vh[i].index < vh[j].index
+}
+
+func (vh vwHeap) Swap(i, j int) {
+    vh[i], vh[j] = vh[j], vh[i]
+    vh[i].heapIndex = i
+    vh[j].heapIndex = j
+}
+
+func (vh *vwHeap) Push(x interface{}) {
+    c := x.(*vwCandidate)
+    c.heapIndex = len(*vh)
+    *vh = append(*vh, c)
+}
+
+func (vh *vwHeap) Pop() interface{} {
+    old := *vh
+    c := old[len(old)-1]
+    *vh = old[:len(old)-1]
+
+    return c
+}
+
+// VisvalingamWhyatt simplifies the points using the Visvalingam-Whyatt
+// algorithm, repeatedly dropping the point whose removal loses the least (as
+// measured by `ef`) until only `targetCount` points are left. Use
+// TriangleArea() for the classic algorithm or SynchronizedError() to also
+// preserve changes in speed. The first and last points are always kept, so
+// at least two points are returned. A new slice is returned.
+func VisvalingamWhyatt(points []gpxcommon.TrackPoint, targetCount int, ef ErrorFunc) []gpxcommon.TrackPoint {
+    if targetCount < 2 {
+        targetCount = 2
+    }
+
+    if len(points) <= targetCount {
+        return append([]gpxcommon.TrackPoint{}, points...)
+    }
+
+    previous := make([]int, len(points))
+    next := make([]int, len(points))
+
+    for i := range points {
+        previous[i] = i - 1
+        next[i] = i + 1
+    }
+
+    candidates := make([]*vwCandidate, len(points))
+    vh := make(vwHeap, 0, len(points)-2)
+
+    for i := 1; i < len(points)-1; i++ {
+        c := &vwCandidate{
+            index:      i,
+            importance: ef(&points[i-1], &points[i], &points[i+1]),
+        }
+
+        candidates[i] = c
+        heap.Push(&vh, c)
+    }
+
+    removed := make([]bool, len(points))
+
+    for remaining := len(points); remaining > targetCount; remaining-- {
+        c := heap.Pop(&vh).(*vwCandidate)
+        removed[c.index] = true
+
+        p := previous[c.index]
+        n := next[c.index]
+
+        next[p] = n
+        previous[n] = p
+
+        // Recalculate the neighbors. They never become less important than
+        // the point that was just removed, otherwise they'd be removed next
+        // merely because a more important point was removed first.
+        for _, neighbor := range []int{p, n} {
+            nc := candidates[neighbor]
+            if nc == nil {
+                continue
+            }
+
+            importance := ef(&points[previous[neighbor]], &points[neighbor], &points[next[neighbor]])
+            if importance < c.importance {
+                importance = c.importance
+            }
+
+            nc.importance = importance
+            heap.Fix(&vh, nc.heapIndex)
+        }
+    }
+
+    simplified := make([]gpxcommon.TrackPoint, 0, targetCount)
+    for i, tp := range points {
+        if removed[i] == false {
+            simplified = append(simplified, tp)
+        }
+    }
+
+    return simplified
+}
+
+// DouglasPeuckerStage returns a pipeline stage that applies DouglasPeucker()
+// to each segment.
+func DouglasPeuckerStage(tolerance float64, ef ErrorFunc) gpxpipe.Stage {
+    st := func(points []gpxcommon.TrackPoint) ([]gpxcommon.TrackPoint, error) {
+        return DouglasPeucker(points, tolerance, ef), nil
+    }
+
+    return gpxpipe.Segment(st)
+}
+
+// VisvalingamWhyattStage returns a pipeline stage that applies
+// VisvalingamWhyatt() to each segment. `targetCount` applies to each segment
+// separately.
+func VisvalingamWhyattStage(targetCount int, ef ErrorFunc) gpxpipe.Stage {
+    st := func(points []gpxcommon.TrackPoint) ([]gpxcommon.TrackPoint, error) {
+        return VisvalingamWhyatt(points, targetCount, ef), nil
+    }
+
+    return gpxpipe.Segment(st)
+}
@@ -0,0 +1,175 @@
+package gpxsimplify
+
+import (
+    "bytes"
+    "testing"
+    "time"
+
+    "github.com/dsoprea/go-logging"
+
+    "github.com/dsoprea/go-gpx"
+    "github.com/dsoprea/go-gpx/pipe"
+    "github.com/dsoprea/go-gpx/reader"
+)
+
+// getZigZagTestPoints returns a path that goes east for ten points and then
+// north for ten points, with a small (about 11 meter) wobble at every other
+// point.
+func getZigZagTestPoints() []gpxcommon.TrackPoint {
+    points := make([]gpxcommon.TrackPoint, 21)
+
+    for i := range points {
+        wobble := 0.0
+        if i%2 == 1 {
+            wobble = 0.0001
+        }
+
+        if i <= 10 {
+            points[i] = gpxcommon.TrackPoint{
+                LatitudeDecimal:  wobble,
+                LongitudeDecimal: float64(i) * 0.001,
+            }
+        } else {
+            points[i] = gpxcommon.TrackPoint{
+                LatitudeDecimal:  float64(i-10) * 0.001,
+                LongitudeDecimal: 0.01 + wobble,
+            }
+        }
+    }
+
+    return points
+}
+
+func TestDouglasPeucker(t *testing.T) {
+    points := getZigZagTestPoints()
+
+    simplified := DouglasPeucker(points, 50, CrossTrackError)
+
+    if len(simplified) != 3 {
+        t.Fatalf("Point count not correct: (%d)", len(simplified))
+    } else if simplified[0] != points[0] || simplified[1] != points[10] || simplified[2] != points[20] {
+        t.Fatalf("Wrong points kept: %v", simplified)
+    }
+
+    simplified = DouglasPeucker(points, 5, CrossTrackError)
+
+    if len(simplified) != len(points) {
+        t.Fatalf("Wobbles not kept: (%d)", len(simplified))
+    }
+}
+
+func TestDouglasPeucker_Short(t *testing.T) {
+    points := getZigZagTestPoints()[:2]
+
+    simplified := DouglasPeucker(points, 50, CrossTrackError)
+
+    if len(simplified) != 2 {
+        t.Fatalf("Point count not correct: (%d)", len(simplified))
+    }
+
+    simplified[0].LatitudeDecimal = 99
+
+    if points[0].LatitudeDecimal == 99 {
+        t.Fatalf("Original points were modified.")
+    }
+}
+
+func TestDouglasPeucker_Synchronized(t *testing.T) {
+    // A straight line with a long stop in the middle.
+    epoch := time.Date(2016, 12, 2, 8, 0, 0, 0, time.UTC)
+    offsets := []time.Duration{0, 1, 2, 3, 30, 31, 32}
+    longitudes := []float64{0, 0.001, 0.002, 0.003, 0.003, 0.004, 0.005}
+
+    points := make([]gpxcommon.TrackPoint, len(offsets))
+    for i := range points {
+        points[i] = gpxcommon.TrackPoint{
+            LongitudeDecimal: longitudes[i],
+            Time:             epoch.Add(offsets[i] * time.Minute),
+        }
+    }
+
+    simplified := DouglasPeucker(points, 10, CrossTrackError)
+
+    if len(simplified) != 2 {
+        t.Fatalf("Point count not correct: (%d)", len(simplified))
+    }
+
+    simplified = DouglasPeucker(points, 10, SynchronizedError)
+
+    if len(simplified) != 4 {
+        t.Fatalf("Point count not correct: (%d) %v", len(simplified), simplified)
+    } else if simplified[1] != points[3] || simplified[2] != points[4] {
+        t.Fatalf("Stop not kept: %v", simplified)
+    }
+}
+
+func TestVisvalingamWhyatt(t *testing.T) {
+    points := getZigZagTestPoints()
+
+    simplified := VisvalingamWhyatt(points, 3, TriangleArea)
+
+    if len(simplified) != 3 {
+        t.Fatalf("Point count not correct: (%d)", len(simplified))
+    } else if simplified[0] != points[0] || simplified[1] != points[10] || simplified[2] != points[20] {
+        t.Fatalf("Wrong points kept: %v", simplified)
+    }
+
+    simplified = VisvalingamWhyatt(points, 100, TriangleArea)
+
+    if len(simplified) != len(points) {
+        t.Fatalf("Point count not correct: (%d)", len(simplified))
+    }
+
+    simplified = VisvalingamWhyatt(points, 0, TriangleArea)
+
+    if len(simplified) != 2 {
+        t.Fatalf("Endpoints not kept: (%d)", len(simplified))
+    }
+}
+
+func TestVisvalingamWhyattStage(t *testing.T) {
+    p := gpxpipe.NewPipeline(VisvalingamWhyattStage(50, SynchronizedError))
+
+    count := 0
+    sink := func(e gpxpipe.Element) error {
+        if e.Type == gpxpipe.ElementPoint {
+            count++
+        }
+
+        return nil
+    }
+
+    err := p.Enumerate(bytes.NewBufferString(gpxreader.TestGpxData), sink)
+    log.PanicIf(err)
+
+    if count != 50 {
+        t.Fatalf("Point count not correct: (%d)", count)
+    }
+}
+
+func TestDouglasPeuckerStage(t *testing.T) {
+    p := gpxpipe.NewPipeline(DouglasPeuckerStage(100, CrossTrackError))
+
+    points := make([]gpxcommon.TrackPoint, 0)
+    sink := func(e gpxpipe.Element) error {
+        if e.Type == gpxpipe.ElementPoint {
+            points = append(points, *e.Point)
+        }
+
+        return nil
+    }
+
+    err := p.Enumerate(bytes.NewBufferString(gpxreader.TestGpxData), sink)
+    log.PanicIf(err)
+
+    original, err := gpxreader.ExtractTrackPoints(bytes.NewBufferString(gpxreader.TestGpxData))
+    log.PanicIf(err)
+
+    expected := DouglasPeucker(original, 100, CrossTrackError)
+
+    if len(points) != len(expected) {
+        t.Fatalf("Point count not correct: (%d) != (%d)", len(points), len(expected))
+    } else if len(points) >= len(original) {
+        t.Fatalf("Nothing was simplified.")
+    }
+}
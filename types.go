@@ -15,9 +15,7 @@ import (
     email
     author
     metadata
-    bounds
 
-- What does the MovingData struct from the original project represent?
 - Additional reference: http://www.topografix.com/gpx_manual.asp#hdop
 
 */
@@ -36,11 +34,59 @@ func (g *Gpx) String() string {
     return fmt.Sprintf("GPX<C=[%s]>", g.Creator)
 }
 
+// Link is a reference to an external resource.
+type Link struct {
+    Href string
+    Text string
+    Type string
+}
+
+func (l Link) String() string {
+    return fmt.Sprintf("Link<HREF=[%s] TEXT=[%s] TYPE=[%s]>", l.Href, l.Text, l.Type)
+}
+
+// Metadata describes the document. Only the fields that we support are read.
+type Metadata struct {
+    Name        string
+    Description string
+    AuthorName  string
+    Links       []Link
+    Time        time.Time
+    Keywords    string
+}
+
+func (md *Metadata) String() string {
+    return fmt.Sprintf("Metadata<NAME=[%s] AUTHOR=[%s] TIME=[%s]>", md.Name, md.AuthorName, md.Time)
+}
+
+// Waypoint is a point of interest outside of any track.
+type Waypoint struct {
+    LatitudeDecimal  float64
+    LongitudeDecimal float64
+    Elevation        float32
+    Time             time.Time
+    Name             string
+    Comment          string
+    Description      string
+    Src              string
+    Symbol           string
+    Type             string
+}
+
+func (w *Waypoint) String() string {
+    return fmt.Sprintf("Waypoint<LAT=(%.8f) LON=(%.8f) NAME=[%s] TIME=[%s]>", w.LatitudeDecimal, w.LongitudeDecimal, w.Name, w.Time)
+}
+
+// Track is only complete when the track closes. The name, description, and
+// type come before the first segment, so they are also available by then.
 type Track struct {
+    Name        string
+    Description string
+    Type        string
 }
 
 func (g *Track) String() string {
-    return fmt.Sprintf("Track<>")
+    return fmt.Sprintf("Track<NAME=[%s] TYPE=[%s]>", g.Name, g.Type)
 }
 
 type TrackSegment struct {
@@ -57,11 +103,52 @@ type TrackPoint struct {
     Course           float32
     Speed            float32
     Hdop             float32
+    Vdop             float32
+    Pdop             float32
     Src              string
     SatelliteCount   uint8
     Time             time.Time
+
+    // SpeedDerived and CourseDerived are set when the values were calculated
+    // from the neighboring points rather than recorded by the device. They
+    // are not written to or read from GPX.
+    SpeedDerived  bool
+    CourseDerived bool
+
+    // HasSpeed and HasCourse are set by the reader when the elements were
+    // present, so that a recorded zero can be told apart from a missing value.
+    HasSpeed  bool
+    HasCourse bool
 }
 
 func (tp *TrackPoint) String() string {
-    return fmt.Sprintf("TrackPoint<LAT=(%.8f) LON=(%.8f) ELV=(%f) CRS=(%f) SPD=(%f) HDOP=(%f) SRC=[%s] SAT=(%d) TIME=[%s]>", tp.LatitudeDecimal, tp.LongitudeDecimal, tp.Elevation, tp.Course, tp.Speed, tp.Hdop, tp.Src, tp.SatelliteCount, tp.Time)
+    return fmt.Sprintf("TrackPoint<LAT=(%.8f) LON=(%.8f) ELV=(%f) CRS=(%f) SPD=(%f) HDOP=(%f) VDOP=(%f) PDOP=(%f) SRC=[%s] SAT=(%d) TIME=[%s]>", tp.LatitudeDecimal, tp.LongitudeDecimal, tp.Elevation, tp.Course, tp.Speed, tp.Hdop, tp.Vdop, tp.Pdop, tp.Src, tp.SatelliteCount, tp.Time)
+}
+
+// MovingData splits the time and distance of a recording into the parts where
+// we were moving and the parts where we were stopped. Times and distances are
+// the sums of the intervals between consecutive points. Distances are in
+// meters and speeds in meters per second.
+type MovingData struct {
+    MovingTime      time.Duration
+    StoppedTime     time.Duration
+    MovingDistance  float64
+    StoppedDistance float64
+    MaxSpeed        float64
+}
+
+func (md *MovingData) String() string {
+    return fmt.Sprintf("MovingData<MOVING-TIME=[%s] STOPPED-TIME=[%s] MOVING-DIST=(%.3f) STOPPED-DIST=(%.3f) MAX-SPEED=(%.3f)>", md.MovingTime, md.StoppedTime, md.MovingDistance, md.StoppedDistance, md.MaxSpeed)
+}
+
+// Bounds is a rectangle in decimal degrees.
+type Bounds struct {
+    MinLatitude  float64
+    MinLongitude float64
+    MaxLatitude  float64
+    MaxLongitude float64
+}
+
+func (b *Bounds) String() string {
+    return fmt.Sprintf("Bounds<MIN-LAT=(%.8f) MIN-LON=(%.8f) MAX-LAT=(%.8f) MAX-LON=(%.8f)>", b.MinLatitude, b.MinLongitude, b.MaxLatitude, b.MaxLongitude)
 }
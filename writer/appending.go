@@ -0,0 +1,317 @@
+package gpxwriter
+
+import (
+    "bytes"
+    "fmt"
+    "io"
+    "os"
+    "time"
+
+    "github.com/dsoprea/go-logging"
+)
+
+var (
+    ErrNotAppendable = fmt.Errorf("file does not end with a track-segment that can be appended to")
+)
+
+const (
+    // appendingScanSize is how much we read at a time while searching
+    // backwards for the end of the last segment.
+    appendingScanSize = 4096
+
+    compactTail  = "</trkseg></trk></gpx>"
+    indentedTail = "\n    </trkseg>\n  </trk>\n</gpx>"
+)
+
+// AppendingWriter appends track-points to the last segment of a GPX file. The
+// closing tags are rewritten after the new points on every flush so that the
+// file on disk is always complete, which is what we want for live logging
+// where power can be lost at any moment.
+type AppendingWriter struct {
+    f            *os.File
+    options      BuilderOptions
+    syncInterval time.Duration
+
+    // tailOffset is the position where the closing tags begin.
+    tailOffset int64
+    tail       []byte
+
+    pending     *bytes.Buffer
+    pendingUsed bool
+    gtsb        *GpxTrackSegmentBuilder
+
+    lastSync time.Time
+    unsynced bool
+}
+
+// NewAppendingWriter opens the given file for appending, creating it if it
+// does not exist. If it exists, points will be added to the last segment of
+// the last track. A trailing partial point left by an interrupted flush is
+// discarded. The file is synced on every flush if `syncInterval` is zero and
+// otherwise only once that much time has passed since the last sync.
+func NewAppendingWriter(filepath string, options BuilderOptions, syncInterval time.Duration) (aw *AppendingWriter, err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    f, err := os.OpenFile(filepath, os.O_RDWR|os.O_CREATE, 0644)
+    log.PanicIf(err)
+
+    aw = &AppendingWriter{
+        f:            f,
+        options:      options,
+        syncInterval: syncInterval,
+        pending:      new(bytes.Buffer),
+        lastSync:     time.Now(),
+    }
+
+    if options.Compact == true {
+        aw.tail = []byte(compactTail)
+    } else {
+        aw.tail = []byte(indentedTail)
+    }
+
+    if err := aw.open(); err != nil {
+        f.Close()
+        log.Panic(err)
+    }
+
+    // Points are rendered at the depth that they have in the document.
+    b := newBuilder(aw.pending, options, "      ")
+
+    aw.gtsb = &GpxTrackSegmentBuilder{
+        b: b,
+    }
+
+    return aw, nil
+}
+
+// open either writes the preamble for a new file or finds the end of the last
+// segment in an existing file. The tail is then (re)written.
+func (aw *AppendingWriter) open() (err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    fi, err := aw.f.Stat()
+    log.PanicIf(err)
+
+    if fi.Size() == 0 {
+        b, err := NewBuilderWithOptions(aw.f, aw.options)
+        log.PanicIf(err)
+
+        gb, err := b.Gpx()
+        log.PanicIf(err)
+
+        gtb, err := gb.Track()
+        log.PanicIf(err)
+
+        _, err = gtb.TrackSegment()
+        log.PanicIf(err)
+
+        err = b.encoder.Flush()
+        log.PanicIf(err)
+
+        aw.tailOffset, err = aw.f.Seek(0, io.SeekCurrent)
+        log.PanicIf(err)
+    } else {
+        aw.tailOffset, err = findTailOffset(aw.f, fi.Size())
+        log.PanicIf(err)
+    }
+
+    err = aw.write(nil)
+    log.PanicIf(err)
+
+    err = aw.f.Sync()
+    log.PanicIf(err)
+
+    aw.unsynced = false
+
+    return nil
+}
+
+// findTailOffset searches backwards for the end of the last point or, if the
+// last segment is empty, the end of its opening tag.
+func findTailOffset(f *os.File, size int64) (offset int64, err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    pointEndTag := []byte("</trkpt>")
+    segmentStartTag := []byte("<trkseg>")
+
+    var suffix []byte
+    position := size
+
+    for position > 0 {
+        readSize := int64(appendingScanSize)
+        if readSize > position {
+            readSize = position
+        }
+
+        position -= readSize
+
+        chunk := make([]byte, readSize+int64(len(suffix)))
+
+        _, err := f.ReadAt(chunk[:readSize], position)
+        log.PanicIf(err)
+
+        copy(chunk[readSize:], suffix)
+        suffix = chunk
+
+        found := -1
+
+        if i := bytes.LastIndex(suffix, pointEndTag); i != -1 {
+            found = i + len(pointEndTag)
+        }
+
+        if i := bytes.LastIndex(suffix, segmentStartTag); i != -1 && i+len(segmentStartTag) > found {
+            found = i + len(segmentStartTag)
+        }
+
+        if found == -1 {
+            continue
+        }
+
+        if isAppendableRemainder(suffix[found:]) == false {
+            log.Panic(ErrNotAppendable)
+        }
+
+        return position + int64(found), nil
+    }
+
+    log.Panic(ErrNotAppendable)
+    return 0, nil
+}
+
+// isAppendableRemainder returns whether everything after the last point is
+// either (part of) the closing tags or a partial point written by a flush
+// that was interrupted.
+func isAppendableRemainder(remainder []byte) bool {
+    stripped := bytes.Join(bytes.Fields(remainder), nil)
+
+    if bytes.HasPrefix([]byte(compactTail), stripped) == true {
+        return true
+    }
+
+    if bytes.HasPrefix(stripped, []byte("<trkpt")) == true && bytes.Contains(stripped, []byte("</gpx>")) == false {
+        return true
+    }
+
+    return false
+}
+
+// write writes the given data followed by the tail at the tail offset and
+// drops anything after it.
+func (aw *AppendingWriter) write(data []byte) (err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    // Write the data and the tail in one call to keep the window where the
+    // file is incomplete as small as possible.
+
+    buffer := make([]byte, len(data)+len(aw.tail))
+    copy(buffer, data)
+    copy(buffer[len(data):], aw.tail)
+
+    _, err = aw.f.WriteAt(buffer, aw.tailOffset)
+    log.PanicIf(err)
+
+    aw.tailOffset += int64(len(data))
+
+    err = aw.f.Truncate(aw.tailOffset + int64(len(aw.tail)))
+    log.PanicIf(err)
+
+    aw.unsynced = true
+
+    return nil
+}
+
+// TrackPoint returns a builder for the next point. Written points are only
+// stored to the file by Flush().
+func (aw *AppendingWriter) TrackPoint() *GpxTrackPointBuilder {
+    return aw.gtsb.TrackPoint()
+}
+
+// Flush stores any written points to the file and syncs it if the sync
+// interval has elapsed.
+func (aw *AppendingWriter) Flush() (err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    err = aw.gtsb.b.encoder.Flush()
+    log.PanicIf(err)
+
+    if aw.pending.Len() > 0 {
+        data := aw.pending.Bytes()
+
+        // The encoder only puts a newline before an element after the first
+        // one that it writes.
+        if aw.options.Compact == false && aw.pendingUsed == false {
+            data = append([]byte{'\n'}, data...)
+        }
+
+        err := aw.write(data)
+        log.PanicIf(err)
+
+        aw.pending.Reset()
+        aw.pendingUsed = true
+    }
+
+    if aw.unsynced == true && time.Since(aw.lastSync) >= aw.syncInterval {
+        err := aw.sync()
+        log.PanicIf(err)
+    }
+
+    return nil
+}
+
+func (aw *AppendingWriter) sync() (err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    err = aw.f.Sync()
+    log.PanicIf(err)
+
+    aw.lastSync = time.Now()
+    aw.unsynced = false
+
+    return nil
+}
+
+// Close flushes, syncs, and closes the file.
+func (aw *AppendingWriter) Close() (err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    err = aw.Flush()
+    log.PanicIf(err)
+
+    if aw.unsynced == true {
+        err := aw.sync()
+        log.PanicIf(err)
+    }
+
+    err = aw.f.Close()
+    log.PanicIf(err)
+
+    return nil
+}
@@ -0,0 +1,226 @@
+package gpxwriter
+
+import (
+    "bytes"
+    "encoding/xml"
+    "io"
+    "io/ioutil"
+    "os"
+    "path"
+    "testing"
+    "time"
+
+    "github.com/dsoprea/go-logging"
+
+    "github.com/dsoprea/go-gpx/reader"
+)
+
+func getAppendingFilepath() (tempPath string, filepath string) {
+    tempPath, err := ioutil.TempDir("", "")
+    log.PanicIf(err)
+
+    filepath = path.Join(tempPath, "live.gpx")
+
+    return tempPath, filepath
+}
+
+func appendTestPoint(aw *AppendingWriter, timestamp time.Time) {
+    tpb := aw.TrackPoint()
+
+    tpb.LatitudeDecimal = .123
+    tpb.LongitudeDecimal = .456
+    tpb.Time = timestamp
+
+    err := tpb.Write()
+    log.PanicIf(err)
+
+    err = aw.Flush()
+    log.PanicIf(err)
+}
+
+func assertWellFormed(t *testing.T, filepath string) {
+    f, err := os.Open(filepath)
+    log.PanicIf(err)
+
+    defer f.Close()
+
+    d := xml.NewDecoder(f)
+
+    for {
+        _, err := d.Token()
+        if err == io.EOF {
+            break
+        } else if err != nil {
+            t.Fatalf("File is not well-formed: %s", err)
+        }
+    }
+}
+
+func TestAppendingWriter_New(t *testing.T) {
+    tempPath, filepath := getAppendingFilepath()
+    defer os.RemoveAll(tempPath)
+
+    aw, err := NewAppendingWriter(filepath, DefaultBuilderOptions(), 0)
+    log.PanicIf(err)
+
+    assertWellFormed(t, filepath)
+
+    now1 := time.Now()
+    appendTestPoint(aw, now1)
+
+    assertWellFormed(t, filepath)
+
+    now2 := time.Now()
+    appendTestPoint(aw, now2)
+
+    err = aw.Close()
+    log.PanicIf(err)
+
+    actual, err := ioutil.ReadFile(filepath)
+    log.PanicIf(err)
+
+    expected := `<?xml version="1.0" encoding="UTF-8"?>
+<gpx xmlns="http://www.topografix.com/GPX/1/1" xmlns:gpxx="http://www.garmin.com/xmlschemas/GpxExtensions/v3" gpxtpx="http://www.garmin.com/xmlschemas/TrackPointExtension/v1" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:schemaLocation="http://www.topografix.com/GPX/1/1/gpx.xsd http://www.garmin.com/xmlschemas/GpxExtensions/v3 http://www.garmin.com/xmlschemas/GpxExtensionsv3.xsd http://www.garmin.com/xmlschemas/TrackPointExtension/v1 http://www.garmin.com/xmlschemas/TrackPointExtensionv1.xsd">
+  <trk>
+    <trkseg>
+      <trkpt lat="0.123" lon="0.456">
+        <time>` + now1.UTC().Format(time.RFC3339Nano) + `</time>
+      </trkpt>
+      <trkpt lat="0.123" lon="0.456">
+        <time>` + now2.UTC().Format(time.RFC3339Nano) + `</time>
+      </trkpt>
+    </trkseg>
+  </trk>
+</gpx>`
+
+    if string(actual) != expected {
+        t.Fatalf("Output not expected:\n%s", string(actual))
+    }
+}
+
+func TestAppendingWriter_Reopen(t *testing.T) {
+    tempPath, filepath := getAppendingFilepath()
+    defer os.RemoveAll(tempPath)
+
+    options := DefaultBuilderOptions()
+    options.Compact = true
+
+    aw, err := NewAppendingWriter(filepath, options, time.Hour)
+    log.PanicIf(err)
+
+    now1 := time.Now()
+    appendTestPoint(aw, now1)
+
+    err = aw.Close()
+    log.PanicIf(err)
+
+    aw, err = NewAppendingWriter(filepath, options, time.Hour)
+    log.PanicIf(err)
+
+    now2 := time.Now()
+    appendTestPoint(aw, now2)
+
+    err = aw.Close()
+    log.PanicIf(err)
+
+    assertWellFormed(t, filepath)
+
+    actual, err := ioutil.ReadFile(filepath)
+    log.PanicIf(err)
+
+    points := `<trkpt lat="0.123" lon="0.456"><time>` + now1.UTC().Format(time.RFC3339Nano) + `</time></trkpt><trkpt lat="0.123" lon="0.456"><time>` + now2.UTC().Format(time.RFC3339Nano) + `</time></trkpt></trkseg></trk></gpx>`
+
+    if bytes.HasSuffix(actual, []byte(points)) == false {
+        t.Fatalf("Points not appended to the same segment:\n%s", string(actual))
+    }
+}
+
+func TestAppendingWriter_ReadBack(t *testing.T) {
+    tempPath, filepath := getAppendingFilepath()
+    defer os.RemoveAll(tempPath)
+
+    aw, err := NewAppendingWriter(filepath, DefaultBuilderOptions(), 0)
+    log.PanicIf(err)
+
+    timestamps := []time.Time{
+        time.Date(2016, 12, 2, 8, 0, 0, 0, time.UTC),
+        time.Date(2016, 12, 2, 8, 0, 1, 500000000, time.FixedZone("local", -8*60*60)),
+    }
+
+    for _, timestamp := range timestamps {
+        appendTestPoint(aw, timestamp)
+    }
+
+    err = aw.Close()
+    log.PanicIf(err)
+
+    f, err := os.Open(filepath)
+    log.PanicIf(err)
+
+    defer f.Close()
+
+    points, err := gpxreader.ExtractTrackPoints(f)
+    log.PanicIf(err)
+
+    if len(points) != len(timestamps) {
+        t.Fatalf("Point count not correct: (%d)", len(points))
+    }
+
+    for i, tp := range points {
+        if tp.Time.Equal(timestamps[i]) == false {
+            t.Fatalf("Time (%d) not read back correctly: [%s] != [%s]", i, tp.Time, timestamps[i])
+        }
+    }
+}
+
+func TestAppendingWriter_Reopen_Interrupted(t *testing.T) {
+    tempPath, filepath := getAppendingFilepath()
+    defer os.RemoveAll(tempPath)
+
+    // Simulate a flush that was cut off in the middle of the second point.
+    data := `<?xml version="1.0" encoding="UTF-8"?>
+<gpx><trk><trkseg><trkpt lat="0.123" lon="0.456"><time>2016-12-02T08:05:44Z</time></trkpt>
+<trkpt lat="0.123" lon="0.4`
+
+    err := ioutil.WriteFile(filepath, []byte(data), 0644)
+    log.PanicIf(err)
+
+    aw, err := NewAppendingWriter(filepath, DefaultBuilderOptions(), 0)
+    log.PanicIf(err)
+
+    err = aw.Close()
+    log.PanicIf(err)
+
+    assertWellFormed(t, filepath)
+
+    actual, err := ioutil.ReadFile(filepath)
+    log.PanicIf(err)
+
+    expected := `<?xml version="1.0" encoding="UTF-8"?>
+<gpx><trk><trkseg><trkpt lat="0.123" lon="0.456"><time>2016-12-02T08:05:44Z</time></trkpt>
+    </trkseg>
+  </trk>
+</gpx>`
+
+    if string(actual) != expected {
+        t.Fatalf("Partial point not discarded:\n%s", string(actual))
+    }
+}
+
+func TestAppendingWriter_NotAppendable(t *testing.T) {
+    tempPath, filepath := getAppendingFilepath()
+    defer os.RemoveAll(tempPath)
+
+    data := `<?xml version="1.0" encoding="UTF-8"?>
+<gpx><trk><trkseg></trkseg></trk><extensions><note>abc</note></extensions></gpx>`
+
+    err := ioutil.WriteFile(filepath, []byte(data), 0644)
+    log.PanicIf(err)
+
+    _, err = NewAppendingWriter(filepath, DefaultBuilderOptions(), 0)
+    if err == nil {
+        t.Fatalf("Expected error.")
+    } else if log.Is(err, ErrNotAppendable) == false {
+        log.Panic(err)
+    }
+}
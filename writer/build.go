@@ -1,38 +1,261 @@
 package gpxwriter
 
 import (
+    "fmt"
     "io"
     "strconv"
     "time"
 
     "encoding/xml"
 
+    "github.com/dsoprea/go-gpx"
     "github.com/dsoprea/go-logging"
 )
 
+var (
+    ErrOutOfOrder = fmt.Errorf("element written out of the order required by the schema")
+)
+
+const (
+    // timestampLayout is how all timestamps are written.
+    timestampLayout = time.RFC3339Nano
+)
+
+// The top-level sections of the document, in the order that they must appear.
+const (
+    sectionNone = iota
+    sectionMetadata
+    sectionWaypoints
+    sectionRoutes
+    sectionTracks
+)
+
+// BuilderOptions controls how compactly the document is written. The zero
+// value writes full precision and indented output.
+type BuilderOptions struct {
+    // CoordinatePrecision is the number of decimal places written for
+    // latitudes and longitudes (see Precision()). If nil (or negative), the
+    // fewest digits that still represent the value exactly are written.
+    CoordinatePrecision *int
+
+    // ElevationPrecision is the number of decimal places written for
+    // elevations. If nil, it behaves as with CoordinatePrecision.
+    ElevationPrecision *int
+
+    // Compact suppresses the indentation and newlines between elements.
+    Compact bool
+
+    // OmitFields are the names of track-point child-elements (e.g. "speed",
+    // "course", "src") that are never written even if set. Omitting "time"
+    // also allows points without times to be written.
+    OmitFields []string
+}
+
+// DefaultBuilderOptions returns the options used by NewBuilder: full
+// precision and indented output.
+func DefaultBuilderOptions() BuilderOptions {
+    return BuilderOptions{}
+}
+
+// Precision returns a precision for BuilderOptions.
+func Precision(digits int) *int {
+    return &digits
+}
+
+// formatPrecision formats the value with the given number of decimal places,
+// or with full precision if not set.
+func formatPrecision(value float64, precision *int, bitSize int) string {
+    digits := -1
+    if precision != nil {
+        digits = *precision
+    }
+
+    return strconv.FormatFloat(value, 'f', digits, bitSize)
+}
+
 type Builder struct {
     w       io.Writer
     encoder *xml.Encoder
+    options BuilderOptions
+    omitted map[string]struct{}
 }
 
-func NewBuilder(w io.Writer) *Builder {
-    w.Write([]byte("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n"))
+func NewBuilder(w io.Writer) (b *Builder, err error) {
+    return NewBuilderWithOptions(w, DefaultBuilderOptions())
+}
 
+func NewBuilderWithOptions(w io.Writer, options BuilderOptions) (b *Builder, err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    _, err = w.Write([]byte("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n"))
+    log.PanicIf(err)
+
+    return newBuilder(w, options, ""), nil
+}
+
+// newBuilder returns a builder that does not write the XML declaration. The
+// prefix is applied to every indented line.
+func newBuilder(w io.Writer, options BuilderOptions, prefix string) *Builder {
     encoder := xml.NewEncoder(w)
 
-    encoder.Indent("", "  ")
+    if options.Compact == false {
+        encoder.Indent(prefix, "  ")
+    }
+
+    omitted := make(map[string]struct{})
+    for _, name := range options.OmitFields {
+        omitted[name] = struct{}{}
+    }
 
     return &Builder{
         w:       w,
         encoder: encoder,
+        options: options,
+        omitted: omitted,
     }
 }
 
+// isOmitted returns whether the given track-point child-element should be
+// skipped.
+func (b *Builder) isOmitted(name string) bool {
+    _, found := b.omitted[name]
+    return found
+}
+
+// writeValue writes a simple track-point child-element with character-data
+// unless it was omitted in the options.
+func (b *Builder) writeValue(name string, value string) (err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    if b.isOmitted(name) == true {
+        return nil
+    }
+
+    err = b.writeElement(name, value)
+    log.PanicIf(err)
+
+    return nil
+}
+
+// writeElement writes a simple child-element with character-data.
+func (b *Builder) writeElement(name string, value string) (err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    start := xml.StartElement{
+        Name: xml.Name{
+            Space: "",
+            Local: name,
+        },
+    }
+
+    err = b.encoder.EncodeElement(value, start)
+    log.PanicIf(err)
+
+    return nil
+}
+
+// writeOrderedElement writes a simple child-element at the given position
+// among its siblings. `last` is the position of the last sibling that was
+// written and is updated.
+func (b *Builder) writeOrderedElement(last *int, position int, name string, value string) (err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    if position <= *last {
+        log.Panic(ErrOutOfOrder)
+    }
+
+    err = b.writeElement(name, value)
+    log.PanicIf(err)
+
+    *last = position
+
+    return nil
+}
+
+// startElement opens an element.
+func (b *Builder) startElement(name string, attrs []xml.Attr) (err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    start := xml.StartElement{
+        Name: xml.Name{
+            Space: "",
+            Local: name,
+        },
+        Attr: attrs,
+    }
+
+    err = b.encoder.EncodeToken(start)
+    log.PanicIf(err)
+
+    return nil
+}
+
+// endElement closes an element.
+func (b *Builder) endElement(name string) (err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    end := xml.EndElement{
+        Name: xml.Name{
+            Space: "",
+            Local: name,
+        },
+    }
+
+    err = b.encoder.EncodeToken(end)
+    log.PanicIf(err)
+
+    return nil
+}
+
 type GpxBuilder struct {
     b *Builder
+
+    // section is the last top-level section that was written to.
+    section int
+}
+
+// enterSection makes sure that we are not going backwards through the
+// top-level sections.
+func (gb *GpxBuilder) enterSection(section int) (err error) {
+    if section < gb.section {
+        return ErrOutOfOrder
+    }
+
+    gb.section = section
+
+    return nil
 }
 
-func (b *Builder) Gpx() *GpxBuilder {
+func (b *Builder) Gpx() (gb *GpxBuilder, err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
 
     // Add <gpx> tag:
     //
@@ -69,12 +292,14 @@ func (b *Builder) Gpx() *GpxBuilder {
         Attr: attrs,
     }
 
-    err := b.encoder.EncodeToken(gpxStart)
+    err = b.encoder.EncodeToken(gpxStart)
     log.PanicIf(err)
 
-    return &GpxBuilder{
+    gb = &GpxBuilder{
         b: b,
     }
+
+    return gb, nil
 }
 
 func (gb *GpxBuilder) EndGpx() (err error) {
@@ -94,13 +319,41 @@ func (gb *GpxBuilder) EndGpx() (err error) {
     err = gb.b.encoder.EncodeToken(endElement)
     log.PanicIf(err)
 
-    gb.b.encoder.Flush()
+    err = gb.b.encoder.Flush()
+    log.PanicIf(err)
 
     return nil
 }
 
+// The positions of the child-elements of a track or route that we support.
+const (
+    positionName = iota + 1
+    positionDescription
+    positionType
+    positionChildren
+)
+
 type GpxTrackBuilder struct {
     b *Builder
+
+    // last is the position of the last child-element written.
+    last int
+}
+
+// SetName writes the name of the track. This, SetDescription(), and SetType()
+// must be called in that order and before any segments are added.
+func (gtb *GpxTrackBuilder) SetName(name string) (err error) {
+    return gtb.b.writeOrderedElement(&gtb.last, positionName, "name", name)
+}
+
+// SetDescription writes the description of the track.
+func (gtb *GpxTrackBuilder) SetDescription(description string) (err error) {
+    return gtb.b.writeOrderedElement(&gtb.last, positionDescription, "desc", description)
+}
+
+// SetType writes the type (classification) of the track.
+func (gtb *GpxTrackBuilder) SetType(trackType string) (err error) {
+    return gtb.b.writeOrderedElement(&gtb.last, positionType, "type", trackType)
 }
 
 func (gb *GpxBuilder) Track() (gpb *GpxTrackBuilder, err error) {
@@ -110,7 +363,10 @@ func (gb *GpxBuilder) Track() (gpb *GpxTrackBuilder, err error) {
         }
     }()
 
-    // Add <gpx> tag:
+    err = gb.enterSection(sectionTracks)
+    log.PanicIf(err)
+
+    // Add <trk> tag:
     //
     // <trk>
 
@@ -162,6 +418,8 @@ func (gtb *GpxTrackBuilder) TrackSegment() (gtsb *GpxTrackSegmentBuilder, err er
         }
     }()
 
+    gtb.last = positionChildren
+
     // Add <trkseg> tag:
     //
     // <trkseg>
@@ -211,13 +469,20 @@ type GpxTrackPointBuilder struct {
     LongitudeDecimal float64
     Time             time.Time
 
-    // NOTE(dustin): !! Finish implementing.
-    // Elevation      float32
-    // Course         float32
-    // Speed          float32
-    // Hdop           float32
-    // Src            string
-    // SatelliteCount uint8
+    // The following are only written if not zero.
+    Elevation      float32
+    Course         float32
+    Speed          float32
+    Hdop           float32
+    Vdop           float32
+    Pdop           float32
+    Src            string
+    SatelliteCount uint8
+
+    // HasCourse and HasSpeed write the course and speed even if they are
+    // zero.
+    HasCourse bool
+    HasSpeed  bool
 }
 
 func (gts *GpxTrackSegmentBuilder) TrackPoint() *GpxTrackPointBuilder {
@@ -226,6 +491,23 @@ func (gts *GpxTrackSegmentBuilder) TrackPoint() *GpxTrackPointBuilder {
     }
 }
 
+// SetTrackPoint copies the fields of the given point.
+func (gtpb *GpxTrackPointBuilder) SetTrackPoint(tp *gpxcommon.TrackPoint) {
+    gtpb.LatitudeDecimal = tp.LatitudeDecimal
+    gtpb.LongitudeDecimal = tp.LongitudeDecimal
+    gtpb.Time = tp.Time
+    gtpb.Elevation = tp.Elevation
+    gtpb.Course = tp.Course
+    gtpb.Speed = tp.Speed
+    gtpb.HasCourse = tp.HasCourse
+    gtpb.HasSpeed = tp.HasSpeed
+    gtpb.Hdop = tp.Hdop
+    gtpb.Vdop = tp.Vdop
+    gtpb.Pdop = tp.Pdop
+    gtpb.Src = tp.Src
+    gtpb.SatelliteCount = tp.SatelliteCount
+}
+
 func (gtpb *GpxTrackPointBuilder) Write() (err error) {
     defer func() {
         if state := recover(); state != nil {
@@ -233,7 +515,9 @@ func (gtpb *GpxTrackPointBuilder) Write() (err error) {
         }
     }()
 
-    if gtpb.Time.IsZero() {
+    timeOmitted := gtpb.b.isOmitted("time")
+
+    if gtpb.Time.IsZero() && timeOmitted == false {
         log.Panicf("timestamp not set")
     }
 
@@ -246,9 +530,11 @@ func (gtpb *GpxTrackPointBuilder) Write() (err error) {
         log.Panicf("longitude not set")
     }
 
+    options := gtpb.b.options
+
     attrs := make([]xml.Attr, 2)
-    attrs[0] = xml.Attr{Name: xml.Name{"", "lat"}, Value: strconv.FormatFloat(gtpb.LatitudeDecimal, 'f', -1, 64)}
-    attrs[1] = xml.Attr{Name: xml.Name{"", "lon"}, Value: strconv.FormatFloat(gtpb.LongitudeDecimal, 'f', -1, 64)}
+    attrs[0] = xml.Attr{Name: xml.Name{"", "lat"}, Value: formatPrecision(gtpb.LatitudeDecimal, options.CoordinatePrecision, 64)}
+    attrs[1] = xml.Attr{Name: xml.Name{"", "lon"}, Value: formatPrecision(gtpb.LongitudeDecimal, options.CoordinatePrecision, 64)}
 
     trkptStart := xml.StartElement{
         Name: xml.Name{
@@ -261,15 +547,59 @@ func (gtpb *GpxTrackPointBuilder) Write() (err error) {
     err = gtpb.b.encoder.EncodeToken(trkptStart)
     log.PanicIf(err)
 
-    timeStart := xml.StartElement{
-        Name: xml.Name{
-            Space: "",
-            Local: "time",
-        },
+    // Child-elements are written in the order that the schema requires.
+
+    if gtpb.Elevation != 0.0 {
+        err = gtpb.b.writeValue("ele", formatPrecision(float64(gtpb.Elevation), options.ElevationPrecision, 32))
+        log.PanicIf(err)
     }
 
-    err = gtpb.b.encoder.EncodeElement(gtpb.Time.UTC().Format("2006-01-02T15:04:05-0700"), timeStart)
-    log.PanicIf(err)
+    if timeOmitted == false {
+        timeStart := xml.StartElement{
+            Name: xml.Name{
+                Space: "",
+                Local: "time",
+            },
+        }
+
+        err = gtpb.b.encoder.EncodeElement(gtpb.Time.UTC().Format(timestampLayout), timeStart)
+        log.PanicIf(err)
+    }
+
+    if gtpb.Course != 0.0 || gtpb.HasCourse == true {
+        err = gtpb.b.writeValue("course", strconv.FormatFloat(float64(gtpb.Course), 'f', -1, 32))
+        log.PanicIf(err)
+    }
+
+    if gtpb.Speed != 0.0 || gtpb.HasSpeed == true {
+        err = gtpb.b.writeValue("speed", strconv.FormatFloat(float64(gtpb.Speed), 'f', -1, 32))
+        log.PanicIf(err)
+    }
+
+    if gtpb.Src != "" {
+        err = gtpb.b.writeValue("src", gtpb.Src)
+        log.PanicIf(err)
+    }
+
+    if gtpb.SatelliteCount != 0 {
+        err = gtpb.b.writeValue("sat", strconv.FormatUint(uint64(gtpb.SatelliteCount), 10))
+        log.PanicIf(err)
+    }
+
+    if gtpb.Hdop != 0.0 {
+        err = gtpb.b.writeValue("hdop", strconv.FormatFloat(float64(gtpb.Hdop), 'f', -1, 32))
+        log.PanicIf(err)
+    }
+
+    if gtpb.Vdop != 0.0 {
+        err = gtpb.b.writeValue("vdop", strconv.FormatFloat(float64(gtpb.Vdop), 'f', -1, 32))
+        log.PanicIf(err)
+    }
+
+    if gtpb.Pdop != 0.0 {
+        err = gtpb.b.writeValue("pdop", strconv.FormatFloat(float64(gtpb.Pdop), 'f', -1, 32))
+        log.PanicIf(err)
+    }
 
     trkptEnd := xml.EndElement{
         Name: xml.Name{
@@ -3,18 +3,82 @@ package gpxwriter
 import (
     "bytes"
     "fmt"
+    "io"
+    "strings"
     "testing"
     "time"
 
     "github.com/dsoprea/go-logging"
+
+    "github.com/dsoprea/go-gpx"
+    "github.com/dsoprea/go-gpx/reader"
+)
+
+var (
+    errTestWriteFailed = fmt.Errorf("write failed")
 )
 
+// failingWriter accepts the given number of bytes and fails every write after
+// that.
+type failingWriter struct {
+    remaining int
+}
+
+func (fw *failingWriter) Write(p []byte) (n int, err error) {
+    if len(p) > fw.remaining {
+        n = fw.remaining
+        fw.remaining = 0
+
+        return n, errTestWriteFailed
+    }
+
+    fw.remaining -= len(p)
+
+    return len(p), nil
+}
+
+func TestNewBuilder_WriteError(t *testing.T) {
+    fw := &failingWriter{}
+
+    _, err := NewBuilder(fw)
+    if err == nil {
+        t.Fatalf("Expected error.")
+    } else if log.Is(err, errTestWriteFailed) == false {
+        log.Panic(err)
+    }
+}
+
+func TestGpxBuilder_EndGpx_FlushError(t *testing.T) {
+    // Allow the XML declaration but nothing that is buffered after it.
+    fw := &failingWriter{
+        remaining: 39,
+    }
+
+    b, err := NewBuilder(fw)
+    log.PanicIf(err)
+
+    gb, err := b.Gpx()
+    log.PanicIf(err)
+
+    err = gb.EndGpx()
+    if err == nil {
+        t.Fatalf("Expected error.")
+    } else if log.Is(err, errTestWriteFailed) == false {
+        log.Panic(err)
+    }
+}
+
 func TestBuilder_Gpx(t *testing.T) {
     buffer := new(bytes.Buffer)
 
-    b := NewBuilder(buffer)
-    gb := b.Gpx()
-    gb.EndGpx()
+    b, err := NewBuilder(buffer)
+    log.PanicIf(err)
+
+    gb, err := b.Gpx()
+    log.PanicIf(err)
+
+    err = gb.EndGpx()
+    log.PanicIf(err)
 
     expected := `<?xml version="1.0" encoding="UTF-8"?>
 <gpx xmlns="http://www.topografix.com/GPX/1/1" xmlns:gpxx="http://www.garmin.com/xmlschemas/GpxExtensions/v3" gpxtpx="http://www.garmin.com/xmlschemas/TrackPointExtension/v1" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:schemaLocation="http://www.topografix.com/GPX/1/1/gpx.xsd http://www.garmin.com/xmlschemas/GpxExtensions/v3 http://www.garmin.com/xmlschemas/GpxExtensionsv3.xsd http://www.garmin.com/xmlschemas/TrackPointExtension/v1 http://www.garmin.com/xmlschemas/TrackPointExtensionv1.xsd"></gpx>`
@@ -30,8 +94,11 @@ func TestBuilder_Gpx(t *testing.T) {
 func TestBuilder_Track(t *testing.T) {
     buffer := new(bytes.Buffer)
 
-    b := NewBuilder(buffer)
-    gb := b.Gpx()
+    b, err := NewBuilder(buffer)
+    log.PanicIf(err)
+
+    gb, err := b.Gpx()
+    log.PanicIf(err)
 
     tb, err := gb.Track()
     log.PanicIf(err)
@@ -39,7 +106,8 @@ func TestBuilder_Track(t *testing.T) {
     err = tb.EndTrack()
     log.PanicIf(err)
 
-    gb.EndGpx()
+    err = gb.EndGpx()
+    log.PanicIf(err)
 
     expected := `<?xml version="1.0" encoding="UTF-8"?>
 <gpx xmlns="http://www.topografix.com/GPX/1/1" xmlns:gpxx="http://www.garmin.com/xmlschemas/GpxExtensions/v3" gpxtpx="http://www.garmin.com/xmlschemas/TrackPointExtension/v1" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:schemaLocation="http://www.topografix.com/GPX/1/1/gpx.xsd http://www.garmin.com/xmlschemas/GpxExtensions/v3 http://www.garmin.com/xmlschemas/GpxExtensionsv3.xsd http://www.garmin.com/xmlschemas/TrackPointExtension/v1 http://www.garmin.com/xmlschemas/TrackPointExtensionv1.xsd">
@@ -54,8 +122,11 @@ func TestBuilder_Track(t *testing.T) {
 func TestBuilder_TrackSegment(t *testing.T) {
     buffer := new(bytes.Buffer)
 
-    b := NewBuilder(buffer)
-    gb := b.Gpx()
+    b, err := NewBuilder(buffer)
+    log.PanicIf(err)
+
+    gb, err := b.Gpx()
+    log.PanicIf(err)
 
     tb, err := gb.Track()
     log.PanicIf(err)
@@ -69,7 +140,8 @@ func TestBuilder_TrackSegment(t *testing.T) {
     err = tb.EndTrack()
     log.PanicIf(err)
 
-    gb.EndGpx()
+    err = gb.EndGpx()
+    log.PanicIf(err)
 
     expected := `<?xml version="1.0" encoding="UTF-8"?>
 <gpx xmlns="http://www.topografix.com/GPX/1/1" xmlns:gpxx="http://www.garmin.com/xmlschemas/GpxExtensions/v3" gpxtpx="http://www.garmin.com/xmlschemas/TrackPointExtension/v1" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:schemaLocation="http://www.topografix.com/GPX/1/1/gpx.xsd http://www.garmin.com/xmlschemas/GpxExtensions/v3 http://www.garmin.com/xmlschemas/GpxExtensionsv3.xsd http://www.garmin.com/xmlschemas/TrackPointExtension/v1 http://www.garmin.com/xmlschemas/TrackPointExtensionv1.xsd">
@@ -86,8 +158,11 @@ func TestBuilder_TrackSegment(t *testing.T) {
 func TestBuilder_TrackPoint(t *testing.T) {
     buffer := new(bytes.Buffer)
 
-    b := NewBuilder(buffer)
-    gb := b.Gpx()
+    b, err := NewBuilder(buffer)
+    log.PanicIf(err)
+
+    gb, err := b.Gpx()
+    log.PanicIf(err)
 
     tb, err := gb.Track()
     log.PanicIf(err)
@@ -112,14 +187,15 @@ func TestBuilder_TrackPoint(t *testing.T) {
     err = tb.EndTrack()
     log.PanicIf(err)
 
-    gb.EndGpx()
+    err = gb.EndGpx()
+    log.PanicIf(err)
 
     expected := `<?xml version="1.0" encoding="UTF-8"?>
 <gpx xmlns="http://www.topografix.com/GPX/1/1" xmlns:gpxx="http://www.garmin.com/xmlschemas/GpxExtensions/v3" gpxtpx="http://www.garmin.com/xmlschemas/TrackPointExtension/v1" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:schemaLocation="http://www.topografix.com/GPX/1/1/gpx.xsd http://www.garmin.com/xmlschemas/GpxExtensions/v3 http://www.garmin.com/xmlschemas/GpxExtensionsv3.xsd http://www.garmin.com/xmlschemas/TrackPointExtension/v1 http://www.garmin.com/xmlschemas/TrackPointExtensionv1.xsd">
   <trk>
     <trkseg>
       <trkpt lat="0.123" lon="0.456">
-        <time>` + now.UTC().Format("2006-01-02T15:04:05-0700") + `</time>
+        <time>` + now.UTC().Format(time.RFC3339Nano) + `</time>
       </trkpt>
     </trkseg>
   </trk>
@@ -134,8 +210,11 @@ func TestBuilder_TrackPoint(t *testing.T) {
 func TestBuilder_TrackPoint_Multiple(t *testing.T) {
     buffer := new(bytes.Buffer)
 
-    b := NewBuilder(buffer)
-    gb := b.Gpx()
+    b, err := NewBuilder(buffer)
+    log.PanicIf(err)
+
+    gb, err := b.Gpx()
+    log.PanicIf(err)
 
     tb, err := gb.Track()
     log.PanicIf(err)
@@ -188,20 +267,21 @@ func TestBuilder_TrackPoint_Multiple(t *testing.T) {
     err = tb.EndTrack()
     log.PanicIf(err)
 
-    gb.EndGpx()
+    err = gb.EndGpx()
+    log.PanicIf(err)
 
     expected := `<?xml version="1.0" encoding="UTF-8"?>
 <gpx xmlns="http://www.topografix.com/GPX/1/1" xmlns:gpxx="http://www.garmin.com/xmlschemas/GpxExtensions/v3" gpxtpx="http://www.garmin.com/xmlschemas/TrackPointExtension/v1" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:schemaLocation="http://www.topografix.com/GPX/1/1/gpx.xsd http://www.garmin.com/xmlschemas/GpxExtensions/v3 http://www.garmin.com/xmlschemas/GpxExtensionsv3.xsd http://www.garmin.com/xmlschemas/TrackPointExtension/v1 http://www.garmin.com/xmlschemas/TrackPointExtensionv1.xsd">
   <trk>
     <trkseg>
       <trkpt lat="0.123" lon="0.456">
-        <time>` + now1.UTC().Format("2006-01-02T15:04:05-0700") + `</time>
+        <time>` + now1.UTC().Format(time.RFC3339Nano) + `</time>
       </trkpt>
       <trkpt lat="0.123" lon="0.456">
-        <time>` + now2.UTC().Format("2006-01-02T15:04:05-0700") + `</time>
+        <time>` + now2.UTC().Format(time.RFC3339Nano) + `</time>
       </trkpt>
       <trkpt lat="0.123" lon="0.456">
-        <time>` + now3.UTC().Format("2006-01-02T15:04:05-0700") + `</time>
+        <time>` + now3.UTC().Format(time.RFC3339Nano) + `</time>
       </trkpt>
     </trkseg>
   </trk>
@@ -212,3 +292,304 @@ func TestBuilder_TrackPoint_Multiple(t *testing.T) {
         fmt.Printf("\nEXPECTED:\n%s\n", expected)
     }
 }
+
+func TestBuilder_TrackPoint_Options(t *testing.T) {
+    buffer := new(bytes.Buffer)
+
+    options := BuilderOptions{
+        CoordinatePrecision: Precision(3),
+        ElevationPrecision:  Precision(1),
+        Compact:             true,
+        OmitFields:          []string{"src"},
+    }
+
+    b, err := NewBuilderWithOptions(buffer, options)
+    log.PanicIf(err)
+
+    gb, err := b.Gpx()
+    log.PanicIf(err)
+
+    tb, err := gb.Track()
+    log.PanicIf(err)
+
+    tsb, err := tb.TrackSegment()
+    log.PanicIf(err)
+
+    tpb := tsb.TrackPoint()
+
+    tpb.LatitudeDecimal = 47.61360231405151
+    tpb.LongitudeDecimal = -122.33966135543184
+    tpb.Elevation = 12.178885901563254
+    tpb.Src = "gps"
+    tpb.SatelliteCount = 4
+    tpb.Hdop = 3.8
+    tpb.Vdop = 1
+    tpb.Pdop = 3.9
+
+    now := time.Now()
+    tpb.Time = now
+
+    err = tpb.Write()
+    log.PanicIf(err)
+
+    err = tsb.EndTrackSegment()
+    log.PanicIf(err)
+
+    err = tb.EndTrack()
+    log.PanicIf(err)
+
+    err = gb.EndGpx()
+    log.PanicIf(err)
+
+    expected := `<?xml version="1.0" encoding="UTF-8"?>
+<gpx xmlns="http://www.topografix.com/GPX/1/1" xmlns:gpxx="http://www.garmin.com/xmlschemas/GpxExtensions/v3" gpxtpx="http://www.garmin.com/xmlschemas/TrackPointExtension/v1" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:schemaLocation="http://www.topografix.com/GPX/1/1/gpx.xsd http://www.garmin.com/xmlschemas/GpxExtensions/v3 http://www.garmin.com/xmlschemas/GpxExtensionsv3.xsd http://www.garmin.com/xmlschemas/TrackPointExtension/v1 http://www.garmin.com/xmlschemas/TrackPointExtensionv1.xsd"><trk><trkseg><trkpt lat="47.614" lon="-122.340"><ele>12.2</ele><time>` + now.UTC().Format(time.RFC3339Nano) + `</time><sat>4</sat><hdop>3.8</hdop><vdop>1</vdop><pdop>3.9</pdop></trkpt></trkseg></trk></gpx>`
+
+    if buffer.String() != expected {
+        fmt.Printf("\nACTUAL:\n%s\n", buffer.String())
+        fmt.Printf("\nEXPECTED:\n%s\n", expected)
+
+        t.Fatalf("Output not expected.")
+    }
+}
+
+func TestBuilder_TrackPoint_ZeroOptions(t *testing.T) {
+    buffer := new(bytes.Buffer)
+
+    // Precisions that aren't set are full precision.
+    b, err := NewBuilderWithOptions(buffer, BuilderOptions{Compact: true})
+    log.PanicIf(err)
+
+    gb, err := b.Gpx()
+    log.PanicIf(err)
+
+    tb, err := gb.Track()
+    log.PanicIf(err)
+
+    tsb, err := tb.TrackSegment()
+    log.PanicIf(err)
+
+    tpb := tsb.TrackPoint()
+
+    tpb.LatitudeDecimal = 47.61360231405151
+    tpb.LongitudeDecimal = -122.33966135543184
+    tpb.Elevation = 12.25
+    tpb.Time = time.Now()
+
+    err = tpb.Write()
+    log.PanicIf(err)
+
+    err = tsb.EndTrackSegment()
+    log.PanicIf(err)
+
+    err = tb.EndTrack()
+    log.PanicIf(err)
+
+    err = gb.EndGpx()
+    log.PanicIf(err)
+
+    s := buffer.String()
+
+    if strings.Contains(s, `<trkpt lat="47.61360231405151" lon="-122.33966135543184">`) == false {
+        t.Fatalf("Coordinates not written at full precision:\n%s", s)
+    } else if strings.Contains(s, "<ele>12.25</ele>") == false {
+        t.Fatalf("Elevation not written at full precision:\n%s", s)
+    }
+}
+
+func TestBuilder_TrackPoint_OmitTime(t *testing.T) {
+    buffer := new(bytes.Buffer)
+
+    options := DefaultBuilderOptions()
+    options.Compact = true
+    options.OmitFields = []string{"time"}
+
+    b, err := NewBuilderWithOptions(buffer, options)
+    log.PanicIf(err)
+
+    gb, err := b.Gpx()
+    log.PanicIf(err)
+
+    tb, err := gb.Track()
+    log.PanicIf(err)
+
+    tsb, err := tb.TrackSegment()
+    log.PanicIf(err)
+
+    // One point has a time and the other doesn't.
+
+    tpb := tsb.TrackPoint()
+
+    tpb.LatitudeDecimal = 47.6136
+    tpb.LongitudeDecimal = -122.3397
+    tpb.Time = time.Now()
+
+    err = tpb.Write()
+    log.PanicIf(err)
+
+    tpb = tsb.TrackPoint()
+
+    tpb.LatitudeDecimal = 47.6137
+    tpb.LongitudeDecimal = -122.3397
+
+    err = tpb.Write()
+    log.PanicIf(err)
+
+    err = tsb.EndTrackSegment()
+    log.PanicIf(err)
+
+    err = tb.EndTrack()
+    log.PanicIf(err)
+
+    err = gb.EndGpx()
+    log.PanicIf(err)
+
+    if strings.Contains(buffer.String(), "<trkseg><trkpt lat=\"47.6136\" lon=\"-122.3397\"></trkpt><trkpt lat=\"47.6137\" lon=\"-122.3397\"></trkpt></trkseg>") == false {
+        t.Fatalf("Output not expected:\n%s", buffer.String())
+    }
+}
+
+// writeTestPoints writes the given points as a single track and segment.
+func writeTestPoints(w io.Writer, options BuilderOptions, points []gpxcommon.TrackPoint) {
+    b, err := NewBuilderWithOptions(w, options)
+    log.PanicIf(err)
+
+    gb, err := b.Gpx()
+    log.PanicIf(err)
+
+    tb, err := gb.Track()
+    log.PanicIf(err)
+
+    tsb, err := tb.TrackSegment()
+    log.PanicIf(err)
+
+    for _, tp := range points {
+        tpb := tsb.TrackPoint()
+        tpb.SetTrackPoint(&tp)
+
+        err := tpb.Write()
+        log.PanicIf(err)
+    }
+
+    err = tsb.EndTrackSegment()
+    log.PanicIf(err)
+
+    err = tb.EndTrack()
+    log.PanicIf(err)
+
+    err = gb.EndGpx()
+    log.PanicIf(err)
+}
+
+func BenchmarkBuilder_TrackPoints(b *testing.B) {
+    points, err := gpxreader.ExtractTrackPoints(bytes.NewBufferString(gpxreader.TestGpxData))
+    log.PanicIf(err)
+
+    compact := BuilderOptions{
+        CoordinatePrecision: Precision(6),
+        ElevationPrecision:  Precision(1),
+        Compact:             true,
+        OmitFields:          []string{"course", "speed", "src"},
+    }
+
+    cases := []struct {
+        name    string
+        options BuilderOptions
+    }{
+        {"Default", DefaultBuilderOptions()},
+        {"Compact", compact},
+    }
+
+    for _, c := range cases {
+        b.Run(c.name, func(b *testing.B) {
+            buffer := new(bytes.Buffer)
+            writeTestPoints(buffer, c.options, points)
+
+            size := buffer.Len()
+
+            b.SetBytes(int64(size))
+            b.ResetTimer()
+
+            for i := 0; i < b.N; i++ {
+                buffer.Reset()
+                writeTestPoints(buffer, c.options, points)
+            }
+
+            // This needs to be reported after the timer is reset.
+            b.ReportMetric(float64(size), "file-bytes")
+        })
+    }
+}
+
+const (
+    testGpxOpenTag = `<gpx xmlns="http://www.topografix.com/GPX/1/1" xmlns:gpxx="http://www.garmin.com/xmlschemas/GpxExtensions/v3" gpxtpx="http://www.garmin.com/xmlschemas/TrackPointExtension/v1" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:schemaLocation="http://www.topografix.com/GPX/1/1/gpx.xsd http://www.garmin.com/xmlschemas/GpxExtensions/v3 http://www.garmin.com/xmlschemas/GpxExtensionsv3.xsd http://www.garmin.com/xmlschemas/TrackPointExtension/v1 http://www.garmin.com/xmlschemas/TrackPointExtensionv1.xsd">`
+)
+
+// newCompactTestBuilder returns a builder that writes without indentation to
+// keep the expected output manageable.
+func newCompactTestBuilder() (b *Builder, buffer *bytes.Buffer) {
+    buffer = new(bytes.Buffer)
+
+    options := DefaultBuilderOptions()
+    options.Compact = true
+
+    b, err := NewBuilderWithOptions(buffer, options)
+    log.PanicIf(err)
+
+    return b, buffer
+}
+
+func TestGpxTrackBuilder_SetName(t *testing.T) {
+    b, buffer := newCompactTestBuilder()
+    gb, err := b.Gpx()
+    log.PanicIf(err)
+
+    tb, err := gb.Track()
+    log.PanicIf(err)
+
+    err = tb.SetName("Morning")
+    log.PanicIf(err)
+
+    err = tb.SetDescription("Commute")
+    log.PanicIf(err)
+
+    err = tb.SetType("Driving")
+    log.PanicIf(err)
+
+    tsb, err := tb.TrackSegment()
+    log.PanicIf(err)
+
+    err = tsb.EndTrackSegment()
+    log.PanicIf(err)
+
+    err = tb.EndTrack()
+    log.PanicIf(err)
+
+    err = gb.EndGpx()
+    log.PanicIf(err)
+
+    expected := `<?xml version="1.0" encoding="UTF-8"?>
+` + testGpxOpenTag + `<trk><name>Morning</name><desc>Commute</desc><type>Driving</type><trkseg></trkseg></trk></gpx>`
+
+    if buffer.String() != expected {
+        t.Fatalf("Output not expected:\n%s", buffer.String())
+    }
+}
+
+func TestGpxTrackBuilder_SetName_OutOfOrder(t *testing.T) {
+    b, _ := newCompactTestBuilder()
+    gb, err := b.Gpx()
+    log.PanicIf(err)
+
+    tb, err := gb.Track()
+    log.PanicIf(err)
+
+    _, err = tb.TrackSegment()
+    log.PanicIf(err)
+
+    err = tb.SetName("Morning")
+    if err == nil {
+        t.Fatalf("Expected error.")
+    } else if log.Is(err, ErrOutOfOrder) == false {
+        log.Panic(err)
+    }
+}
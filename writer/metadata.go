@@ -0,0 +1,132 @@
+package gpxwriter
+
+import (
+    "time"
+
+    "encoding/xml"
+
+    "github.com/dsoprea/go-logging"
+)
+
+// Link is a reference to an external resource.
+type Link struct {
+    Href string
+
+    // The following are only written if not empty.
+    Text string
+    Type string
+}
+
+// GpxMetadataBuilder writes the metadata of the document.
+type GpxMetadataBuilder struct {
+    gb *GpxBuilder
+
+    // The following are only written if not zero.
+    Name        string
+    Description string
+    AuthorName  string
+    Links       []Link
+    Time        time.Time
+    Keywords    string
+}
+
+// Metadata returns a builder for the metadata. It may only be written once and
+// must be written before anything else.
+func (gb *GpxBuilder) Metadata() *GpxMetadataBuilder {
+    return &GpxMetadataBuilder{
+        gb: gb,
+    }
+}
+
+func (gmb *GpxMetadataBuilder) Write() (err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    gb := gmb.gb
+    b := gb.b
+
+    if gb.section != sectionNone {
+        log.Panic(ErrOutOfOrder)
+    }
+
+    gb.section = sectionMetadata
+
+    err = b.startElement("metadata", nil)
+    log.PanicIf(err)
+
+    // Child-elements are written in the order that the schema requires.
+
+    if gmb.Name != "" {
+        err := b.writeElement("name", gmb.Name)
+        log.PanicIf(err)
+    }
+
+    if gmb.Description != "" {
+        err := b.writeElement("desc", gmb.Description)
+        log.PanicIf(err)
+    }
+
+    if gmb.AuthorName != "" {
+        err := b.startElement("author", nil)
+        log.PanicIf(err)
+
+        err = b.writeElement("name", gmb.AuthorName)
+        log.PanicIf(err)
+
+        err = b.endElement("author")
+        log.PanicIf(err)
+    }
+
+    for _, link := range gmb.Links {
+        err := b.writeLink(link)
+        log.PanicIf(err)
+    }
+
+    if gmb.Time.IsZero() == false {
+        err := b.writeElement("time", gmb.Time.UTC().Format(timestampLayout))
+        log.PanicIf(err)
+    }
+
+    if gmb.Keywords != "" {
+        err := b.writeElement("keywords", gmb.Keywords)
+        log.PanicIf(err)
+    }
+
+    err = b.endElement("metadata")
+    log.PanicIf(err)
+
+    return nil
+}
+
+func (b *Builder) writeLink(link Link) (err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    attrs := []xml.Attr{
+        {Name: xml.Name{Local: "href"}, Value: link.Href},
+    }
+
+    err = b.startElement("link", attrs)
+    log.PanicIf(err)
+
+    if link.Text != "" {
+        err := b.writeElement("text", link.Text)
+        log.PanicIf(err)
+    }
+
+    if link.Type != "" {
+        err := b.writeElement("type", link.Type)
+        log.PanicIf(err)
+    }
+
+    err = b.endElement("link")
+    log.PanicIf(err)
+
+    return nil
+}
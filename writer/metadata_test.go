@@ -0,0 +1,57 @@
+package gpxwriter
+
+import (
+    "testing"
+    "time"
+
+    "github.com/dsoprea/go-logging"
+)
+
+func TestGpxMetadataBuilder_Write(t *testing.T) {
+    b, buffer := newCompactTestBuilder()
+    gb, err := b.Gpx()
+    log.PanicIf(err)
+
+    gmb := gb.Metadata()
+
+    gmb.Name = "Planning"
+    gmb.Description = "Deliveries"
+    gmb.AuthorName = "Dispatch"
+    gmb.Links = []Link{
+        {Href: "https://example.com/routes/1", Text: "Route 1"},
+    }
+    gmb.Time = time.Date(2016, 12, 2, 8, 5, 44, 0, time.UTC)
+    gmb.Keywords = "delivery, seattle"
+
+    err = gmb.Write()
+    log.PanicIf(err)
+
+    err = gb.EndGpx()
+    log.PanicIf(err)
+
+    expected := `<?xml version="1.0" encoding="UTF-8"?>
+` + testGpxOpenTag + `<metadata><name>Planning</name><desc>Deliveries</desc><author><name>Dispatch</name></author><link href="https://example.com/routes/1"><text>Route 1</text></link><time>2016-12-02T08:05:44Z</time><keywords>delivery, seattle</keywords></metadata></gpx>`
+
+    if buffer.String() != expected {
+        t.Fatalf("Output not expected:\n%s", buffer.String())
+    }
+}
+
+func TestGpxMetadataBuilder_Write_OutOfOrder(t *testing.T) {
+    b, _ := newCompactTestBuilder()
+    gb, err := b.Gpx()
+    log.PanicIf(err)
+
+    _, err = gb.Track()
+    log.PanicIf(err)
+
+    gmb := gb.Metadata()
+    gmb.Name = "Planning"
+
+    err = gmb.Write()
+    if err == nil {
+        t.Fatalf("Expected error.")
+    } else if log.Is(err, ErrOutOfOrder) == false {
+        log.Panic(err)
+    }
+}
@@ -0,0 +1,77 @@
+package gpxwriter
+
+import (
+    "github.com/dsoprea/go-logging"
+)
+
+type GpxRouteBuilder struct {
+    b *Builder
+
+    // last is the position of the last child-element written.
+    last int
+}
+
+// Route opens a route. All routes must be written after any waypoints and
+// before any tracks.
+func (gb *GpxBuilder) Route() (grb *GpxRouteBuilder, err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    err = gb.enterSection(sectionRoutes)
+    log.PanicIf(err)
+
+    // Add <rte> tag:
+    //
+    // <rte>
+
+    err = gb.b.startElement("rte", nil)
+    log.PanicIf(err)
+
+    grb = &GpxRouteBuilder{
+        b: gb.b,
+    }
+
+    return grb, nil
+}
+
+// SetName writes the name of the route. This, SetDescription(), and SetType()
+// must be called in that order and before any route-points are written.
+func (grb *GpxRouteBuilder) SetName(name string) (err error) {
+    return grb.b.writeOrderedElement(&grb.last, positionName, "name", name)
+}
+
+// SetDescription writes the description of the route.
+func (grb *GpxRouteBuilder) SetDescription(description string) (err error) {
+    return grb.b.writeOrderedElement(&grb.last, positionDescription, "desc", description)
+}
+
+// SetType writes the type (classification) of the route.
+func (grb *GpxRouteBuilder) SetType(routeType string) (err error) {
+    return grb.b.writeOrderedElement(&grb.last, positionType, "type", routeType)
+}
+
+// RoutePoint returns a builder for the next point in the route.
+func (grb *GpxRouteBuilder) RoutePoint() *GpxWaypointBuilder {
+    grb.last = positionChildren
+
+    return &GpxWaypointBuilder{
+        b:       grb.b,
+        tagName: "rtept",
+    }
+}
+
+func (grb *GpxRouteBuilder) EndRoute() (err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    err = grb.b.endElement("rte")
+    log.PanicIf(err)
+
+    return nil
+}
@@ -0,0 +1,86 @@
+package gpxwriter
+
+import (
+    "testing"
+
+    "github.com/dsoprea/go-logging"
+)
+
+func TestGpxRouteBuilder(t *testing.T) {
+    b, buffer := newCompactTestBuilder()
+    gb, err := b.Gpx()
+    log.PanicIf(err)
+
+    gwb := gb.Waypoint()
+
+    gwb.LatitudeDecimal = 47.6131631
+    gwb.LongitudeDecimal = -122.3401957
+    gwb.Name = "Depot"
+
+    err = gwb.Write()
+    log.PanicIf(err)
+
+    grb, err := gb.Route()
+    log.PanicIf(err)
+
+    err = grb.SetName("Route 1")
+    log.PanicIf(err)
+
+    err = grb.SetType("Delivery")
+    log.PanicIf(err)
+
+    rpb := grb.RoutePoint()
+
+    rpb.LatitudeDecimal = 47.6131631
+    rpb.LongitudeDecimal = -122.3401957
+
+    err = rpb.Write()
+    log.PanicIf(err)
+
+    rpb = grb.RoutePoint()
+
+    rpb.LatitudeDecimal = 47.61029656609932
+    rpb.LongitudeDecimal = -122.34047933763608
+    rpb.Name = "Stop 1"
+
+    err = rpb.Write()
+    log.PanicIf(err)
+
+    err = grb.EndRoute()
+    log.PanicIf(err)
+
+    tb, err := gb.Track()
+    log.PanicIf(err)
+
+    err = tb.EndTrack()
+    log.PanicIf(err)
+
+    err = gb.EndGpx()
+    log.PanicIf(err)
+
+    expected := `<?xml version="1.0" encoding="UTF-8"?>
+` + testGpxOpenTag + `<wpt lat="47.6131631" lon="-122.3401957"><name>Depot</name></wpt><rte><name>Route 1</name><type>Delivery</type><rtept lat="47.6131631" lon="-122.3401957"></rtept><rtept lat="47.61029656609932" lon="-122.34047933763608"><name>Stop 1</name></rtept></rte><trk></trk></gpx>`
+
+    if buffer.String() != expected {
+        t.Fatalf("Output not expected:\n%s", buffer.String())
+    }
+}
+
+func TestGpxRouteBuilder_SetName_OutOfOrder(t *testing.T) {
+    b, _ := newCompactTestBuilder()
+    gb, err := b.Gpx()
+    log.PanicIf(err)
+
+    grb, err := gb.Route()
+    log.PanicIf(err)
+
+    err = grb.SetType("Delivery")
+    log.PanicIf(err)
+
+    err = grb.SetName("Route 1")
+    if err == nil {
+        t.Fatalf("Expected error.")
+    } else if log.Is(err, ErrOutOfOrder) == false {
+        log.Panic(err)
+    }
+}
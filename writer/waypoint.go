@@ -0,0 +1,126 @@
+package gpxwriter
+
+import (
+    "time"
+
+    "encoding/xml"
+
+    "github.com/dsoprea/go-gpx"
+    "github.com/dsoprea/go-logging"
+)
+
+// GpxWaypointBuilder writes a single waypoint or route-point.
+type GpxWaypointBuilder struct {
+    b *Builder
+
+    // gb is only set for waypoints, which are a top-level section.
+    gb      *GpxBuilder
+    tagName string
+
+    LatitudeDecimal  float64
+    LongitudeDecimal float64
+
+    // The following are only written if not zero.
+    Elevation   float32
+    Time        time.Time
+    Name        string
+    Comment     string
+    Description string
+    Src         string
+    Symbol      string
+    Type        string
+}
+
+// Waypoint returns a builder for a waypoint. All waypoints must be written
+// after the metadata and before any routes or tracks.
+func (gb *GpxBuilder) Waypoint() *GpxWaypointBuilder {
+    return &GpxWaypointBuilder{
+        b:       gb.b,
+        gb:      gb,
+        tagName: "wpt",
+    }
+}
+
+// SetWaypoint copies the fields of the given waypoint.
+func (gwb *GpxWaypointBuilder) SetWaypoint(w *gpxcommon.Waypoint) {
+    gwb.LatitudeDecimal = w.LatitudeDecimal
+    gwb.LongitudeDecimal = w.LongitudeDecimal
+    gwb.Elevation = w.Elevation
+    gwb.Time = w.Time
+    gwb.Name = w.Name
+    gwb.Comment = w.Comment
+    gwb.Description = w.Description
+    gwb.Src = w.Src
+    gwb.Symbol = w.Symbol
+    gwb.Type = w.Type
+}
+
+func (gwb *GpxWaypointBuilder) Write() (err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = log.Wrap(state.(error))
+        }
+    }()
+
+    if gwb.gb != nil {
+        err := gwb.gb.enterSection(sectionWaypoints)
+        log.PanicIf(err)
+    }
+
+    // TODO(dustin): !! Handle epsilon.
+    if gwb.LatitudeDecimal == 0.0 {
+        log.Panicf("latitude not set")
+    }
+
+    if gwb.LongitudeDecimal == 0.0 {
+        log.Panicf("longitude not set")
+    }
+
+    options := gwb.b.options
+
+    attrs := []xml.Attr{
+        {Name: xml.Name{Local: "lat"}, Value: formatPrecision(gwb.LatitudeDecimal, options.CoordinatePrecision, 64)},
+        {Name: xml.Name{Local: "lon"}, Value: formatPrecision(gwb.LongitudeDecimal, options.CoordinatePrecision, 64)},
+    }
+
+    err = gwb.b.startElement(gwb.tagName, attrs)
+    log.PanicIf(err)
+
+    // Child-elements are written in the order that the schema requires.
+
+    if gwb.Elevation != 0.0 {
+        err := gwb.b.writeElement("ele", formatPrecision(float64(gwb.Elevation), options.ElevationPrecision, 32))
+        log.PanicIf(err)
+    }
+
+    if gwb.Time.IsZero() == false {
+        err := gwb.b.writeElement("time", gwb.Time.UTC().Format(timestampLayout))
+        log.PanicIf(err)
+    }
+
+    values := []struct {
+        name  string
+        value string
+    }{
+        {"name", gwb.Name},
+        {"cmt", gwb.Comment},
+        {"desc", gwb.Description},
+        {"src", gwb.Src},
+        {"sym", gwb.Symbol},
+        {"type", gwb.Type},
+    }
+
+    for _, v := range values {
+        if v.value == "" {
+            continue
+        }
+
+        err := gwb.b.writeElement(v.name, v.value)
+        log.PanicIf(err)
+    }
+
+    err = gwb.b.endElement(gwb.tagName)
+    log.PanicIf(err)
+
+    return nil
+}
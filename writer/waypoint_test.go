@@ -0,0 +1,59 @@
+package gpxwriter
+
+import (
+    "testing"
+
+    "github.com/dsoprea/go-logging"
+)
+
+func TestGpxWaypointBuilder_Write(t *testing.T) {
+    b, buffer := newCompactTestBuilder()
+    gb, err := b.Gpx()
+    log.PanicIf(err)
+
+    gwb := gb.Waypoint()
+
+    gwb.LatitudeDecimal = 47.6131631
+    gwb.LongitudeDecimal = -122.3401957
+    gwb.Elevation = 52
+    gwb.Name = "Depot"
+    gwb.Description = "Loading dock"
+    gwb.Symbol = "Flag"
+
+    err = gwb.Write()
+    log.PanicIf(err)
+
+    err = gb.EndGpx()
+    log.PanicIf(err)
+
+    expected := `<?xml version="1.0" encoding="UTF-8"?>
+` + testGpxOpenTag + `<wpt lat="47.6131631" lon="-122.3401957"><ele>52</ele><name>Depot</name><desc>Loading dock</desc><sym>Flag</sym></wpt></gpx>`
+
+    if buffer.String() != expected {
+        t.Fatalf("Output not expected:\n%s", buffer.String())
+    }
+}
+
+func TestGpxWaypointBuilder_Write_OutOfOrder(t *testing.T) {
+    b, _ := newCompactTestBuilder()
+    gb, err := b.Gpx()
+    log.PanicIf(err)
+
+    grb, err := gb.Route()
+    log.PanicIf(err)
+
+    err = grb.EndRoute()
+    log.PanicIf(err)
+
+    gwb := gb.Waypoint()
+
+    gwb.LatitudeDecimal = 47.6131631
+    gwb.LongitudeDecimal = -122.3401957
+
+    err = gwb.Write()
+    if err == nil {
+        t.Fatalf("Expected error.")
+    } else if log.Is(err, ErrOutOfOrder) == false {
+        log.Panic(err)
+    }
+}